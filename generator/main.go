@@ -0,0 +1,83 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+
+// Command generator writes railway description of random network, valid for simulation.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"../src/rails"
+)
+
+func check(e error) {
+	if e != nil {
+		panic(e)
+	}
+}
+
+var defaults = rails.DefaultGeneratorOptions()
+
+var outFilename = flag.String("o", "generated", "output file for railroad description, .json and .yaml files are written as JSON and YAML")
+var seed = flag.Int64("seed", 0, "seed for random network, current time is used when not given")
+var secondsPerHour = flag.Int("sph", defaults.SecondsPerHour, "seconds for hour simulation")
+var turntables = flag.Int("turntables", defaults.Turntables, "number of turntables, every station takes two")
+var stations = flag.Int("stations", defaults.Stations, "number of passenger stations")
+var trains = flag.Int("trains", defaults.Trains, "number of trains")
+var repairTeams = flag.Int("teams", defaults.RepairTeams, "number of repair teams, based at one depot")
+var workers = flag.Int("workers", defaults.Workers, "number of workers")
+var density = flag.Float64("density", defaults.Density, "fraction of pairs of turntables joined by normal tracks")
+var minLen = flag.Int("minlen", defaults.MinLen, "minimum normal track length in km")
+var maxLen = flag.Int("maxlen", defaults.MaxLen, "maximum normal track length in km")
+var minLimit = flag.Int("minlimit", defaults.MinLimit, "minimum normal track speed limit in km/h")
+var maxLimit = flag.Int("maxlimit", defaults.MaxLimit, "maximum normal track speed limit in km/h")
+
+// isSet reports whether flag with given name was given on command line, even with its default value.
+func isSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return
+}
+
+func main() {
+	flag.Parse()
+
+	if !isSet("seed") {
+		*seed = time.Now().UnixNano()
+	}
+	options := rails.GeneratorOptions{
+		SecondsPerHour: *secondsPerHour,
+		Turntables:     *turntables,
+		Stations:       *stations,
+		Trains:         *trains,
+		RepairTeams:    *repairTeams,
+		Workers:        *workers,
+		Density:        *density,
+		MinLen:         *minLen,
+		MaxLen:         *maxLen,
+		MinLimit:       *minLimit,
+		MaxLimit:       *maxLimit}
+
+	desc, err := rails.Generate(options, rand.New(rand.NewSource(*seed)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generator: %v\n", err)
+		os.Exit(1)
+	}
+	data, railway := &rails.SimulationData{}, &rails.RailwayData{}
+	check(desc.Apply(data, railway))
+
+	out, err := os.Create(*outFilename)
+	check(err)
+	check(rails.Save(out, rails.FormatOf(*outFilename), data, railway))
+	check(out.Close())
+
+	fmt.Printf("seed %d\n", *seed)
+	fmt.Printf("%v\n", railway)
+	fmt.Printf("Railroad description saved under: %s\n", out.Name())
+}
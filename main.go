@@ -5,13 +5,15 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"math/rand"
+	"net/http"
 	"os"
-	"sync"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 	"unicode"
 
@@ -24,110 +26,356 @@ func check(e error) {
 	}
 }
 
-var statisticsWriter *bufio.Writer // statistics file writer
-var statisticsChannel = make(chan string, 256)
-var logger *log.Logger
-
-var railway *rails.RailwayData = &rails.RailwayData{RepairChannel: make(chan rails.BrokenFella)}
-var data *rails.SimulationData = &rails.SimulationData{StatisticsChannel: &statisticsChannel}
+var railway *rails.RailwayData = &rails.RailwayData{}
+var data *rails.SimulationData = &rails.SimulationData{}
 
 var verbose = flag.Bool("v", false, "print state changes in real time")
-var generateDotFile = flag.Bool("d", false, "generate Graphviz .dot file of railroad")
-var inFilename = flag.String("i", "input", "input file containing railroad description")
-var outFilename = flag.String("o", "output", "output file for statistics saving, will be overwritten")
+var generateDotFile = flag.Bool("d", false, "generate Graphviz .dot file of railroad with train routes and exit, 'g' command writes snapshots during simulation")
+var inFilename = flag.String("i", "input", "input file containing railroad description, .json and .yaml files are read as JSON and YAML, .zip as GTFS feed")
+var convertFilename = flag.String("convert", "", "save railroad description to file in format given by its extension and exit")
+var outFilename = flag.String("o", "output", "output file for statistics saving, will be overwritten, .csv and .jsonl files get records of train stops")
 var simulateRepairs = flag.Bool("r", false, "simulate breakage and repair using RepairTeams")
 var simulateWorkers = flag.Bool("w", false, "simulate Workers and jobs dispatcher")
+var discreteEvents = flag.Bool("e", false, "run simulation on discrete-event clock, as fast as possible")
+var seed = flag.Int64("seed", 0, "seed for random sources, current time is used when not given")
+var duration = flag.Int("t", 0, "simulated hours after which simulation stops, overrides input file")
+var eventsFilename = flag.String("events", "", "output file for JSON Lines stream of all events, not written when empty")
+var logFilename = flag.String("log", "", "output file for compact log of all events, replayed with -replay, not written when empty")
+var replayFilename = flag.String("replay", "", "replay run recorded with -log instead of simulating")
+var metricsAddr = flag.String("metrics", "", "address like localhost:9100 to serve Prometheus metrics under /metrics, not served when empty")
+
+// verboseSink passes events to Sink only when on is set.
+type verboseSink struct {
+	rails.Sink
+	on *int32
+}
+
+func (s verboseSink) Consume(e rails.Event) error {
+	if atomic.LoadInt32(s.on) == 1 {
+		return s.Sink.Consume(e)
+	}
+	return nil
+}
+
+// views lists REPL commands showing state of railway, shared by simulation and replay.
+const views = "\t'c' - simulation clock,\n" +
+	"\t'p' - current trains positions,\n" +
+	"\t't' - list trains,\n" +
+	"\t'x' - list broken elements,\n" +
+	"\t'g' - save Graphviz .dot snapshot of positions and broken elements,\n" +
+	"\t'r' - list repair teams,\n" +
+	"\t'u' - list turntables,\n" +
+	"\t'n' - list normal tracks,\n" +
+	"\t's' - list stations with station tracks,\n" +
+	"\t'w' - list workers,\n"
+
+// view prints state of railway asked by REPL command c, reports false when c is not one of views.
+func view(c rune, railway *rails.RailwayData, data *rails.SimulationData) bool {
+	switch unicode.ToUpper(c) {
+	case 'C': // clock
+		fmt.Println(rails.ClockTime(data))
+	case 'P': // positions
+		for _, t := range railway.Trains {
+			fmt.Printf("%v: %v\n", t, t.At())
+		}
+		if data.SimulateRepairs {
+			for _, rt := range railway.RepairTeams {
+				fmt.Printf("%v: %v\n", rt, rt.At())
+			}
+		}
+	case 'T': // trains
+		for _, t := range railway.Trains {
+			fmt.Printf("%v, position: %v, connects:\n", t, t.At())
+			for _, s := range t.Connects {
+				fmt.Printf("\t%v\n", s)
+			}
+		}
+	case 'X': // broken elements
+		broken := railway.Broken()
+		for _, el := range broken {
+			fmt.Printf("%v\n", railway.Lookup(el))
+		}
+		if len(broken) == 0 {
+			fmt.Println("Nothing is broken")
+		}
+	case 'G': // graph snapshot
+		name := fmt.Sprintf("%s.%s.dot", *outFilename, strings.Replace(rails.ClockTime(data), ":", "-", -1))
+		snapshot, err := os.Create(name)
+		check(err)
+		check(rails.WriteDotSnapshot(snapshot, *inFilename, railway, data))
+		check(snapshot.Close())
+		fmt.Printf("Graphviz .dot snapshot saved under: %s\n", name)
+	case 'R': // repair teams
+		if data.SimulateRepairs {
+			for _, rt := range railway.RepairTeams {
+				fmt.Printf("%v, position: %v\n", rt, rt.At())
+			}
+		} else {
+			fmt.Println("Repair simulation is OFF")
+		}
+	case 'U': // turntables
+		for _, tt := range railway.Turntables {
+			fmt.Printf("%v\n", tt)
+		}
+	case 'N': // normal tracks
+		for _, nt := range railway.NormalTracks {
+			fmt.Printf("%v\n", nt)
+		}
+	case 'S': // stations
+		for _, s := range railway.Stations {
+			fmt.Printf("%v:\n", s)
+			for _, st := range s.StationTracks {
+				fmt.Printf("\t%v\n", st)
+			}
+		}
+	case 'W': // workers
+		if data.SimulateWorkers {
+			for _, w := range railway.Workers {
+				var position string
+				if w.In != nil {
+					position = fmt.Sprintf("travels by %v", w.In)
+				} else if w.At != nil {
+					if w.At == w.Home && w.Job == nil {
+						position = "is resting at home"
+					} else if w.State() == rails.Working {
+						position = fmt.Sprintf("works at %v", w.At)
+					} else {
+						position = fmt.Sprintf("waits at %v", w.At)
+					}
+				}
+				fmt.Printf("%v %s\n", w, position)
+			}
+		} else {
+			fmt.Println("Workers simulation is OFF")
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// replay lets user step through run recorded in event log and inspect railway with the same views as REPL.
+func replay(filename string) {
+	in, err := os.Open(filename)
+	check(err)
+	log, err := rails.ReadEventLog(in)
+	in.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+		os.Exit(1)
+	}
+	r, err := rails.NewReplay(log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: seed %d, %d events from %s during %v\n",
+		filename, log.Seed, len(log.Events), r.Data.ClockAt(0), r.End())
+
+	instructions := "Input command, available commands:\n" +
+		"\t'.' or empty line - next event,\n" +
+		"\t'+N' - next N events,\n" +
+		"\t'@hh:mm[:ss]' - go forward to the next moment clock shows given time,\n" +
+		"\t'@+duration' - go to simulated time since start, like @+15h14m,\n" +
+		"\t'<' - go back to start,\n" +
+		views +
+		"\t'h' - print this menu again,\n" +
+		"\t'q' - to quit replay.\n"
+	fmt.Print(instructions)
+
+	step := func(n int) {
+		for i := 0; i < n; i++ {
+			e, ok := r.Step()
+			if !ok {
+				fmt.Println("end of log")
+				return
+			}
+			fmt.Printf("%s %s\n", r.Data.ClockAt(e.Time), r.Railway.Describe(e))
+		}
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		input, err := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if err != nil && input == "" {
+			return
+		}
+
+		switch {
+		case input == "" || input == ".":
+			step(1)
+		case strings.HasPrefix(input, "+"):
+			n, err := strconv.Atoi(input[1:])
+			if err != nil || n < 1 {
+				fmt.Println("expected number of events, like +10")
+				continue
+			}
+			step(n)
+		case strings.HasPrefix(input, "@+"):
+			d, err := time.ParseDuration(input[2:])
+			if err != nil || d < 0 {
+				fmt.Println("expected duration, like @+15h14m")
+				continue
+			}
+			check(r.Seek(d))
+			fmt.Println(rails.ClockTime(r.Data))
+		case strings.HasPrefix(input, "@"):
+			if err := r.SeekClock(input[1:]); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Println(rails.ClockTime(r.Data))
+		case input == "<":
+			check(r.Rewind())
+			fmt.Println(rails.ClockTime(r.Data))
+		case view([]rune(input)[0], r.Railway, r.Data):
+		case unicode.ToUpper([]rune(input)[0]) == 'H':
+			fmt.Print(instructions)
+		case unicode.ToUpper([]rune(input)[0]) == 'Q':
+			return
+		}
+	}
+}
+
+// isSet reports whether flag with given name was given on command line, even with its default value.
+func isSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return
+}
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
 	flag.Parse()
 
+	if *replayFilename != "" {
+		replay(*replayFilename)
+		return
+	}
+
 	data.SimulateRepairs = *simulateRepairs
 	data.SimulateWorkers = *simulateWorkers
+	data.Seed = *seed
+	if !isSet("seed") {
+		data.Seed = time.Now().UnixNano()
+	}
+	if *discreteEvents {
+		data.Clock = rails.NewEventClock()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
+	format := rails.TimetableFormatOf(*outFilename)
 	out, err := os.Create(*outFilename)
 	check(err)
 	defer out.Close()
-	statisticsWriter = bufio.NewWriter(out)
-
-	go func() {
-		for {
-			_, err = statisticsWriter.WriteString(<-statisticsChannel)
-			check(err)
-			err = statisticsWriter.Flush()
-			check(err)
-		}
-	}()
+	if format == rails.TimetableText {
+		data.Statistics = out
+	}
 
 	in, err := os.Open(*inFilename)
 	check(err)
 	defer in.Close()
-	scan := bufio.NewScanner(in)
 
-	data.Parse(scan)
-	railway.Parse(scan)
+	if err := rails.Load(in, rails.FormatOf(*inFilename), data, railway); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *inFilename, err)
+		os.Exit(1)
+	}
+	if err := railway.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *inFilename, err)
+		os.Exit(1)
+	}
+	if *duration > 0 {
+		data.Duration = time.Duration(*duration) * time.Hour
+	}
 
 	fmt.Printf("%v\n", data)
+	fmt.Printf("seed %d\n", data.Seed)
 	fmt.Printf("%v\n", railway)
 
+	// CONVERT
+	if *convertFilename != "" {
+		out, err := os.Create(*convertFilename)
+		check(err)
+		check(rails.Save(out, rails.FormatOf(*convertFilename), data, railway))
+		check(out.Close())
+		fmt.Printf("Railroad description saved under: %s\n", out.Name())
+
+		os.Exit(0)
+	}
+
 	// DOT FILE
 	if *generateDotFile {
 		out, err := os.Create(*outFilename + ".dot")
 		check(err)
-		defer out.Close()
-		dotWriter := bufio.NewWriter(out)
-
-		dotWriter.WriteString(
-			fmt.Sprintf("graph %s {graph [pad=\"0.25\", nodesep=\"0.5\", ranksep=\"1.0\"];\n", *inFilename))
-
-		for i := range railway.Connections {
-			for j := 0; j <= i; j++ {
-				for _, t := range railway.Connections[i][j] {
-					dotWriter.WriteString(
-						fmt.Sprintf("\t%d -- %d", i, j))
-					switch t.(type) {
-					case *rails.StationTrack:
-						s, _ := t.(*rails.StationTrack)
-						dotWriter.WriteString(
-							fmt.Sprintf(" [label=\"%d:%s\", color=blue]\n", s.ID(), s.Name))
-					default:
-						dotWriter.WriteString(
-							fmt.Sprintf(" [label=%d] \n", t.ID()))
-					}
-				}
-				dotWriter.Flush()
-			}
-		}
-
-		dotWriter.WriteString("}\n")
-		dotWriter.Flush()
-
+		check(rails.WriteDot(out, *inFilename, railway))
+		check(out.Close())
 		fmt.Printf("Graphviz .dot file generated under: %s\n", out.Name())
 
 		os.Exit(0)
 	}
 
-	waitGroup := new(sync.WaitGroup)
-	waitGroup.Add(len(railway.Trains))
+	simulation := rails.NewSimulation(railway, data)
 
 	// VERBOSE MODE
-	if !*verbose {
-		logger = log.New(ioutil.Discard, "", 0)
-		waitGroup.Add(1)
+	var printEvents int32
+	if *verbose {
+		printEvents = 1
+	}
+	check(simulation.AddSink(verboseSink{rails.NewTextSink(os.Stdout, railway, data), &printEvents}))
+
+	// STRUCTURED TIMETABLE
+	if format != rails.TimetableText {
+		stops, err := rails.NewStopSink(out, format, railway, data)
+		check(err)
+		check(simulation.AddSink(stops))
+	}
+
+	// EVENT LOG
+	if *logFilename != "" {
+		logFile, err := os.Create(*logFilename)
+		check(err)
+		defer logFile.Close()
+		log, err := rails.NewLogSink(logFile, railway, data)
+		check(err)
+		check(simulation.AddSink(log))
+	}
+
+	// EVENTS FILE
+	if *eventsFilename != "" {
+		events, err := os.Create(*eventsFilename)
+		check(err)
+		defer events.Close()
+		check(simulation.AddSink(rails.NewJSONSink(events)))
+	}
+
+	// METRICS
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", rails.MetricsHandler(railway, data))
+		server := &http.Server{Addr: *metricsAddr, Handler: mux}
 		go func() {
-			defer waitGroup.Done()
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "-metrics: %v\n", err)
+			}
+		}()
+		defer server.Close()
+		fmt.Printf("Metrics served under: http://%s/metrics\n", *metricsAddr)
+	}
 
+	if !*verbose {
+		go func() {
 			reader := bufio.NewReader(os.Stdin)
 
 			instructions := "Input char for action, available commands:\n" +
-				"\t'c' - simulation clock,\n" +
-				"\t'p' - current trains positions,\n" +
-				"\t't' - list trains,\n" +
-				"\t'r' - list repair teams,\n" +
-				"\t'u' - list turntables,\n" +
-				"\t'n' - list normal tracks,\n" +
-				"\t's' - list stations with station tracks,\n" +
-				"\t'w' - list workers,\n" +
+				views +
+				"\t'o' - trains operational statistics,\n" +
+				"\t'b' - tracks ranked by contention,\n" +
+				"\t'j' - jobs of workers with commute times,\n" +
+				"\t'l' - stop delays against planned timetable,\n" +
+				"\t'z' - pause or resume simulation,\n" +
 				"\t'h' - print this menu again,\n" +
 				"\t'v' - enter verbose mode (YOU WILL NOT BE ABLE TO TURN IT OFF),\n" +
 				"\t'q' - to quit simulation.\n"
@@ -135,84 +383,63 @@ func main() {
 
 			for {
 				input, err := reader.ReadString('\n')
-				check(err)
+				if err != nil {
+					return
+				}
 
 				r := []rune(input)[0]
+				if view(r, railway, data) {
+					continue
+				}
 				switch unicode.ToUpper(r) {
-				case 'C': // clock
-					fmt.Println(rails.ClockTime(data))
-				case 'P': // positions
-					for _, t := range railway.Trains {
-						fmt.Printf("%v: %v\n", t, t.At())
-					}
-					for _, rt := range railway.RepairTeams {
-						fmt.Printf("%v: %v\n", rt, rt.At())
-					}
-				case 'T': // trains
-					for _, t := range railway.Trains {
-						fmt.Printf("%v, position: %v, connects:\n", t, t.At())
-						for _, s := range t.Connects {
-							fmt.Printf("\t%v\n", s)
-						}
-					}
-				case 'R': // repair teams
-					if data.SimulateRepairs {
-						for _, rt := range railway.RepairTeams {
-							fmt.Printf("%v, position: %v\n", rt, rt.At())
-						}
+				case 'O': // operational statistics
+					check(rails.WriteTrainStats(os.Stdout, railway))
+				case 'B': // bottlenecks
+					check(rails.WriteBottlenecks(os.Stdout, railway, data))
+				case 'J': // jobs
+					if data.SimulateWorkers {
+						check(rails.WriteJobStats(os.Stdout, railway, data))
 					} else {
-						fmt.Println("Repair simulation is OFF")
-					}
-				case 'U': // turntables
-					for _, tt := range railway.Turntables {
-						fmt.Printf("%v\n", tt)
-					}
-				case 'N': // normal tracks
-					for _, nt := range railway.NormalTracks {
-						fmt.Printf("%v\n", nt)
+						fmt.Println("Workers simulation is OFF")
 					}
-				case 'S': // stations
-					for _, s := range railway.Stations {
-						fmt.Printf("%v:\n", s)
-						for _, st := range s.StationTracks {
-							fmt.Printf("\t%v\n", st)
-						}
+				case 'L': // delays
+					if len(railway.Plan) > 0 {
+						check(rails.WriteDelays(os.Stdout, railway, data))
+					} else {
+						fmt.Println("Railway has no planned timetable")
 					}
-				case 'W': // workers
-					if data.SimulateWorkers {
-						for _, w := range railway.Workers {
-							var position string
-							if w.In != nil {
-								position = fmt.Sprintf("travels by %v", w.In)
-							} else if w.At != nil {
-								if w.At == w.Home && w.Job == nil {
-									position = "is resting at home"
-								} else {
-									position = fmt.Sprintf("waits at %v", w.At)
-								}
-							}
-							fmt.Printf("%v %s\n", w, position)
-						}
+				case 'Z': // pause
+					if simulation.Paused() {
+						check(simulation.Resume())
+						fmt.Printf("%s resumed\n", rails.ClockTime(data))
+					} else if err := simulation.Pause(); err != nil {
+						fmt.Println(err)
 					} else {
-						fmt.Println("Workers simulation is OFF")
+						fmt.Printf("%s paused\n", rails.ClockTime(data))
 					}
 				case 'H': // help
 					fmt.Print(instructions)
 				case 'V': // verbose
-					logger = log.New(os.Stdout, "", 0)
+					atomic.StoreInt32(&printEvents, 1)
 					return
 				case 'Q': // quit
-					os.Exit(0)
+					stop()
+					return
 				default:
 					continue
 				}
 			}
 		}()
-	} else {
-		logger = log.New(os.Stdout, "", 0)
 	}
 
-	rails.Simulate(railway, data, logger, waitGroup)
+	check(simulation.Start(ctx))
+	<-simulation.Done()
+	check(simulation.Err())
 
-	waitGroup.Wait()
+	// REPORT
+	report, err := os.Create(*outFilename + ".report")
+	check(err)
+	defer report.Close()
+	check(rails.WriteReport(report, railway, data))
+	fmt.Printf("Simulation report saved under: %s\n", report.Name())
 }
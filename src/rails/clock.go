@@ -0,0 +1,301 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"container/heap"
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Clock measures simulation time and suspends simulation goroutines.
+// All durations are simulated, one hour of simulation is time.Hour.
+type Clock interface {
+	Start(ctx context.Context)                        // start measuring time, called once by Simulate
+	Now() time.Duration                               // simulated time elapsed since Start
+	Sleep(ctx context.Context, d time.Duration) error // block for simulated duration d or until ctx is done
+	Yield(ctx context.Context) error                  // let other goroutines change simulation state before retrying
+	Pause()                                           // stop simulated time, sleepers are not woken until Resume
+	Resume()                                          // let simulated time flow again after Pause
+}
+
+// RealClock is a Clock tied to wall-clock time, one simulated hour lasts SecondsPerHour seconds.
+// A RealClock must be created using NewRealClock.
+type RealClock struct {
+	SecondsPerHour int
+	mutex          sync.Mutex
+	start          time.Time
+	paused         time.Time // moment of Pause, zero when running
+	changed        chan bool // closed and replaced on every Pause and Resume
+}
+
+// NewRealClock creates pointer to new RealClock with given hour length in seconds.
+func NewRealClock(sph int) *RealClock {
+	return &RealClock{SecondsPerHour: sph, changed: make(chan bool)}
+}
+
+func (c *RealClock) Start(ctx context.Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.start = time.Now()
+}
+
+func (c *RealClock) Now() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now()
+}
+
+// now returns simulated time, c.mutex must be held.
+func (c *RealClock) now() time.Duration {
+	end := time.Now()
+	if !c.paused.IsZero() {
+		end = c.paused
+	}
+	hours := end.Sub(c.start).Seconds() / float64(c.SecondsPerHour)
+	return time.Duration(hours * float64(time.Hour))
+}
+
+func (c *RealClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mutex.Lock()
+	wake := c.now() + d
+	c.mutex.Unlock()
+
+	for {
+		c.mutex.Lock()
+		paused, changed := !c.paused.IsZero(), c.changed
+		left := wake - c.now()
+		c.mutex.Unlock()
+
+		if paused {
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if left <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(time.Duration(left.Hours() * float64(c.SecondsPerHour) * float64(time.Second)))
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *RealClock) Yield(ctx context.Context) error {
+	c.mutex.Lock()
+	paused, changed := !c.paused.IsZero(), c.changed
+	c.mutex.Unlock()
+
+	if paused {
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	} else {
+		runtime.Gosched()
+	}
+	return ctx.Err()
+}
+
+func (c *RealClock) Pause() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.paused.IsZero() {
+		c.paused = time.Now()
+		close(c.changed)
+		c.changed = make(chan bool)
+	}
+}
+
+func (c *RealClock) Resume() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.paused.IsZero() {
+		c.start = c.start.Add(time.Since(c.paused))
+		c.paused = time.Time{}
+		close(c.changed)
+		c.changed = make(chan bool)
+	}
+}
+
+// scheduler is a Clock which runs simulation goroutines one at a time, so that runs
+// do not depend on how Go schedules goroutines. Goroutine which got its turn runs until it
+// waits on clock or at Port, then turn passes to the next one.
+type scheduler interface {
+	Clock
+	spawn(ctx context.Context, f func())            // run f in new goroutine once its turn comes
+	ready(turn chan bool)                           // close turn after goroutines already ready got their turns
+	wait(ctx context.Context, turn chan bool) error // pass turn on and wait until turn is closed
+}
+
+// EventClock is a discrete-event Clock. Simulation goroutines run one at a time in order they got ready,
+// simulated time does not flow by itself, it jumps to the earliest pending wake-up once no goroutine
+// can go on. Sleepers with equal wake-up time are woken one at a time in order of calling Sleep.
+// Yielding goroutines retry after anything changed, or after the next sleeper when nothing did.
+// An EventClock must be created using NewEventClock.
+type EventClock struct {
+	mutex    sync.Mutex
+	ctx      context.Context // set by Start, nothing is scheduled once it is done
+	now      time.Duration
+	seq      uint64
+	sleepers sleeperHeap
+	yielders []chan bool
+	runnable []chan bool // turns of goroutines ready to run, in order
+	progress bool        // goroutine other than yielder was let run since yielders were woken
+	idle     bool        // no goroutine has turn
+	paused   bool
+}
+
+// NewEventClock creates pointer to new EventClock stopped at zero.
+func NewEventClock() *EventClock {
+	return &EventClock{sleepers: make(sleeperHeap, 0), idle: true}
+}
+
+func (c *EventClock) Pause() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.paused = true
+}
+
+func (c *EventClock) Resume() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.paused = false
+	if c.idle && c.ctx != nil {
+		c.next()
+	}
+}
+
+// Start gives turn to the first goroutine spawned, all simulation goroutines should be spawned before.
+func (c *EventClock) Start(ctx context.Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ctx = ctx
+	c.next()
+}
+
+func (c *EventClock) Now() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *EventClock) Sleep(ctx context.Context, d time.Duration) error {
+	turn := make(chan bool)
+	c.mutex.Lock()
+	heap.Push(&c.sleepers, &sleeper{at: c.now + d, seq: c.seq, wake: turn})
+	c.seq++
+	c.mutex.Unlock()
+	return c.wait(ctx, turn)
+}
+
+func (c *EventClock) Yield(ctx context.Context) error {
+	turn := make(chan bool)
+	c.mutex.Lock()
+	c.yielders = append(c.yielders, turn)
+	c.mutex.Unlock()
+	return c.wait(ctx, turn)
+}
+
+func (c *EventClock) spawn(ctx context.Context, f func()) {
+	turn := make(chan bool)
+	c.mutex.Lock()
+	c.runnable = append(c.runnable, turn)
+	c.mutex.Unlock()
+	go func() {
+		// simulation goroutines return as soon as they see ctx is done, so f runs even without turn
+		select {
+		case <-turn:
+		case <-ctx.Done():
+		}
+		f()
+		c.mutex.Lock()
+		c.next()
+		c.mutex.Unlock()
+	}()
+}
+
+func (c *EventClock) ready(turn chan bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.runnable = append(c.runnable, turn)
+	c.progress = true
+}
+
+func (c *EventClock) wait(ctx context.Context, turn chan bool) error {
+	c.mutex.Lock()
+	c.next()
+	c.mutex.Unlock()
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// next gives turn to the next goroutine, c.mutex must be held by goroutine which had turn.
+// Goroutines ready to run go first, then yielding goroutines when anything changed since they yielded,
+// then time jumps to the earliest sleeper unless clock is paused. When nothing is left, clock stays idle.
+func (c *EventClock) next() {
+	c.idle = true
+	if c.ctx == nil || c.ctx.Err() != nil {
+		return
+	}
+	if len(c.runnable) == 0 && len(c.yielders) > 0 && c.progress {
+		c.runnable, c.yielders, c.progress = c.yielders, nil, false
+	}
+	if len(c.runnable) == 0 {
+		if c.paused || len(c.sleepers) == 0 {
+			return
+		}
+		next := heap.Pop(&c.sleepers).(*sleeper)
+		if next.at > c.now {
+			c.now = next.at
+		}
+		c.runnable = append(c.runnable, next.wake)
+		c.progress = true
+	}
+	turn := c.runnable[0]
+	c.runnable = c.runnable[1:]
+	c.idle = false
+	close(turn)
+}
+
+type sleeper struct {
+	at   time.Duration
+	seq  uint64
+	wake chan bool
+}
+
+// sleeperHeap implements heap.Interface ordering sleepers by wake-up time.
+type sleeperHeap []*sleeper
+
+func (h sleeperHeap) Len() int { return len(h) }
+func (h sleeperHeap) Less(i, j int) bool {
+	if h[i].at == h[j].at {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at < h[j].at
+}
+func (h sleeperHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sleeperHeap) Push(x interface{}) { *h = append(*h, x.(*sleeper)) }
+func (h *sleeperHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	s := old[n-1]
+	*h = old[:n-1]
+	return s
+}
@@ -0,0 +1,121 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventClockWakesSleepersInOrder(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	clock := NewEventClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var woken []string
+	wg := new(sync.WaitGroup)
+	for _, s := range []struct {
+		name  string
+		hours int
+	}{{"c", 3}, {"a", 1}, {"b", 2}, {"a2", 1}} {
+		s := s
+		wg.Add(1)
+		clock.spawn(ctx, func() {
+			defer wg.Done()
+			if clock.Sleep(ctx, time.Duration(s.hours)*time.Hour) != nil {
+				return
+			}
+			woken = append(woken, s.name+"@"+clock.Now().String())
+		})
+	}
+	clock.Start(ctx)
+	wg.Wait()
+
+	if got, want := strings.Join(woken, " "), "a@1h0m0s a2@1h0m0s b@2h0m0s c@3h0m0s"; got != want {
+		t.Errorf("woken %s, want %s", got, want)
+	}
+}
+
+func TestEventClockWaitsForHandOffs(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	clock := NewEventClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	port := NewPort()
+	var got []string
+	wg := new(sync.WaitGroup)
+	wg.Add(3)
+	clock.spawn(ctx, func() {
+		defer wg.Done()
+		// nobody waits yet, so try fails and sender waits for receiver
+		if port.TrySend(clock, "tried") {
+			t.Error("TrySend succeeded without receiver")
+		}
+		port.Send(ctx, clock, "sent")
+	})
+	clock.spawn(ctx, func() {
+		defer wg.Done()
+		for i := 0; i < 2; i++ {
+			v, ok := port.Receive(ctx, clock)
+			if !ok {
+				return
+			}
+			got = append(got, v.(string)+"@"+clock.Now().String())
+		}
+	})
+	clock.spawn(ctx, func() {
+		defer wg.Done()
+		if clock.Sleep(ctx, time.Hour) == nil {
+			port.Send(ctx, clock, "slept")
+		}
+	})
+	clock.Start(ctx)
+	wg.Wait()
+
+	if got, want := strings.Join(got, " "), "sent@0s slept@1h0m0s"; got != want {
+		t.Errorf("received %s, want %s", got, want)
+	}
+}
+
+func TestEventClockYieldsUntilStateChanges(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	clock := NewEventClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	port := NewPort()
+	var got string
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	clock.spawn(ctx, func() {
+		defer wg.Done()
+		// receiver comes only after an hour, retries meanwhile must not move time by themselves
+		for !port.TrySend(clock, "tried") {
+			if clock.Yield(ctx) != nil {
+				return
+			}
+		}
+	})
+	clock.spawn(ctx, func() {
+		defer wg.Done()
+		if clock.Sleep(ctx, time.Hour) != nil {
+			return
+		}
+		if v, ok := port.Receive(ctx, clock); ok {
+			got = v.(string) + "@" + clock.Now().String()
+		}
+	})
+	clock.Start(ctx)
+	wg.Wait()
+
+	if want := "tried@1h0m0s"; got != want {
+		t.Errorf("received %s, want %s", got, want)
+	}
+}
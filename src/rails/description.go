@@ -0,0 +1,608 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of railway description file.
+type Format int
+
+const (
+	TextFormat Format = iota // positional format read by Parse, see input file
+	JSONFormat
+	YAMLFormat
+	GTFSFormat // zipped GTFS static feed, only loaded by ImportGTFS
+)
+
+func (f Format) String() string {
+	switch f {
+	case TextFormat:
+		return "text"
+	case JSONFormat:
+		return "JSON"
+	case YAMLFormat:
+		return "YAML"
+	case GTFSFormat:
+		return "GTFS"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// FormatOf returns Format of file by its extension, files with unknown extension are TextFormat.
+func FormatOf(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return JSONFormat
+	case ".yaml", ".yml":
+		return YAMLFormat
+	case ".zip":
+		return GTFSFormat
+	}
+	return TextFormat
+}
+
+// Load reads railway description in given format from r into data and railway.
+func Load(r io.Reader, format Format, data *SimulationData, railway *RailwayData) error {
+	if format == TextFormat {
+		scan := NewScanner(r)
+		if err := data.Parse(scan); err != nil {
+			return err
+		}
+		return railway.Parse(scan)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if format == GTFSFormat {
+		desc, err := ImportGTFS(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return err
+		}
+		return desc.Apply(data, railway)
+	}
+	if format == YAMLFormat {
+		if b, err = yamlToJSON(b); err != nil {
+			return err
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	desc := &Description{}
+	if err := decoder.Decode(desc); err != nil {
+		return fmt.Errorf("%v description: %s", format, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return desc.Apply(data, railway)
+}
+
+// Save writes railway description of data and railway in given format to w.
+func Save(w io.Writer, format Format, data *SimulationData, railway *RailwayData) error {
+	desc := NewDescription(data, railway)
+	switch format {
+	case JSONFormat:
+		b, err := json.MarshalIndent(desc, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	case YAMLFormat:
+		b, err := marshalYAML(desc)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case TextFormat:
+		return writeText(w, desc)
+	}
+	return fmt.Errorf("saving %v format is not supported", format)
+}
+
+// Description is railway description in structure used by JSON and YAML formats.
+// Elements refer to each other by ids, which are positions in their lists, or by names.
+type Description struct {
+	SecondsPerHour int                       `json:"secondsPerHour"`
+	Clock          ClockDescription          `json:"clock"`
+	Turntables     []TurntableDescription    `json:"turntables"`
+	NormalTracks   []NormalTrackDescription  `json:"normalTracks"`
+	StationTracks  []StationTrackDescription `json:"stationTracks"`
+	RepairTeams    []RepairTeamDescription   `json:"repairTeams"`
+	Trains         []TrainDescription        `json:"trains"`
+	Workers        []WorkerDescription       `json:"workers"`
+	Failures       []FailureDescription      `json:"failures,omitempty"` // later entries override earlier ones
+	Dispatcher     *DispatcherDescription    `json:"dispatcher,omitempty"`
+	Plan           []PlanDescription         `json:"plan,omitempty"` // planned stops of trains in order of travel
+}
+
+type ClockDescription struct {
+	Hours    int `json:"hours"`
+	Minutes  int `json:"minutes"`
+	Duration int `json:"duration,omitempty"` // simulated hours to run, 0 runs forever
+}
+
+type TurntableDescription struct {
+	ID         int    `json:"id"`
+	Time       int    `json:"time"` // minutes needed to rotate train
+	RepairTime int    `json:"repairTime"`
+	Name       string `json:"name,omitempty"` // optional, can be used instead of id in references
+}
+
+type NormalTrackDescription struct {
+	ID         int `json:"id"`
+	Len        int `json:"len"`   // length in km
+	Limit      int `json:"limit"` // speed limit in km/h
+	RepairTime int `json:"repairTime"`
+	From       Ref `json:"from"` // turntable
+	To         Ref `json:"to"`   // turntable
+}
+
+type StationTrackDescription struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"` // station tracks with equal name and turntables form one station
+	Time       int    `json:"time"` // minimum minutes of stop
+	RepairTime int    `json:"repairTime"`
+	From       Ref    `json:"from"`           // turntable
+	To         Ref    `json:"to"`             // turntable
+	Role       string `json:"role,omitempty"` // passenger, depot or freight, default depends on repair teams
+}
+
+type RepairTeamDescription struct {
+	ID      int `json:"id"`
+	Speed   int `json:"speed"`
+	Station Ref `json:"stationId"` // depot station track, or first track of station
+}
+
+type TrainDescription struct {
+	ID         int    `json:"id"`
+	Speed      int    `json:"speed"`
+	Capacity   int    `json:"capacity"`
+	RepairTime int    `json:"repairTime"`
+	Name       string `json:"name"`
+	Route      []Ref  `json:"route"` // turntables
+}
+
+type WorkerDescription struct {
+	ID      int `json:"id"`
+	Station Ref `json:"stationId"` // station track or station
+}
+
+type FailureDescription struct {
+	Element    string    `json:"element"`    // turntable, normalTrack, stationTrack or train
+	ID         Ref       `json:"id"`         // element id or name, * for default of all elements
+	Model      string    `json:"model"`      // perUse, mtbf or weibull
+	Parameters []float64 `json:"parameters"` // see FAILURE_MODELS_LAYOUT
+}
+
+type DispatcherDescription struct {
+	Policy string              `json:"policy"`           // random, demand or schedule
+	Timing *TimingDescription  `json:"timing,omitempty"` // random and demand policies, default when empty
+	Demand []DemandDescription `json:"demand,omitempty"` // demand policy
+	Jobs   []JobDescription    `json:"jobs,omitempty"`   // schedule policy
+}
+
+type TimingDescription struct {
+	MinWait     int     `json:"minWait"`     // hours
+	WaitSpan    int     `json:"waitSpan"`    // hours
+	MinWorkers  int     `json:"minWorkers"`  // workers
+	WorkersSpan float64 `json:"workersSpan"` // fraction of all workers
+	MinWork     int     `json:"minWork"`     // minutes
+	WorkSpan    int     `json:"workSpan"`    // minutes
+}
+
+type DemandDescription struct {
+	Station Ref     `json:"stationId"` // station track or station
+	Weight  float64 `json:"weight"`
+}
+
+type JobDescription struct {
+	Hours    int   `json:"hours"`
+	Minutes  int   `json:"minutes"`
+	Duration int   `json:"duration"`  // minutes of work
+	Station  Ref   `json:"stationId"` // station track or station
+	Workers  []int `json:"workers"`
+}
+
+type PlanDescription struct {
+	Train     Ref    `json:"train"`     // train id or name
+	Station   Ref    `json:"stationId"` // station track or station
+	Arrival   string `json:"arrival"`   // time of day as hh:mm[:ss]
+	Departure string `json:"departure"` // time of day as hh:mm[:ss]
+}
+
+// model returns FailureModel described by f.
+func (f FailureDescription) model() (FailureModel, error) {
+	return NewFailureModel(f.Model, f.Parameters)
+}
+
+// Ref refers to railway element by id, written as number, or by name, written as string.
+type Ref string
+
+// IDRef returns Ref to element with given id.
+func IDRef(id int) Ref { return Ref(strconv.Itoa(id)) }
+
+// turntableRef returns Ref to tt by name when it has one.
+func turntableRef(tt *Turntable) Ref {
+	if tt.Name != "" {
+		return Ref(tt.Name)
+	}
+	return IDRef(tt.id)
+}
+
+// stationTrackRefTo returns Ref to st by name of its station, when the name resolves back to st.
+func (r *RailwayData) stationTrackRefTo(st *StationTrack) Ref {
+	if i, err := r.stationTrackRef(st.Name); err == nil && r.StationTracks[i] == st {
+		return Ref(st.Name)
+	}
+	return IDRef(st.id)
+}
+
+// trainRefTo returns Ref to t by its name, when the name resolves back to t.
+func (r *RailwayData) trainRefTo(t *Train) Ref {
+	if i, err := r.trainRef(t.Name); err == nil && r.Trains[i] == t {
+		return Ref(t.Name)
+	}
+	return IDRef(t.id)
+}
+
+func (r Ref) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.Atoi(string(r)); err == nil {
+		return []byte(r), nil
+	}
+	return json.Marshal(string(r))
+}
+
+func (r *Ref) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*r = Ref(s)
+		return nil
+	}
+	var id int
+	if err := json.Unmarshal(b, &id); err != nil {
+		return fmt.Errorf("expected id or name, found %s", b)
+	}
+	*r = IDRef(id)
+	return nil
+}
+
+// NewDescription creates pointer to new Description of data and railway.
+func NewDescription(data *SimulationData, railway *RailwayData) *Description {
+	desc := &Description{
+		SecondsPerHour: data.SecondsPerHour,
+		Clock:          ClockDescription{data.clock.h, data.clock.m, int(data.Duration / time.Hour)},
+		Turntables:     make([]TurntableDescription, 0),
+		NormalTracks:   make([]NormalTrackDescription, 0),
+		StationTracks:  make([]StationTrackDescription, 0),
+		RepairTeams:    make([]RepairTeamDescription, 0),
+		Trains:         make([]TrainDescription, 0),
+		Workers:        make([]WorkerDescription, 0)}
+
+	for _, tt := range railway.Turntables {
+		desc.Turntables = append(desc.Turntables, TurntableDescription{tt.id, tt.turnTime, tt.repairTime, tt.Name})
+	}
+	for _, nt := range railway.NormalTracks {
+		desc.NormalTracks = append(desc.NormalTracks,
+			NormalTrackDescription{nt.id, nt.len, nt.limit, nt.repairTime, turntableRef(nt.first), turntableRef(nt.second)})
+	}
+	for _, st := range railway.StationTracks {
+		role := ""
+		if s := st.station; s != nil && s.Role != railway.defaultRole(s) {
+			role = s.Role.String()
+		}
+		desc.StationTracks = append(desc.StationTracks, StationTrackDescription{
+			st.id, st.Name, st.stopTime, st.repairTime, turntableRef(st.first), turntableRef(st.second), role})
+	}
+	for _, rt := range railway.RepairTeams {
+		desc.RepairTeams = append(desc.RepairTeams, RepairTeamDescription{rt.id, rt.speed, railway.stationTrackRefTo(rt.station)})
+	}
+	for _, t := range railway.Trains {
+		route := make([]Ref, len(t.route))
+		for i, tt := range t.route {
+			route[i] = turntableRef(tt)
+		}
+		desc.Trains = append(desc.Trains,
+			TrainDescription{t.id, t.speed, t.capacity, t.repairTime, t.Name, route})
+	}
+	for _, w := range railway.Workers {
+		desc.Workers = append(desc.Workers, WorkerDescription{w.id, railway.stationTrackRefTo(w.Home.StationTracks[0])})
+	}
+	desc.Failures = railway.failureDescriptions()
+	desc.Dispatcher = railway.dispatcherDescription()
+	for _, p := range railway.Plan {
+		desc.Plan = append(desc.Plan, PlanDescription{railway.trainRefTo(p.Train),
+			railway.stationTrackRefTo(p.Station.StationTracks[0]), formatTimeOfDay(p.Arrival), formatTimeOfDay(p.Departure)})
+	}
+	return desc
+}
+
+// Apply creates railway elements described by desc in railway and sets up data.
+// References to elements which do not exist are reported as *ParseError.
+func (desc *Description) Apply(data *SimulationData, railway *RailwayData) error {
+	d := desc
+	if d.SecondsPerHour <= 0 {
+		return &ParseError{Section: "secondsPerHour", Err: fmt.Errorf("%d must be positive", d.SecondsPerHour)}
+	}
+	if d.Clock.Duration < 0 {
+		return &ParseError{Section: "clock", Err: fmt.Errorf("field duration: %d must not be negative", d.Clock.Duration)}
+	}
+	data.SecondsPerHour = d.SecondsPerHour
+	data.clock.h = d.Clock.Hours
+	data.clock.m = d.Clock.Minutes
+	data.Duration = time.Duration(d.Clock.Duration) * time.Hour
+
+	r := railway
+	r.rts, r.ts, r.tts = len(d.RepairTeams), len(d.Trains), len(d.Turntables)
+	r.nts, r.sts, r.ws = len(d.NormalTracks), len(d.StationTracks), len(d.Workers)
+	r.allocate()
+
+	// ref resolves reference in field of i-th element of section
+	ref := func(section string, i int, field string, v Ref, resolve func(string) (int, error)) (int, error) {
+		index, err := resolve(string(v))
+		if err != nil {
+			return 0, &ParseError{Section: fmt.Sprintf("%s[%d]", section, i), Err: fmt.Errorf("field %s: %v", field, err)}
+		}
+		return index, nil
+	}
+
+	for i, tt := range d.Turntables {
+		if tt.Name != "" {
+			if err := r.checkTurntableName(tt.Name, i); err != nil {
+				return &ParseError{Section: fmt.Sprintf("turntables[%d]", i), Err: fmt.Errorf("field name: %v", err)}
+			}
+		}
+		r.Turntables[i] = NewTurntable(tt.ID, tt.Time, tt.RepairTime, tt.Name)
+	}
+	for i, nt := range d.NormalTracks {
+		fst, err := ref("normalTracks", i, "from", nt.From, r.turntableRef)
+		if err != nil {
+			return err
+		}
+		snd, err := ref("normalTracks", i, "to", nt.To, r.turntableRef)
+		if err != nil {
+			return err
+		}
+		r.NormalTracks[i] = NewNormalTrack(nt.ID, nt.Len, nt.Limit, nt.RepairTime, r.Turntables[fst], r.Turntables[snd])
+		r.connect(r.NormalTracks[i], fst, snd)
+	}
+	roles := make(map[[2]*Turntable]Role)
+	for i, st := range d.StationTracks {
+		fst, err := ref("stationTracks", i, "from", st.From, r.turntableRef)
+		if err != nil {
+			return err
+		}
+		snd, err := ref("stationTracks", i, "to", st.To, r.turntableRef)
+		if err != nil {
+			return err
+		}
+		r.StationTracks[i] = NewStationTrack(st.ID, st.Name, st.Time, st.RepairTime, r.Turntables[fst], r.Turntables[snd])
+		r.connect(r.StationTracks[i], fst, snd)
+		if st.Role != "" {
+			role, err := ParseRole(st.Role)
+			if err == nil {
+				err = declareRole(roles, r.StationTracks[i], role)
+			}
+			if err != nil {
+				return &ParseError{Section: fmt.Sprintf("stationTracks[%d]", i), Err: fmt.Errorf("field role: %v", err)}
+			}
+		}
+	}
+	r.createStations()
+	for i, rt := range d.RepairTeams {
+		station, err := ref("repairTeams", i, "stationId", rt.Station, r.stationTrackRef)
+		if err != nil {
+			return err
+		}
+		r.RepairTeams[i] = NewRepairTeam(rt.ID, rt.Speed, r.StationTracks[station])
+	}
+	r.assignRoles(roles)
+	for i, t := range d.Trains {
+		if len(t.Route) == 0 {
+			return &ParseError{Section: fmt.Sprintf("trains[%d]", i), Err: fmt.Errorf("field route: route must not be empty")}
+		}
+		if t.Capacity < 0 {
+			return &ParseError{Section: fmt.Sprintf("trains[%d]", i), Err: fmt.Errorf("field capacity: %d must not be negative", t.Capacity)}
+		}
+		route := Route{}
+		for _, v := range t.Route {
+			index, err := ref("trains", i, "route", v, r.turntableRef)
+			if err != nil {
+				return err
+			}
+			route = append(route, r.Turntables[index])
+		}
+		r.addTrain(i, NewTrain(t.ID, t.Speed, t.Capacity, t.RepairTime, t.Name, route))
+	}
+	for i, w := range d.Workers {
+		home, err := ref("workers", i, "stationId", w.Station, r.stationTrackRef)
+		if err != nil {
+			return err
+		}
+		r.addWorker(i, w.ID, home)
+	}
+	for i, f := range d.Failures {
+		section := fmt.Sprintf("failures[%d]", i)
+		kind, err := parseFailureKind(f.Element)
+		if err != nil {
+			return &ParseError{Section: section, Err: fmt.Errorf("field element: %v", err)}
+		}
+		model, err := f.model()
+		if err != nil {
+			return &ParseError{Section: section, Err: fmt.Errorf("field model: %v", err)}
+		}
+		if err := r.SetFailure(kind, string(f.ID), model); err != nil {
+			return &ParseError{Section: section, Err: fmt.Errorf("field id: %v", err)}
+		}
+	}
+	if d.Dispatcher != nil {
+		if err := r.applyDispatcher(d.Dispatcher); err != nil {
+			return err
+		}
+	}
+	for i, p := range d.Plan {
+		train, err := ref("plan", i, "train", p.Train, r.trainRef)
+		if err != nil {
+			return err
+		}
+		station, err := ref("plan", i, "stationId", p.Station, r.stationTrackRef)
+		if err != nil {
+			return err
+		}
+		stop, err := newPlannedStop(r.Trains[train], r.StationTracks[station].Station(), p.Arrival, p.Departure)
+		if err != nil {
+			return &ParseError{Section: fmt.Sprintf("plan[%d]", i), Err: err}
+		}
+		r.Plan = append(r.Plan, stop)
+	}
+	return nil
+}
+
+// applyDispatcher sets up Dispatcher of railway described by desc.
+func (r *RailwayData) applyDispatcher(desc *DispatcherDescription) error {
+	errorf := func(section, format string, args ...interface{}) error {
+		return &ParseError{Section: section, Err: fmt.Errorf(format, args...)}
+	}
+	dispatcher, err := newDispatcher(desc.Policy)
+	if err != nil {
+		return errorf("dispatcher", "field policy: %v", err)
+	}
+	if t := desc.Timing; t != nil {
+		d := timing(dispatcher)
+		if d == nil {
+			return errorf("dispatcher", "field timing: %s policy has no timing", desc.Policy)
+		}
+		*d = RandomDispatcher{t.MinWait, t.WaitSpan, t.MinWorkers, t.WorkersSpan, t.MinWork, t.WorkSpan}
+		if err := d.check(); err != nil {
+			return errorf("dispatcher", "field timing: %v", err)
+		}
+	}
+
+	if len(desc.Demand) > 0 {
+		d, ok := dispatcher.(*DemandDispatcher)
+		if !ok {
+			return errorf("dispatcher", "field demand: can be given only for demand policy")
+		}
+		for i, demand := range desc.Demand {
+			station, err := r.stationTrackRef(string(demand.Station))
+			if err != nil {
+				return errorf(fmt.Sprintf("dispatcher.demand[%d]", i), "field stationId: %v", err)
+			}
+			if !(demand.Weight >= 0) || math.IsInf(demand.Weight, 0) {
+				return errorf(fmt.Sprintf("dispatcher.demand[%d]", i), "field weight: %v must not be negative", demand.Weight)
+			}
+			d.Demand = append(d.Demand, Demand{r.StationTracks[station].Station(), demand.Weight})
+		}
+	}
+
+	if len(desc.Jobs) > 0 {
+		d, ok := dispatcher.(*ScheduleDispatcher)
+		if !ok {
+			return errorf("dispatcher", "field jobs: can be given only for schedule policy")
+		}
+		jobs := make([]ScheduledJob, 0)
+		for i, j := range desc.Jobs {
+			section := fmt.Sprintf("dispatcher.jobs[%d]", i)
+			station, err := r.stationTrackRef(string(j.Station))
+			if err != nil {
+				return errorf(section, "field stationId: %v", err)
+			}
+			workers := make(WorkerSlice, 0)
+			for _, id := range j.Workers {
+				w, err := r.workerRef(strconv.Itoa(id))
+				if err != nil {
+					return errorf(section, "field workers: %v", err)
+				}
+				workers = append(workers, r.Workers[w])
+			}
+			if j.Hours < 0 || j.Minutes < 0 || j.Duration < 0 {
+				return errorf(section, "time must not be negative")
+			}
+			job, err := newScheduledJob(j.Hours, j.Minutes, j.Duration, r.StationTracks[station].Station(), workers)
+			if err != nil {
+				return errorf(section, "%v", err)
+			}
+			jobs = append(jobs, job)
+		}
+		*d = *NewScheduleDispatcher(jobs)
+	}
+
+	r.Dispatcher = dispatcher
+	return nil
+}
+
+// dispatcherDescription describes Dispatcher of railway, nil when it is not set or can't be described.
+func (r *RailwayData) dispatcherDescription() *DispatcherDescription {
+	name := dispatcherName(r.Dispatcher)
+	if r.Dispatcher == nil || name == "" {
+		return nil
+	}
+	desc := &DispatcherDescription{Policy: name}
+	if d := timing(r.Dispatcher); d != nil && *d != *DefaultDispatcher() {
+		desc.Timing = &TimingDescription{d.MinWait, d.WaitSpan, d.MinWorkers, d.WorkersSpan, d.MinWork, d.WorkSpan}
+	}
+	switch d := r.Dispatcher.(type) {
+	case *DemandDispatcher:
+		for _, demand := range d.Demand {
+			desc.Demand = append(desc.Demand,
+				DemandDescription{r.stationTrackRefTo(demand.Station.StationTracks[0]), demand.Weight})
+		}
+	case *ScheduleDispatcher:
+		for _, job := range d.Jobs {
+			workers := make([]int, len(job.Workers))
+			for i, w := range job.Workers {
+				workers[i] = w.id
+			}
+			desc.Jobs = append(desc.Jobs, JobDescription{int(job.At / time.Hour), int(job.At % time.Hour / time.Minute),
+				job.Duration, r.stationTrackRefTo(job.Workplace.StationTracks[0]), workers})
+		}
+	}
+	return desc
+}
+
+// failureDescriptions describes failure models of railway differing from defaults,
+// defaults of element kinds set in description come first.
+func (r *RailwayData) failureDescriptions() []FailureDescription {
+	var descs []FailureDescription
+	add := func(kind ElementKind, ref Ref, m FailureModel) {
+		descs = append(descs, FailureDescription{failureKind(kind), ref, m.Name(), m.Parameters()})
+	}
+	for _, kind := range failureKinds {
+		if m, ok := r.Failures[kind]; ok {
+			add(kind, "*", m)
+		}
+	}
+	for _, tt := range r.Turntables {
+		if m := tt.Failure(); m != r.defaultFailure(TurntableElement) {
+			add(TurntableElement, turntableRef(tt), m)
+		}
+	}
+	for _, nt := range r.NormalTracks {
+		if m := nt.Failure(); m != r.defaultFailure(NormalTrackElement) {
+			add(NormalTrackElement, IDRef(nt.id), m)
+		}
+	}
+	for _, st := range r.StationTracks {
+		if m := st.Failure(); m != r.defaultFailure(StationTrackElement) {
+			add(StationTrackElement, IDRef(st.id), m)
+		}
+	}
+	for _, t := range r.Trains {
+		if m := t.Failure(); m != r.defaultFailure(TrainElement) {
+			add(TrainElement, IDRef(t.id), m)
+		}
+	}
+	return descs
+}
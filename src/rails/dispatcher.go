@@ -0,0 +1,270 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dispatcher decides when workers are sent to work, where and for how long.
+type Dispatcher interface {
+	// Next waits until next job is due and returns it, nil when no job can be started then.
+	// Error is returned when ctx is done first.
+	Next(ctx context.Context, railway *RailwayData, data *SimulationData, random *rand.Rand) (*Job, error)
+}
+
+// RandomDispatcher posts jobs every couple of hours, for random group of workers
+// at random station which is not a depot.
+type RandomDispatcher struct {
+	MinWait     int     // minimum hours between jobs
+	WaitSpan    int     // hours added at random to MinWait
+	MinWorkers  int     // minimum number of workers of job
+	WorkersSpan float64 // fraction of all workers added at random to MinWorkers
+	MinWork     int     // minimum minutes of work
+	WorkSpan    int     // minutes added at random to MinWork
+}
+
+// DefaultDispatcher returns RandomDispatcher used when railway description sets none.
+func DefaultDispatcher() *RandomDispatcher {
+	return &RandomDispatcher{
+		MinWait:     3,
+		WaitSpan:    2,
+		MinWorkers:  2,
+		WorkersSpan: 0.25,
+		MinWork:     30,
+		WorkSpan:    60}
+}
+
+// check reports timing which can't be used to post jobs.
+func (d *RandomDispatcher) check() error {
+	switch {
+	case d.MinWait < 0 || d.WaitSpan < 0 || d.MinWork < 0 || d.WorkSpan < 0:
+		return fmt.Errorf("times must not be negative")
+	case d.MinWait+d.WaitSpan == 0:
+		return fmt.Errorf("minWait or waitSpan must be positive, jobs would be posted without time passing")
+	case d.MinWorkers < 1:
+		return fmt.Errorf("minWorkers %d must be positive", d.MinWorkers)
+	case !(d.WorkersSpan >= 0 && d.WorkersSpan <= 1):
+		return fmt.Errorf("workersSpan %v must be between 0 and 1", d.WorkersSpan)
+	}
+	return nil
+}
+
+func (d *RandomDispatcher) Next(ctx context.Context, railway *RailwayData, data *SimulationData, random *rand.Rand) (*Job, error) {
+	return d.next(ctx, railway, data, random, func() *Station {
+		workplaces := railway.workplaces()
+		return workplaces[random.Intn(len(workplaces))]
+	})
+}
+
+// next waits random time and posts job at workplace chosen by choose, when chosen workers are available.
+func (d *RandomDispatcher) next(ctx context.Context, railway *RailwayData, data *SimulationData,
+	random *rand.Rand, choose func() *Station) (*Job, error) {
+	// wait couple hours between jobs
+	duration := d.MinWait + random.Intn(d.WaitSpan+1)
+	if err := data.Clock.Sleep(ctx, time.Duration(duration)*time.Hour); err != nil {
+		return nil, err
+	}
+	// choose number of workers for the job
+	n := d.MinWorkers
+	if span := int(d.WorkersSpan * float64(len(railway.Workers))); span > 0 {
+		n += random.Intn(span)
+	}
+	n = int(math.Min(float64(n), float64(len(railway.Workers))))
+	subset := railway.Workers.Subset(random, n)
+	// only if all workers chosen ara available
+	if !subset.available() {
+		return nil, nil
+	}
+	workplace := choose()
+	// work for some random time
+	workTime := d.MinWork + random.Intn(d.WorkSpan+1)
+	return NewJob(workTime, workplace, subset), nil
+}
+
+// DemandDispatcher posts jobs like RandomDispatcher, but chooses workplaces
+// with probability proportional to their demand for workers.
+type DemandDispatcher struct {
+	RandomDispatcher
+	Demand []Demand
+}
+
+// Demand is a weight of Station in choosing workplaces.
+type Demand struct {
+	Station *Station
+	Weight  float64
+}
+
+// NewDemandDispatcher creates pointer to new DemandDispatcher with timing of DefaultDispatcher.
+func NewDemandDispatcher() *DemandDispatcher {
+	return &DemandDispatcher{RandomDispatcher: *DefaultDispatcher(), Demand: make([]Demand, 0)}
+}
+
+func (d *DemandDispatcher) Next(ctx context.Context, railway *RailwayData, data *SimulationData, random *rand.Rand) (*Job, error) {
+	return d.next(ctx, railway, data, random, func() *Station {
+		x := random.Float64() * d.totalWeight()
+		for _, demand := range d.Demand {
+			if x < demand.Weight {
+				return demand.Station
+			}
+			x -= demand.Weight
+		}
+		return d.Demand[len(d.Demand)-1].Station
+	})
+}
+
+func (d *DemandDispatcher) totalWeight() (total float64) {
+	for _, demand := range d.Demand {
+		total += demand.Weight
+	}
+	return
+}
+
+// ScheduleDispatcher posts fixed jobs every day at given simulation clock times.
+// Jobs whose workers are busy at that time are skipped.
+type ScheduleDispatcher struct {
+	Jobs []ScheduledJob
+	next int // index of next job, counting jobs of previous days
+}
+
+// ScheduledJob is a job posted every day At given time of day.
+type ScheduledJob struct {
+	At        time.Duration // time of day on simulation clock
+	Duration  int           // minutes of work
+	Workplace *Station
+	Workers   WorkerSlice
+}
+
+// newScheduledJob creates job posted every day at h:m, reporting jobs which can't be done.
+func newScheduledJob(h, m, duration int, workplace *Station, workers WorkerSlice) (ScheduledJob, error) {
+	if h > 23 || m > 59 {
+		return ScheduledJob{}, fmt.Errorf("%02d:%02d is not a time of day", h, m)
+	}
+	seen := make(map[*Worker]bool)
+	for _, w := range workers {
+		if seen[w] {
+			return ScheduledJob{}, fmt.Errorf("%v is given twice", w)
+		}
+		seen[w] = true
+	}
+	if len(workers) == 0 {
+		return ScheduledJob{}, fmt.Errorf("job must have workers")
+	}
+	at := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+	return ScheduledJob{at, duration, workplace, workers}, nil
+}
+
+// NewScheduleDispatcher creates pointer to new ScheduleDispatcher posting jobs in order of time of day.
+func NewScheduleDispatcher(jobs []ScheduledJob) *ScheduleDispatcher {
+	d := &ScheduleDispatcher{Jobs: append([]ScheduledJob{}, jobs...)}
+	sort.SliceStable(d.Jobs, func(i, j int) bool { return d.Jobs[i].At < d.Jobs[j].At })
+	return d
+}
+
+func (d *ScheduleDispatcher) Next(ctx context.Context, railway *RailwayData, data *SimulationData, random *rand.Rand) (*Job, error) {
+	if len(d.Jobs) == 0 {
+		// nobody sends to new port, wait until simulation stops
+		await(ctx, data.Clock, NewPort())
+		return nil, ctx.Err()
+	}
+	start := data.start()
+	for {
+		job := d.Jobs[d.next%len(d.Jobs)]
+		at := time.Duration(d.next/len(d.Jobs))*24*time.Hour + job.At - start
+		d.next++
+		now := data.Clock.Now()
+		if at < now {
+			// jobs earlier than simulation start are posted next day
+			continue
+		}
+		if err := data.Clock.Sleep(ctx, at-now); err != nil {
+			return nil, err
+		}
+		if !job.Workers.available() {
+			return nil, nil
+		}
+		return NewJob(job.Duration, job.Workplace, job.Workers), nil
+	}
+}
+
+// dispatch posts jobs of railway Dispatcher to workers until ctx is done.
+func dispatch(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	dispatcher := railway.Dispatcher
+	if dispatcher == nil {
+		dispatcher = DefaultDispatcher()
+	}
+	random := data.NewRand("Dispatcher", 0)
+	for {
+		job, err := dispatcher.Next(ctx, railway, data, random)
+		if err != nil {
+			return
+		}
+		if job == nil {
+			continue
+		}
+		railway.post(job, data.Clock.Now())
+		for _, w := range job.workers {
+			if !w.Work.Send(ctx, data.Clock, job) {
+				return
+			}
+		}
+	}
+}
+
+// workplaces returns stations where workers can be sent to work, all but depots.
+func (r *RailwayData) workplaces() StationSlice {
+	workplaces := make(StationSlice, 0)
+	for _, s := range r.Stations {
+		if s.Workplace() {
+			workplaces = append(workplaces, s)
+		}
+	}
+	return workplaces
+}
+
+// dispatcherName returns name of dispatcher policy as in railway description, empty for unknown policies.
+func dispatcherName(d Dispatcher) string {
+	switch d.(type) {
+	case *RandomDispatcher:
+		return "random"
+	case *DemandDispatcher:
+		return "demand"
+	case *ScheduleDispatcher:
+		return "schedule"
+	}
+	return ""
+}
+
+// newDispatcher creates dispatcher of policy named as in railway description.
+func newDispatcher(policy string) (Dispatcher, error) {
+	switch strings.ToLower(policy) {
+	case "random":
+		return DefaultDispatcher(), nil
+	case "demand":
+		return NewDemandDispatcher(), nil
+	case "schedule":
+		return NewScheduleDispatcher(nil), nil
+	}
+	return nil, fmt.Errorf("unknown dispatcher policy %q, expected random, demand or schedule", policy)
+}
+
+// timing returns RandomDispatcher with timing of d, nil when d does not post jobs at random times.
+func timing(d Dispatcher) *RandomDispatcher {
+	switch d := d.(type) {
+	case *RandomDispatcher:
+		return d
+	case *DemandDispatcher:
+		return &d.RandomDispatcher
+	}
+	return nil
+}
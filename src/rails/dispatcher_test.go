@@ -0,0 +1,32 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRandomDispatcherCheck(t *testing.T) {
+	for _, c := range []struct {
+		d    RandomDispatcher
+		want string // part of error, "" when timing is valid
+	}{
+		{*DefaultDispatcher(), ""},
+		{RandomDispatcher{0, 1, 2, 0.25, 30, 60}, ""},
+		{RandomDispatcher{1, 0, 2, 0.25, 0, 0}, ""},
+		{RandomDispatcher{0, 0, 2, 0.25, 30, 60}, "minWait or waitSpan must be positive"},
+		{RandomDispatcher{-1, 2, 2, 0.25, 30, 60}, "must not be negative"},
+		{RandomDispatcher{3, 2, 0, 0.25, 30, 60}, "minWorkers 0 must be positive"},
+		{RandomDispatcher{3, 2, 2, 1.5, 30, 60}, "workersSpan 1.5 must be between 0 and 1"},
+	} {
+		err := c.d.check()
+		switch {
+		case c.want == "" && err != nil:
+			t.Errorf("%+v: unexpected error %v", c.d, err)
+		case c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)):
+			t.Errorf("%+v: error %v, want %q", c.d, err, c.want)
+		}
+	}
+}
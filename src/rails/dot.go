@@ -0,0 +1,156 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// routeColors are Graphviz colors of train route overlays, used in turn, red is left for broken elements.
+var routeColors = []string{"blue", "darkgreen", "orange", "purple", "brown", "deeppink", "cyan4", "goldenrod", "navy", "olivedrab"}
+
+// WriteDot writes Graphviz graph of railway named name to w. Turntables are nodes joined by normal tracks
+// labelled with length and speed limit, station tracks of every station are clustered between its turntables,
+// depots are labelled with their repair teams and route of every train is drawn over tracks in its own color.
+func WriteDot(w io.Writer, name string, railway *RailwayData) error {
+	b := bufio.NewWriter(w)
+	writeDot(b, name, railway, nil)
+	return b.Flush()
+}
+
+// WriteDotSnapshot writes the same graph as WriteDot together with current positions of trains and
+// repair teams and broken elements painted red, it can be called while simulation runs.
+func WriteDotSnapshot(w io.Writer, name string, railway *RailwayData, data *SimulationData) error {
+	b := bufio.NewWriter(w)
+	writeDot(b, name, railway, data)
+	return b.Flush()
+}
+
+// writeDot writes graph of railway, with live state when data is not nil.
+func writeDot(b *bufio.Writer, name string, railway *RailwayData, data *SimulationData) {
+	// occupants of every track, only in snapshot
+	occupants := make(map[Track][]string)
+	if data != nil {
+		for _, t := range railway.Trains {
+			if at := t.At(); at != nil {
+				occupants[at] = append(occupants[at], t.String())
+			}
+		}
+		if data.SimulateRepairs {
+			for _, rt := range railway.RepairTeams {
+				if at := rt.At(); at != nil {
+					occupants[at] = append(occupants[at], rt.String())
+				}
+			}
+		}
+	}
+	teams := make(map[*Station][]string)
+	for _, rt := range railway.RepairTeams {
+		if st := rt.Station(); st != nil && st.station != nil {
+			teams[st.station] = append(teams[st.station], rt.String())
+		}
+	}
+
+	fmt.Fprintf(b, "graph %s {\n", quote(name))
+	fmt.Fprintf(b, "\tgraph [pad=\"0.25\", nodesep=\"0.5\", ranksep=\"1.0\"")
+	if data != nil {
+		fmt.Fprintf(b, ", label=%s, labelloc=t", quote("snapshot at "+ClockTime(data)))
+	}
+	fmt.Fprintf(b, "];\n\tnode [shape=circle];\n")
+
+	for _, tt := range railway.Turntables {
+		label := []string{fmt.Sprint(tt.id)}
+		if tt.Name != "" {
+			label = append(label, tt.Name)
+		}
+		fmt.Fprintf(b, "\ttt%d [label=%s%s];\n", tt.id, quote(dotLines(label, occupants[tt])), dotState(data, &tt.down, occupants[tt], true))
+	}
+
+	for _, s := range railway.Stations {
+		label, style := s.String(), "rounded"
+		if s.Role == Depot {
+			label, style = label+" (depot)", "\"rounded,filled\", fillcolor=lightgrey"
+			if len(teams[s]) > 0 {
+				label += "\n" + strings.Join(teams[s], ", ")
+			}
+		}
+		fmt.Fprintf(b, "\tsubgraph cluster_station%d {\n\t\tgraph [label=%s, style=%s];\n", s.id, quote(label), style)
+		for _, st := range s.StationTracks {
+			writeDotStationTrack(b, "\t\t", st, data, occupants[st])
+		}
+		fmt.Fprintf(b, "\t}\n")
+	}
+	for _, st := range railway.StationTracks {
+		if st.station == nil {
+			writeDotStationTrack(b, "\t", st, data, occupants[st])
+		}
+	}
+	for _, st := range railway.StationTracks {
+		fmt.Fprintf(b, "\ttt%d -- st%d;\n\tst%d -- tt%d;\n", st.first.id, st.id, st.id, st.second.id)
+	}
+
+	for _, nt := range railway.NormalTracks {
+		label := []string{fmt.Sprint(nt.id), fmt.Sprintf("%d km, %d km/h", nt.len, nt.limit)}
+		fmt.Fprintf(b, "\ttt%d -- tt%d [label=%s%s];\n",
+			nt.first.id, nt.second.id, quote(dotLines(label, occupants[nt])), dotState(data, &nt.down, occupants[nt], false))
+	}
+
+	// route overlays do not move nodes, they only follow tracks laid out above
+	for i, t := range railway.Trains {
+		color := routeColors[i%len(routeColors)]
+		style := "bold"
+		if data != nil && t.down.Value() != 0 {
+			style = "\"bold,dashed\""
+		}
+		for j, tt := range t.route {
+			next := t.route[(j+1)%len(t.route)]
+			if tt == next {
+				continue
+			}
+			fmt.Fprintf(b, "\ttt%d -- tt%d [color=%s, style=%s, dir=forward, arrowsize=0.6, constraint=false, tooltip=%s];\n",
+				tt.id, next.id, color, style, quote(t.String()))
+		}
+	}
+
+	fmt.Fprintf(b, "\tsubgraph cluster_routes {\n\t\tlabel=\"routes\";\n\t\tnode [shape=plaintext];\n")
+	for i, t := range railway.Trains {
+		label := t.String()
+		if data != nil && t.down.Value() != 0 {
+			label += " (broken)"
+		}
+		fmt.Fprintf(b, "\t\ttrain%d [label=%s, fontcolor=%s];\n", t.id, quote(label), routeColors[i%len(routeColors)])
+	}
+	fmt.Fprintf(b, "\t}\n}\n")
+}
+
+func writeDotStationTrack(b *bufio.Writer, indent string, st *StationTrack, data *SimulationData, occupants []string) {
+	label := []string{fmt.Sprintf("%d:%s", st.id, st.Name), fmt.Sprintf("stop %d min", st.stopTime)}
+	fmt.Fprintf(b, "%sst%d [shape=box, color=blue, label=%s%s];\n",
+		indent, st.id, quote(dotLines(label, occupants)), dotState(data, &st.down, occupants, true))
+}
+
+// dotLines joins lines of label followed by occupants of track.
+func dotLines(label []string, occupants []string) string {
+	return strings.Join(append(append([]string{}, label...), occupants...), "\n")
+}
+
+// dotState returns attributes marking broken or occupied element in snapshot, filling nodes.
+func dotState(data *SimulationData, down *gauge, occupants []string, node bool) string {
+	switch {
+	case data == nil:
+		return ""
+	case down.Value() != 0 && node:
+		return ", style=filled, fillcolor=red, fontcolor=white"
+	case down.Value() != 0:
+		return ", color=red, fontcolor=red, style=dashed, penwidth=3"
+	case len(occupants) > 0 && node:
+		return ", style=filled, fillcolor=yellow"
+	case len(occupants) > 0:
+		return ", penwidth=3"
+	}
+	return ""
+}
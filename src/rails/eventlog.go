@@ -0,0 +1,242 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EVENT_LOG_HEADER starts every event log, followed by its version.
+const EVENT_LOG_HEADER = "rails event log"
+const EVENT_LOG_VERSION = 1
+
+// EVENT_LOG_LAYOUT is layout of event line in log.
+const EVENT_LOG_LAYOUT = "milliseconds Kind [t=train] [r=team] [w=worker] [s=station] [d=destination] [e=element] [f=from] [p=element,...] [m=minutes]"
+
+// elementCodes are short names of element kinds in event log, letters of the same views in REPL.
+var elementCodes = [...]string{"", "u", "n", "s", "t"}
+
+// LogSink writes every event as compact line of event log, preceded by railway description,
+// so that run can be replayed from log alone. Log is usable up to the last flushed line while simulation runs.
+type LogSink struct {
+	w *bufio.Writer
+}
+
+// NewLogSink creates pointer to new LogSink writing to w, railway description and seed are written at once.
+func NewLogSink(w io.Writer, railway *RailwayData, data *SimulationData) (*LogSink, error) {
+	var desc bytes.Buffer
+	if err := Save(&desc, TextFormat, data, railway); err != nil {
+		return nil, err
+	}
+	s := &LogSink{bufio.NewWriter(w)}
+	fmt.Fprintf(s.w, "%s %d\nseed %d\nrailway %d\n", EVENT_LOG_HEADER, EVENT_LOG_VERSION, data.Seed, desc.Len())
+	s.w.Write(desc.Bytes())
+	if _, err := fmt.Fprintf(s.w, "events\n"); err != nil {
+		return nil, err
+	}
+	return s, s.w.Flush()
+}
+
+func (s *LogSink) Consume(e Event) error {
+	_, err := s.w.WriteString(formatLogEvent(e) + "\n")
+	return err
+}
+
+func (s *LogSink) Flush() error { return s.w.Flush() }
+
+// formatLogEvent returns e as line of event log, without newline.
+func formatLogEvent(e Event) string {
+	fields := []string{strconv.FormatInt(int64(e.Time/time.Millisecond), 10), e.Kind.String()}
+	for _, f := range []struct {
+		key string
+		id  int
+	}{{"t", e.Train}, {"r", e.Team}, {"w", e.Worker}, {"s", e.Station}, {"d", e.Destination}} {
+		if f.id >= 0 {
+			fields = append(fields, f.key+"="+strconv.Itoa(f.id))
+		}
+	}
+	if e.Element.Kind != NoElement {
+		fields = append(fields, "e="+logElement(e.Element))
+	}
+	if e.From.Kind != NoElement {
+		fields = append(fields, "f="+logElement(e.From))
+	}
+	if len(e.Path) > 0 {
+		path := make([]string, len(e.Path))
+		for i, el := range e.Path {
+			path[i] = logElement(el)
+		}
+		fields = append(fields, "p="+strings.Join(path, ","))
+	}
+	if e.Minutes > 0 {
+		fields = append(fields, "m="+strconv.Itoa(e.Minutes))
+	}
+	return strings.Join(fields, " ")
+}
+
+func logElement(el Element) string {
+	if el.Kind > NoElement && int(el.Kind) < len(elementCodes) {
+		return elementCodes[el.Kind] + strconv.Itoa(el.ID)
+	}
+	return "?" + strconv.Itoa(el.ID)
+}
+
+func parseLogElement(s string) (Element, error) {
+	for kind, code := range elementCodes {
+		if code != "" && strings.HasPrefix(s, code) {
+			id, err := strconv.Atoi(s[len(code):])
+			if err != nil || id < 0 {
+				break
+			}
+			return Element{ElementKind(kind), id}, nil
+		}
+	}
+	return Element{}, fmt.Errorf("bad element %q", s)
+}
+
+// parseLogEvent reads event from line of event log.
+func parseLogEvent(line string) (Event, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return Event{}, errors.New("missing time or kind")
+	}
+	ms, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || ms < 0 {
+		return Event{}, fmt.Errorf("bad time %q", fields[0])
+	}
+	kind := EventKind(-1)
+	for k, name := range eventKindNames {
+		if name == fields[1] {
+			kind = EventKind(k)
+		}
+	}
+	if kind < 0 {
+		return Event{}, fmt.Errorf("unknown event %q", fields[1])
+	}
+	e := NewEvent(kind)
+	e.Time = time.Duration(ms) * time.Millisecond
+	for _, field := range fields[2:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return Event{}, fmt.Errorf("bad field %q", field)
+		}
+		key, value := kv[0], kv[1]
+		var id *int
+		switch key {
+		case "t":
+			id = &e.Train
+		case "r":
+			id = &e.Team
+		case "w":
+			id = &e.Worker
+		case "s":
+			id = &e.Station
+		case "d":
+			id = &e.Destination
+		case "m":
+			id = &e.Minutes
+		case "e", "f":
+			el, err := parseLogElement(value)
+			if err != nil {
+				return Event{}, err
+			}
+			if key == "e" {
+				e.Element = el
+			} else {
+				e.From = el
+			}
+		case "p":
+			for _, s := range strings.Split(value, ",") {
+				el, err := parseLogElement(s)
+				if err != nil {
+					return Event{}, err
+				}
+				e.Path = append(e.Path, el)
+			}
+		default:
+			return Event{}, fmt.Errorf("unknown field %q", field)
+		}
+		if id != nil {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return Event{}, fmt.Errorf("bad field %q", field)
+			}
+			*id = n
+		}
+	}
+	return e, nil
+}
+
+// EventLog is a run of simulation read from log written by LogSink.
+type EventLog struct {
+	Seed        int64
+	Description []byte  // railway description in TextFormat
+	Events      []Event // in order of publishing
+}
+
+// ReadEventLog reads event log written by LogSink. Unfinished last line of log
+// cut short by stopped simulation is skipped, malformed lines are reported as *ParseError.
+func ReadEventLog(r io.Reader) (*EventLog, error) {
+	b := bufio.NewReader(r)
+	log := &EventLog{}
+	n := 0
+	fail := func(section, layout string, err error) error {
+		return &ParseError{Line: n, Section: section, Layout: layout, Err: err}
+	}
+	readLine := func() (string, error) {
+		line, err := b.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		n++
+		return strings.TrimSuffix(line, "\n"), err
+	}
+
+	line, err := readLine()
+	if err != nil || line != fmt.Sprintf("%s %d", EVENT_LOG_HEADER, EVENT_LOG_VERSION) {
+		return nil, fail("header", fmt.Sprintf("%s %d", EVENT_LOG_HEADER, EVENT_LOG_VERSION), errors.New("not an event log"))
+	}
+	if line, err = readLine(); err == nil {
+		_, err = fmt.Sscanf(line, "seed %d", &log.Seed)
+	}
+	if err != nil {
+		return nil, fail("header", "seed number", err)
+	}
+	var size int
+	if line, err = readLine(); err == nil {
+		_, err = fmt.Sscanf(line, "railway %d", &size)
+	}
+	if err != nil {
+		return nil, fail("header", "railway bytes", err)
+	}
+	log.Description = make([]byte, size)
+	if _, err := io.ReadFull(b, log.Description); err != nil {
+		return nil, fail("railway", "", err)
+	}
+	n += bytes.Count(log.Description, []byte("\n"))
+	if line, err = readLine(); err != nil || line != "events" {
+		return nil, fail("header", "events", errors.New("missing events"))
+	}
+
+	for {
+		line, err := readLine()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return log, nil
+		} else if err != nil {
+			return nil, fail("events", "", err)
+		}
+		e, err := parseLogEvent(line)
+		if err != nil {
+			return nil, fail("events", EVENT_LOG_LAYOUT, err)
+		}
+		log.Events = append(log.Events, e)
+	}
+}
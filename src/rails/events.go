@@ -0,0 +1,383 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// EventKind tells what kind of state change Event reports.
+type EventKind int
+
+const (
+	TrainStarted     EventKind = iota // train entered simulation on first Turntable of its route
+	TrainEntered                      // train entered Element track
+	TrainLeft                         // train left Element track
+	StationArrival                    // train stopped at Element station track of Station
+	StationDeparture                  // train left Element station track of Station
+	Breakdown                         // Element broke and waits for repair
+	RepairDispatched                  // Team goes to repair Element along Path
+	RepairStarted                     // Team repairs Element while standing at From
+	RepairFinished                    // Team repaired Element
+	TeamEntered                       // Team entered Element track
+	TeamReturned                      // Team returned to depot
+	JobAssigned                       // Worker goes to work at Station for Minutes
+	WorkStarted                       // Worker started working
+	WorkFinished                      // Worker left work
+	WorkerReturned                    // Worker returned home from work
+	TicketIssued                      // Worker got ticket for Train from Station to Destination
+	Boarded                           // Worker got on Train at Station
+	Alighted                          // Worker got off Train at Station
+	SimulationEnded                   // simulation Duration passed
+)
+
+var eventKindNames = [...]string{
+	"TrainStarted", "TrainEntered", "TrainLeft", "StationArrival", "StationDeparture",
+	"Breakdown", "RepairDispatched", "RepairStarted", "RepairFinished", "TeamEntered",
+	"TeamReturned", "JobAssigned", "WorkStarted", "WorkFinished", "WorkerReturned",
+	"TicketIssued", "Boarded", "Alighted", "SimulationEnded"}
+
+func (k EventKind) String() string {
+	if k >= 0 && int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// ElementKind tells which railway elements ID of Element refers to.
+type ElementKind int
+
+const (
+	NoElement ElementKind = iota
+	TurntableElement
+	NormalTrackElement
+	StationTrackElement
+	TrainElement
+)
+
+var elementKindNames = [...]string{"", "Turntable", "NormalTrack", "StationTrack", "Train"}
+
+func (k ElementKind) String() string {
+	if k >= 0 && int(k) < len(elementKindNames) {
+		return elementKindNames[k]
+	}
+	return fmt.Sprintf("ElementKind(%d)", int(k))
+}
+
+// Element identifies track or train by its kind and ID.
+type Element struct {
+	Kind ElementKind
+	ID   int
+}
+
+func (e Element) String() string {
+	if e.Kind == NoElement {
+		return ""
+	}
+	return fmt.Sprintf("%v%d", e.Kind, e.ID)
+}
+
+// ElementOf returns Element identifying x, which should be a Track or *Train.
+func ElementOf(x interface{}) Element {
+	switch x := x.(type) {
+	case *Turntable:
+		return Element{TurntableElement, x.id}
+	case *NormalTrack:
+		return Element{NormalTrackElement, x.id}
+	case *StationTrack:
+		return Element{StationTrackElement, x.id}
+	case *Train:
+		return Element{TrainElement, x.id}
+	}
+	return Element{}
+}
+
+// Event is a single state change reported by running Simulation.
+// Entity fields not concerned by event Kind are set to -1.
+type Event struct {
+	Kind        EventKind
+	Time        time.Duration // simulated time elapsed since start
+	Train       int           // Train ID
+	Team        int           // RepairTeam ID
+	Worker      int           // Worker ID
+	Station     int           // Station ID
+	Destination int           // ticket destination Station ID
+	Element     Element       // track entered or left, broken or repaired element
+	From        Element       // RepairTeam position when repair starts
+	Path        []Element     // RepairTeam route to broken element
+	Minutes     int           // job duration in minutes
+}
+
+// NewEvent creates Event of given kind not concerning any entity.
+func NewEvent(kind EventKind) Event {
+	return Event{Kind: kind, Train: -1, Team: -1, Worker: -1, Station: -1, Destination: -1}
+}
+
+// trainEvent creates Event of train t concerning track.
+func trainEvent(kind EventKind, t *Train, track Track) Event {
+	e := NewEvent(kind)
+	e.Train = t.id
+	e.Element = ElementOf(track)
+	if st, ok := track.(*StationTrack); ok {
+		e.Station = st.station.id
+	}
+	return e
+}
+
+// brokenEvent creates Breakdown Event of x.
+func brokenEvent(x BrokenFella) Event {
+	e := NewEvent(Breakdown)
+	e.Element = ElementOf(x)
+	if t, ok := x.(*Train); ok {
+		e.Train = t.id
+	}
+	return e
+}
+
+// teamEvent creates Event of repair team rt concerning element.
+func teamEvent(kind EventKind, rt *RepairTeam, element Element) Event {
+	e := NewEvent(kind)
+	e.Team = rt.id
+	e.Element = element
+	return e
+}
+
+// workerEvent creates Event of worker w at station, train is optional.
+func workerEvent(kind EventKind, w *Worker, station *Station, train *Train) Event {
+	e := NewEvent(kind)
+	e.Worker = w.id
+	if station != nil {
+		e.Station = station.id
+	}
+	if train != nil {
+		e.Train = train.id
+	}
+	return e
+}
+
+// publish stamps e with current simulation time and delivers it to subscribers.
+func (d *SimulationData) publish(e Event) {
+	e.Time = d.Clock.Now()
+	d.events.publish(e)
+}
+
+// MarshalJSON encodes Event as object of its kind, time and concerned entities only.
+func (e Event) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"kind": e.Kind.String(),
+		"time": e.Time.Seconds(),
+	}
+	for name, id := range map[string]int{
+		"train": e.Train, "team": e.Team, "worker": e.Worker,
+		"station": e.Station, "destination": e.Destination} {
+		if id >= 0 {
+			m[name] = id
+		}
+	}
+	if e.Element.Kind != NoElement {
+		m["element"] = e.Element.String()
+	}
+	if e.From.Kind != NoElement {
+		m["from"] = e.From.String()
+	}
+	if len(e.Path) > 0 {
+		path := make([]string, len(e.Path))
+		for i, el := range e.Path {
+			path[i] = el.String()
+		}
+		m["path"] = path
+	}
+	if e.Minutes > 0 {
+		m["minutes"] = e.Minutes
+	}
+	return json.Marshal(m)
+}
+
+// Lookup returns railway entity identified by element, nil when it does not exist.
+func (r *RailwayData) Lookup(element Element) fmt.Stringer {
+	id := element.ID
+	switch element.Kind {
+	case TurntableElement:
+		if id >= 0 && id < len(r.Turntables) {
+			return r.Turntables[id]
+		}
+	case NormalTrackElement:
+		if id >= 0 && id < len(r.NormalTracks) {
+			return r.NormalTracks[id]
+		}
+	case StationTrackElement:
+		if id >= 0 && id < len(r.StationTracks) {
+			return r.StationTracks[id]
+		}
+	case TrainElement:
+		if id >= 0 && id < len(r.Trains) {
+			return r.Trains[id]
+		}
+	}
+	return nil
+}
+
+// Describe returns human-friendly description of e, without simulation clock.
+func (r *RailwayData) Describe(e Event) string {
+	element := func(el Element) string {
+		if s := r.Lookup(el); s != nil {
+			return s.String()
+		}
+		return "?"
+	}
+	train := func(id int) string { return element(Element{Kind: TrainElement, ID: id}) }
+	team, worker := "?", "?"
+	if e.Team >= 0 && e.Team < len(r.RepairTeams) {
+		team = r.RepairTeams[e.Team].String()
+	}
+	if e.Worker >= 0 && e.Worker < len(r.Workers) {
+		worker = r.Workers[e.Worker].String()
+	}
+	station := func(id int) string {
+		if id >= 0 && id < len(r.Stations) {
+			return r.Stations[id].String()
+		}
+		return "?"
+	}
+	moves := func(subject string) string {
+		switch e.Element.Kind {
+		case NormalTrackElement:
+			return fmt.Sprintf("%s travels along %s", subject, element(e.Element))
+		case StationTrackElement:
+			return fmt.Sprintf("%s waits on %s", subject, element(e.Element))
+		}
+		return fmt.Sprintf("%s rotates at %s", subject, element(e.Element))
+	}
+
+	switch e.Kind {
+	case TrainStarted:
+		return fmt.Sprintf("%s starts work", train(e.Train))
+	case TrainEntered:
+		return moves(train(e.Train))
+	case TrainLeft:
+		return fmt.Sprintf("%s leaves %s", train(e.Train), element(e.Element))
+	case StationArrival:
+		return fmt.Sprintf("%s >- %s", train(e.Train), element(e.Element))
+	case StationDeparture:
+		return fmt.Sprintf("%s -> %s", train(e.Train), element(e.Element))
+	case Breakdown:
+		return fmt.Sprintf("%s broke", element(e.Element))
+	case RepairDispatched:
+		s := fmt.Sprintf("%s prepares to repair %s", team, element(e.Element))
+		if len(e.Path) > 0 {
+			path := make([]string, len(e.Path))
+			for i, el := range e.Path {
+				path[i] = element(el)
+			}
+			s += " along " + strings.Join(path, ", ")
+		}
+		return s
+	case RepairStarted:
+		return fmt.Sprintf("%s repairs %s from %s", team, element(e.Element), element(e.From))
+	case RepairFinished:
+		return fmt.Sprintf("%s repaired %s", team, element(e.Element))
+	case TeamEntered:
+		return moves(team)
+	case TeamReturned:
+		return fmt.Sprintf("%s returned to depot", team)
+	case JobAssigned:
+		return fmt.Sprintf("%s goes to work at %s for %dm", worker, station(e.Station), e.Minutes)
+	case WorkStarted:
+		return fmt.Sprintf("%s is working...", worker)
+	case WorkFinished:
+		return fmt.Sprintf("%s leaves work", worker)
+	case WorkerReturned:
+		return fmt.Sprintf("%s returned from work", worker)
+	case TicketIssued:
+		return fmt.Sprintf("%s got ticket for %s[%s->%s]",
+			worker, train(e.Train), station(e.Station), station(e.Destination))
+	case Boarded:
+		return fmt.Sprintf("%s gets on %s at %s", worker, train(e.Train), station(e.Station))
+	case Alighted:
+		return fmt.Sprintf("%s gets off %s at %s", worker, train(e.Train), station(e.Station))
+	case SimulationEnded:
+		return "simulation time is over"
+	}
+	return e.Kind.String()
+}
+
+// Sink consumes events of Simulation one at a time, in order of publishing.
+// Flush is called once after the last event.
+type Sink interface {
+	Consume(e Event) error
+	Flush() error
+}
+
+// TextSink writes events as human-friendly lines prefixed with simulation clock.
+// Train movements between tracks and stations are written only once, as TrainEntered.
+type TextSink struct {
+	w       *bufio.Writer
+	railway *RailwayData
+	data    *SimulationData
+}
+
+// NewTextSink creates pointer to new TextSink writing to w.
+func NewTextSink(w io.Writer, railway *RailwayData, data *SimulationData) *TextSink {
+	return &TextSink{bufio.NewWriter(w), railway, data}
+}
+
+func (s *TextSink) Consume(e Event) error {
+	switch e.Kind {
+	case TrainLeft, StationArrival, StationDeparture:
+		return nil
+	}
+	_, err := fmt.Fprintf(s.w, "%s %s\n", s.data.ClockAt(e.Time), s.railway.Describe(e))
+	return err
+}
+
+func (s *TextSink) Flush() error { return s.w.Flush() }
+
+// TimetableSink writes train arrivals (>-) and departures (->) at station tracks.
+type TimetableSink struct {
+	w       *bufio.Writer
+	railway *RailwayData
+	data    *SimulationData
+}
+
+// NewTimetableSink creates pointer to new TimetableSink writing to w.
+func NewTimetableSink(w io.Writer, railway *RailwayData, data *SimulationData) *TimetableSink {
+	return &TimetableSink{bufio.NewWriter(w), railway, data}
+}
+
+func (s *TimetableSink) Consume(e Event) error {
+	var arrow string
+	switch e.Kind {
+	case StationArrival:
+		arrow = ">-"
+	case StationDeparture:
+		arrow = "->"
+	default:
+		return nil
+	}
+	_, err := fmt.Fprintf(s.w, "%v\t%s %s %v\n",
+		s.railway.Lookup(Element{TrainElement, e.Train}), s.data.ClockAt(e.Time), arrow, s.railway.Lookup(e.Element))
+	return err
+}
+
+func (s *TimetableSink) Flush() error { return s.w.Flush() }
+
+// JSONSink writes every event as JSON object in separate line.
+type JSONSink struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+// NewJSONSink creates pointer to new JSONSink writing to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	b := bufio.NewWriter(w)
+	return &JSONSink{b, json.NewEncoder(b)}
+}
+
+func (s *JSONSink) Consume(e Event) error { return s.encoder.Encode(e) }
+func (s *JSONSink) Flush() error          { return s.w.Flush() }
@@ -0,0 +1,292 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NORMAL_TRACK_BREAK_PROBABILITY  = 0.02
+	STATION_TRACK_BREAK_PROBABILITY = 0.02
+	TURNTABLE_BREAK_PROBABILITY     = 0.005
+	TRAIN_BREAK_PROBABILITY         = 0.02
+)
+
+// FailureModel decides how likely railway element is to break. Element rolls for breakdown
+// every time it has been used, with probability of failure since the previous roll.
+// Implementations must be comparable, so models differing from defaults can be told apart.
+type FailureModel interface {
+	Name() string                               // name of model in railway description
+	Parameters() []float64                      // parameters of model in railway description
+	Probability(from, to time.Duration) float64 // probability that element working at from breaks until to
+}
+
+// PerUse breaks element with the same probability P every time it is used.
+type PerUse struct{ P float64 }
+
+// ExponentialFailure breaks element after exponentially distributed time,
+// MTBF is mean time between failures in simulated hours.
+type ExponentialFailure struct{ MTBF float64 }
+
+// WeibullFailure breaks element after Weibull distributed time, so elements with Shape
+// above 1 break more often the older they get. Scale and Age are in simulated hours,
+// Age is age of element when simulation starts. Repairs do not make element younger.
+type WeibullFailure struct{ Scale, Shape, Age float64 }
+
+func (m PerUse) Name() string                               { return "perUse" }
+func (m PerUse) Parameters() []float64                      { return []float64{m.P} }
+func (m PerUse) Probability(from, to time.Duration) float64 { return m.P }
+
+func (m ExponentialFailure) Name() string          { return "mtbf" }
+func (m ExponentialFailure) Parameters() []float64 { return []float64{m.MTBF} }
+func (m ExponentialFailure) Probability(from, to time.Duration) float64 {
+	return 1 - math.Exp(-(to-from).Hours()/m.MTBF)
+}
+
+func (m WeibullFailure) Name() string { return "weibull" }
+func (m WeibullFailure) Parameters() []float64 {
+	if m.Age == 0 {
+		return []float64{m.Scale, m.Shape}
+	}
+	return []float64{m.Scale, m.Shape, m.Age}
+}
+func (m WeibullFailure) Probability(from, to time.Duration) float64 {
+	hazard := func(t time.Duration) float64 { return math.Pow((m.Age+t.Hours())/m.Scale, m.Shape) }
+	return 1 - math.Exp(hazard(from)-hazard(to))
+}
+
+// FAILURE_MODELS_LAYOUT lists failure models with their parameters.
+const FAILURE_MODELS_LAYOUT = "perUse probability | mtbf hours | weibull scaleHours shape [ageHours]"
+
+// NewFailureModel creates FailureModel of given name with parameters as in railway description.
+func NewFailureModel(name string, parameters []float64) (FailureModel, error) {
+	count := func(min, max int) error {
+		if n := len(parameters); n < min || n > max {
+			if min == max {
+				return fmt.Errorf("%s model takes %d parameters, found %d", name, min, n)
+			}
+			return fmt.Errorf("%s model takes %d to %d parameters, found %d", name, min, max, n)
+		}
+		return nil
+	}
+	positive := func(what string, v float64) error {
+		if v <= 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("%s %v must be positive", what, v)
+		}
+		return nil
+	}
+
+	switch strings.ToLower(name) {
+	case "peruse":
+		if err := count(1, 1); err != nil {
+			return nil, err
+		}
+		if p := parameters[0]; !(p >= 0 && p <= 1) {
+			return nil, fmt.Errorf("probability %v must be between 0 and 1", p)
+		}
+		return PerUse{parameters[0]}, nil
+	case "mtbf":
+		if err := count(1, 1); err != nil {
+			return nil, err
+		}
+		if err := positive("mtbf", parameters[0]); err != nil {
+			return nil, err
+		}
+		return ExponentialFailure{parameters[0]}, nil
+	case "weibull":
+		if err := count(2, 3); err != nil {
+			return nil, err
+		}
+		m := WeibullFailure{Scale: parameters[0], Shape: parameters[1]}
+		if err := positive("scale", m.Scale); err != nil {
+			return nil, err
+		}
+		if err := positive("shape", m.Shape); err != nil {
+			return nil, err
+		}
+		if len(parameters) == 3 {
+			m.Age = parameters[2]
+			if !(m.Age >= 0) || math.IsInf(m.Age, 0) {
+				return nil, fmt.Errorf("age %v must not be negative", m.Age)
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown failure model %q, expected: %s", name, FAILURE_MODELS_LAYOUT)
+}
+
+// FailureString returns model with parameters as written in text railway description.
+func FailureString(m FailureModel) string {
+	fields := []string{m.Name()}
+	for _, p := range m.Parameters() {
+		fields = append(fields, strconv.FormatFloat(p, 'g', -1, 64))
+	}
+	return strings.Join(fields, " ")
+}
+
+// DefaultFailure returns FailureModel of elements of given kind not set in railway description.
+func DefaultFailure(kind ElementKind) FailureModel {
+	switch kind {
+	case TurntableElement:
+		return PerUse{TURNTABLE_BREAK_PROBABILITY}
+	case NormalTrackElement:
+		return PerUse{NORMAL_TRACK_BREAK_PROBABILITY}
+	case StationTrackElement:
+		return PerUse{STATION_TRACK_BREAK_PROBABILITY}
+	case TrainElement:
+		return PerUse{TRAIN_BREAK_PROBABILITY}
+	}
+	return PerUse{0}
+}
+
+// failure rolls breakdowns of single element according to its FailureModel.
+// It is used only by goroutine simulating the element.
+type failure struct {
+	model   FailureModel
+	checked time.Duration // simulated time of the last roll or repair
+}
+
+// breaks reports whether element used until now breaks, drawing from random.
+func (f *failure) breaks(random *rand.Rand, now time.Duration) bool {
+	p := f.model.Probability(f.checked, now)
+	f.checked = now
+	return random.Float64() < p
+}
+
+// repaired starts measuring time to next failure from now.
+func (f *failure) repaired(now time.Duration) { f.checked = now }
+
+func (nt *NormalTrack) Failure() FailureModel      { return nt.failure.model }
+func (st *StationTrack) Failure() FailureModel     { return st.failure.model }
+func (tt *Turntable) Failure() FailureModel        { return tt.failure.model }
+func (t *Train) Failure() FailureModel             { return t.failure.model }
+func (nt *NormalTrack) SetFailure(m FailureModel)  { nt.failure.model = m }
+func (st *StationTrack) SetFailure(m FailureModel) { st.failure.model = m }
+func (tt *Turntable) SetFailure(m FailureModel)    { tt.failure.model = m }
+func (t *Train) SetFailure(m FailureModel)         { t.failure.model = m }
+
+// failureKinds are kinds of elements which can break, in order of railway description.
+var failureKinds = []ElementKind{TurntableElement, NormalTrackElement, StationTrackElement, TrainElement}
+
+// failureKind returns kind of elements as written in railway description, like normalTrack.
+func failureKind(kind ElementKind) string {
+	s := kind.String()
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// parseFailureKind returns kind of elements named as in railway description.
+func parseFailureKind(s string) (ElementKind, error) {
+	names := make([]string, len(failureKinds))
+	for i, kind := range failureKinds {
+		if strings.EqualFold(s, kind.String()) {
+			return kind, nil
+		}
+		names[i] = failureKind(kind)
+	}
+	return NoElement, fmt.Errorf("unknown element %q, expected one of: %s", s, strings.Join(names, ", "))
+}
+
+// SetFailure sets FailureModel of element of given kind referenced by ref.
+// When ref is *, model becomes default of the kind and is set for all its elements.
+func (r *RailwayData) SetFailure(kind ElementKind, ref string, model FailureModel) error {
+	if _, err := parseFailureKind(kind.String()); err != nil {
+		return fmt.Errorf("%v elements can't break", kind)
+	}
+	if ref == "*" {
+		if r.Failures == nil {
+			r.Failures = make(map[ElementKind]FailureModel)
+		}
+		r.Failures[kind] = model
+	}
+	switch kind {
+	case TurntableElement:
+		if ref == "*" {
+			for _, tt := range r.Turntables {
+				tt.SetFailure(model)
+			}
+			return nil
+		}
+		i, err := r.turntableRef(ref)
+		if err != nil {
+			return err
+		}
+		r.Turntables[i].SetFailure(model)
+	case NormalTrackElement:
+		if ref == "*" {
+			for _, nt := range r.NormalTracks {
+				nt.SetFailure(model)
+			}
+			return nil
+		}
+		i, err := indexRef(ref, len(r.NormalTracks), "normal track")
+		if err != nil {
+			return err
+		}
+		r.NormalTracks[i].SetFailure(model)
+	case StationTrackElement:
+		if ref == "*" {
+			for _, st := range r.StationTracks {
+				st.SetFailure(model)
+			}
+			return nil
+		}
+		i, err := indexRef(ref, len(r.StationTracks), "station track")
+		if err != nil {
+			return err
+		}
+		r.StationTracks[i].SetFailure(model)
+	case TrainElement:
+		if ref == "*" {
+			for _, t := range r.Trains {
+				t.SetFailure(model)
+			}
+			return nil
+		}
+		i, err := r.trainRef(ref)
+		if err != nil {
+			return err
+		}
+		r.Trains[i].SetFailure(model)
+	}
+	return nil
+}
+
+// defaultFailure returns FailureModel of elements of given kind used in railway.
+func (r *RailwayData) defaultFailure(kind ElementKind) FailureModel {
+	if m, ok := r.Failures[kind]; ok {
+		return m
+	}
+	return DefaultFailure(kind)
+}
+
+// Broken returns elements which wait for repair now.
+func (r *RailwayData) Broken() (broken []Element) {
+	for _, tt := range r.Turntables {
+		if tt.down.Value() != 0 {
+			broken = append(broken, ElementOf(tt))
+		}
+	}
+	for _, nt := range r.NormalTracks {
+		if nt.down.Value() != 0 {
+			broken = append(broken, ElementOf(nt))
+		}
+	}
+	for _, st := range r.StationTracks {
+		if st.down.Value() != 0 {
+			broken = append(broken, ElementOf(st))
+		}
+	}
+	for _, t := range r.Trains {
+		if t.down.Value() != 0 {
+			broken = append(broken, ElementOf(t))
+		}
+	}
+	return
+}
@@ -0,0 +1,196 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewFailureModel(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		parameters []float64
+		model      FailureModel
+		err        string
+	}{
+		{"perUse", []float64{0.02}, PerUse{0.02}, ""},
+		{"PERUSE", []float64{0}, PerUse{0}, ""},
+		{"perUse", []float64{1}, PerUse{1}, ""},
+		{"perUse", []float64{1.5}, nil, "probability 1.5 must be between 0 and 1"},
+		{"perUse", []float64{-0.1}, nil, "probability -0.1 must be between 0 and 1"},
+		{"perUse", []float64{math.NaN()}, nil, "probability NaN must be between 0 and 1"},
+		{"perUse", []float64{0.1, 0.2}, nil, "perUse model takes 1 parameters, found 2"},
+		{"mtbf", []float64{30}, ExponentialFailure{30}, ""},
+		{"mtbf", []float64{0}, nil, "mtbf 0 must be positive"},
+		{"mtbf", []float64{-30}, nil, "mtbf -30 must be positive"},
+		{"mtbf", []float64{math.Inf(1)}, nil, "mtbf +Inf must be positive"},
+		{"mtbf", nil, nil, "mtbf model takes 1 parameters, found 0"},
+		{"weibull", []float64{200, 3}, WeibullFailure{200, 3, 0}, ""},
+		{"Weibull", []float64{200, 3, 400}, WeibullFailure{200, 3, 400}, ""},
+		{"weibull", []float64{200}, nil, "weibull model takes 2 to 3 parameters, found 1"},
+		{"weibull", []float64{200, 3, 400, 1}, nil, "weibull model takes 2 to 3 parameters, found 4"},
+		{"weibull", []float64{0, 3}, nil, "scale 0 must be positive"},
+		{"weibull", []float64{200, -1}, nil, "shape -1 must be positive"},
+		{"weibull", []float64{200, 3, -1}, nil, "age -1 must not be negative"},
+		{"weibull", []float64{200, 3, math.Inf(1)}, nil, "age +Inf must not be negative"},
+		{"often", []float64{1}, nil, `unknown failure model "often", expected: ` + FAILURE_MODELS_LAYOUT},
+	} {
+		model, err := NewFailureModel(c.name, c.parameters)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s %v: got %v, %v, want error %s", c.name, c.parameters, model, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: %v", c.name, c.parameters, err)
+		} else if model != c.model {
+			t.Errorf("%s %v: got %#v, want %#v", c.name, c.parameters, model, c.model)
+		} else if again, err := NewFailureModel(model.Name(), model.Parameters()); err != nil || again != model {
+			// name and parameters written to railway description read back as the same model
+			t.Errorf("%s %v: %s read back as %v, %v", c.name, c.parameters, FailureString(model), again, err)
+		}
+	}
+}
+
+func TestFailureProbability(t *testing.T) {
+	h := func(hours float64) time.Duration { return time.Duration(hours * float64(time.Hour)) }
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	for _, c := range []struct {
+		name     string
+		model    FailureModel
+		from, to time.Duration
+		p        float64
+	}{
+		{"per use ignores time", PerUse{0.02}, h(3), h(500), 0.02},
+		{"exponential over no time", ExponentialFailure{30}, h(10), h(10), 0},
+		{"exponential over mtbf", ExponentialFailure{30}, h(0), h(30), 1 - 1/math.E},
+		{"exponential has no memory", ExponentialFailure{30}, h(1000), h(1030), 1 - 1/math.E},
+		{"weibull over scale", WeibullFailure{200, 3, 0}, h(0), h(200), 1 - 1/math.E},
+		{"weibull with age", WeibullFailure{200, 3, 400}, h(0), h(1), 1 - math.Exp(math.Pow(2, 3)-math.Pow(401.0/200, 3))},
+		{"weibull of shape 1 is exponential", WeibullFailure{30, 1, 1000}, h(5), h(35), 1 - 1/math.E},
+	} {
+		if p := c.model.Probability(c.from, c.to); !near(p, c.p) {
+			t.Errorf("%s: %v, want %v", c.name, p, c.p)
+		}
+	}
+
+	// surviving whole interval is surviving its parts one after another
+	for _, m := range []FailureModel{ExponentialFailure{30}, WeibullFailure{200, 3, 0}, WeibullFailure{200, 0.5, 50}} {
+		whole := 1 - m.Probability(h(10), h(40))
+		parts := (1 - m.Probability(h(10), h(25))) * (1 - m.Probability(h(25), h(40)))
+		if !near(whole, parts) {
+			t.Errorf("%s: survives whole interval with %v, its parts with %v", FailureString(m), whole, parts)
+		}
+	}
+
+	// elements of shape above 1 break more often as they age, below 1 less often
+	for _, c := range []struct {
+		model  WeibullFailure
+		ageing bool
+	}{{WeibullFailure{200, 3, 0}, true}, {WeibullFailure{200, 0.5, 0}, false}} {
+		young, old := c.model.Probability(h(10), h(11)), c.model.Probability(h(100), h(101))
+		if (old > young) != c.ageing {
+			t.Errorf("%s: %v in 11th hour, %v in 101st", FailureString(c.model), young, old)
+		}
+	}
+}
+
+func TestFailureBreaks(t *testing.T) {
+	// element used every hour breaks about as often as model says
+	const ROLLS = 20000
+	for _, m := range []FailureModel{PerUse{0.02}, ExponentialFailure{10}} {
+		random := rand.New(rand.NewSource(1))
+		f := &failure{model: m}
+		breakdowns := 0
+		for i := 1; i <= ROLLS; i++ {
+			if f.breaks(random, time.Duration(i)*time.Hour) {
+				breakdowns++
+			}
+		}
+		want := m.Probability(0, time.Hour)
+		if got := float64(breakdowns) / ROLLS; math.Abs(got-want) > 0.01 {
+			t.Errorf("%s: broke in %v of rolls, want %v", FailureString(m), got, want)
+		}
+	}
+
+	// time to failure is measured from the last roll or repair
+	f := &failure{model: ExponentialFailure{1}}
+	f.breaks(rand.New(rand.NewSource(1)), 5*time.Hour)
+	f.repaired(100 * time.Hour)
+	if f.checked != 100*time.Hour {
+		t.Errorf("repaired at 100h, next roll measures from %v", f.checked)
+	}
+	// Float64 is always below 1, so probability 1 breaks element and 0 never does
+	for _, p := range []float64{0, 1} {
+		f := &failure{model: PerUse{p}}
+		if broke := f.breaks(rand.New(rand.NewSource(1)), time.Hour); broke != (p == 1) {
+			t.Errorf("perUse %v: broke %v", p, broke)
+		}
+	}
+}
+
+func TestFailureLinesOverride(t *testing.T) {
+	b, err := ioutil.ReadFile("../../input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// later lines override earlier ones, default of * overrides elements set before it
+	text := strings.Replace(string(b), "failure train * perUse 0.02\n", "failure train * perUse 0.02\n"+
+		"failure normalTrack 0 weibull 200 3 400\n"+
+		"failure normalTrack * mtbf 50\n"+
+		"failure normalTrack 7 weibull 200 3 400\n"+
+		"failure train ||| mtbf 30\n"+
+		"failure train ||| perUse 0.1\n", 1)
+	if text == string(b) {
+		t.Fatal("input has no failure line of trains")
+	}
+
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := Load(strings.NewReader(text), TextFormat, data, railway); err != nil {
+		t.Fatal(err)
+	}
+	// the same models are set when description saved as JSON is loaded again
+	var saved bytes.Buffer
+	if err := Save(&saved, JSONFormat, data, railway); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &RailwayData{}
+	if err := Load(&saved, JSONFormat, &SimulationData{}, loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, r := range map[string]*RailwayData{"text": railway, "json": loaded} {
+		for i, nt := range r.NormalTracks {
+			var want FailureModel = ExponentialFailure{50}
+			if i == 7 {
+				want = WeibullFailure{200, 3, 400}
+			}
+			if nt.Failure() != want {
+				t.Errorf("%s: %v fails as %s, want %s", name, nt, FailureString(nt.Failure()), FailureString(want))
+			}
+		}
+		for _, tr := range r.Trains {
+			var want FailureModel = PerUse{0.02}
+			if tr.Name == "|||" {
+				want = PerUse{0.1}
+			}
+			if tr.Failure() != want {
+				t.Errorf("%s: %v fails as %s, want %s", name, tr, FailureString(tr.Failure()), FailureString(want))
+			}
+		}
+		if m := r.defaultFailure(NormalTrackElement); m != (ExponentialFailure{50}) {
+			t.Errorf("%s: normal tracks fail by default as %s, want mtbf 50", name, FailureString(m))
+		}
+		if m := r.defaultFailure(TurntableElement); m != (PerUse{TURNTABLE_BREAK_PROBABILITY}) {
+			t.Errorf("%s: turntables fail by default as %s, want perUse %v", name, FailureString(m), TURNTABLE_BREAK_PROBABILITY)
+		}
+	}
+}
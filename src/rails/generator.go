@@ -0,0 +1,302 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// GeneratorOptions are parameters of railway network created by Generate.
+type GeneratorOptions struct {
+	SecondsPerHour int
+	Turntables     int     // all turntables, every station takes two of them
+	Stations       int     // passenger stations, repair depot is added when there are RepairTeams
+	Trains         int     // trains, each starts at different turntable
+	RepairTeams    int     // repair teams, all based at one depot
+	Workers        int     // workers living at random stations
+	Density        float64 // fraction of pairs of turntables joined by normal tracks, beside ones needed to join network
+	MinLen, MaxLen int     // range of normal track lengths in km
+	MinLimit       int     // range of normal track speed limits in km/h
+	MaxLimit       int
+}
+
+// DefaultGeneratorOptions returns options of network a bit larger than the one in input file.
+func DefaultGeneratorOptions() GeneratorOptions {
+	return GeneratorOptions{
+		SecondsPerHour: 5,
+		Turntables:     24,
+		Stations:       8,
+		Trains:         4,
+		RepairTeams:    1,
+		Workers:        10,
+		Density:        0.05,
+		MinLen:         20,
+		MaxLen:         100,
+		MinLimit:       60,
+		MaxLimit:       160}
+}
+
+func (o GeneratorOptions) check() error {
+	switch {
+	case o.SecondsPerHour <= 0:
+		return fmt.Errorf("seconds per hour %d must be positive", o.SecondsPerHour)
+	case o.Stations < 1:
+		return fmt.Errorf("there must be at least one station")
+	case o.Turntables < 2*o.Stations:
+		return fmt.Errorf("%d stations need at least %d turntables, there are %d", o.Stations, 2*o.Stations, o.Turntables)
+	case o.Trains < 1:
+		return fmt.Errorf("there must be at least one train")
+	case o.Trains > o.Turntables:
+		return fmt.Errorf("%d trains can't start at %d turntables", o.Trains, o.Turntables)
+	case o.RepairTeams < 0 || o.Workers < 0:
+		return fmt.Errorf("numbers of repair teams and workers must not be negative")
+	case !(o.Density >= 0 && o.Density <= 1):
+		return fmt.Errorf("density %v must be between 0 and 1", o.Density)
+	case o.MinLen <= 0 || o.MaxLen < o.MinLen:
+		return fmt.Errorf("track lengths %d-%d must be positive range", o.MinLen, o.MaxLen)
+	case o.MinLimit <= 0 || o.MaxLimit < o.MinLimit:
+		return fmt.Errorf("speed limits %d-%d must be positive range", o.MinLimit, o.MaxLimit)
+	}
+	return nil
+}
+
+// generator builds Description of random network, turntables are nodes of graph
+// and tracks are its edges.
+type generator struct {
+	GeneratorOptions
+	random   *rand.Rand
+	desc     *Description
+	adjacent [][]int // turntables joined by any track, in order of joining
+	joined   map[[2]int]bool
+	stations [][2]int // turntables of passenger stations
+}
+
+// Generate creates description of random railway network with given options. Network is connected,
+// every station is served by a train and every train route is a cycle over existing tracks.
+// Description is checked by Validate before it is returned.
+func Generate(options GeneratorOptions, random *rand.Rand) (*Description, error) {
+	if err := options.check(); err != nil {
+		return nil, err
+	}
+	g := &generator{
+		GeneratorOptions: options,
+		random:           random,
+		desc: &Description{
+			SecondsPerHour: options.SecondsPerHour,
+			Clock:          ClockDescription{Hours: 6},
+			Turntables:     make([]TurntableDescription, 0),
+			NormalTracks:   make([]NormalTrackDescription, 0),
+			StationTracks:  make([]StationTrackDescription, 0),
+			RepairTeams:    make([]RepairTeamDescription, 0),
+			Trains:         make([]TrainDescription, 0),
+			Workers:        make([]WorkerDescription, 0)},
+		adjacent: make([][]int, options.Turntables),
+		joined:   make(map[[2]int]bool)}
+
+	g.turntables()
+	g.stationTracks()
+	g.normalTracks()
+	g.repairTeams()
+	g.trains()
+	g.workers()
+
+	railway := &RailwayData{}
+	if err := g.desc.Apply(&SimulationData{}, railway); err != nil {
+		return nil, err
+	}
+	if err := railway.Validate(); err != nil {
+		return nil, err
+	}
+	return g.desc, nil
+}
+
+// between returns random integer from min to max.
+func (g *generator) between(min, max int) int { return min + g.random.Intn(max-min+1) }
+
+func (g *generator) turntables() {
+	for i := 0; i < g.Turntables; i++ {
+		g.desc.Turntables = append(g.desc.Turntables, TurntableDescription{i, g.between(2, 15), g.between(10, 60), ""})
+	}
+}
+
+// join remembers that a and b are joined by track.
+func (g *generator) join(a, b int) {
+	if !g.joined[[2]int{a, b}] {
+		g.adjacent[a] = append(g.adjacent[a], b)
+		g.adjacent[b] = append(g.adjacent[b], a)
+	}
+	g.joined[[2]int{a, b}] = true
+	g.joined[[2]int{b, a}] = true
+}
+
+// stationTracks places stations on random pairs of turntables, with one to three parallel tracks.
+func (g *generator) stationTracks() {
+	free := g.random.Perm(g.Turntables)
+	for i := 0; i < g.Stations; i++ {
+		a, b := free[2*i], free[2*i+1]
+		g.stations = append(g.stations, [2]int{a, b})
+		name := fmt.Sprintf("st%d", i)
+		stopTime, repairTime := g.between(2, 20), g.between(10, 40)
+		for n := g.between(1, 3); n > 0; n-- {
+			g.desc.StationTracks = append(g.desc.StationTracks, StationTrackDescription{
+				len(g.desc.StationTracks), name, stopTime, repairTime, IDRef(a), IDRef(b), ""})
+		}
+		g.join(a, b)
+	}
+}
+
+func (g *generator) normalTrack(a, b int) {
+	limit := g.between(g.MinLimit, g.MaxLimit)
+	g.desc.NormalTracks = append(g.desc.NormalTracks, NormalTrackDescription{
+		len(g.desc.NormalTracks), g.between(g.MinLen, g.MaxLen), limit, g.between(20, 100), IDRef(a), IDRef(b)})
+	g.join(a, b)
+}
+
+// normalTracks joins network into one piece, then adds tracks between random turntables
+// until Density is reached. Turntables of one station are joined only by its station tracks.
+func (g *generator) normalTracks() {
+	// join every piece of network to random turntable of pieces joined before
+	pieces := make([][]int, 0)
+	piece := make([]int, g.Turntables)
+	for i := range piece {
+		piece[i] = -1
+	}
+	for _, i := range g.random.Perm(g.Turntables) {
+		if piece[i] >= 0 {
+			continue
+		}
+		piece[i] = len(pieces)
+		members := []int{i}
+		for _, j := range g.adjacent[i] {
+			piece[j] = len(pieces)
+			members = append(members, j)
+		}
+		pieces = append(pieces, members)
+	}
+	for i := 1; i < len(pieces); i++ {
+		joined := pieces[g.random.Intn(i)]
+		g.normalTrack(pieces[i][g.random.Intn(len(pieces[i]))], joined[g.random.Intn(len(joined))])
+	}
+
+	pairs := g.Turntables * (g.Turntables - 1) / 2
+	extra := int(g.Density * float64(pairs))
+	for attempts := 0; extra > 0 && attempts < 10*pairs; attempts++ {
+		a, b := g.random.Intn(g.Turntables), g.random.Intn(g.Turntables)
+		if a == b || g.joined[[2]int{a, b}] {
+			continue
+		}
+		g.normalTrack(a, b)
+		extra--
+	}
+}
+
+// repairTeams creates depot at random turntable, a station track leading back to it.
+func (g *generator) repairTeams() {
+	if g.RepairTeams == 0 {
+		return
+	}
+	tt := g.random.Intn(g.Turntables)
+	depot := len(g.desc.StationTracks)
+	g.desc.StationTracks = append(g.desc.StationTracks, StationTrackDescription{
+		depot, "depot", g.between(10, 30), 0, IDRef(tt), IDRef(tt), Depot.String()})
+	for i := 0; i < g.RepairTeams; i++ {
+		g.desc.RepairTeams = append(g.desc.RepairTeams, RepairTeamDescription{i, g.between(150, 300), IDRef(depot)})
+	}
+}
+
+// path returns shortest sequence of turntables from a to b, both included.
+func (g *generator) path(a, b int) []int {
+	previous := map[int]int{a: a}
+	queue := []int{a}
+	for len(queue) > 0 && queue[0] != b {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range g.adjacent[current] {
+			if _, ok := previous[next]; !ok {
+				previous[next] = current
+				queue = append(queue, next)
+			}
+		}
+	}
+	path := []int{b}
+	for current := b; current != a; {
+		current = previous[current]
+		path = append([]int{current}, path...)
+	}
+	return path
+}
+
+// trains creates trains with routes passing through their stations, every station is served
+// by at least one train. Routes are closed walks over joined turntables.
+func (g *generator) trains() {
+	served := make([][][2]int, g.Trains)
+	for i, s := range g.stations {
+		served[i%g.Trains] = append(served[i%g.Trains], s)
+	}
+	for i := range served {
+		// trains left without station get another one at random
+		for more := g.random.Intn(3); more > 0 || len(served[i]) == 0; more-- {
+			served[i] = append(served[i], g.stations[g.random.Intn(len(g.stations))])
+		}
+		g.random.Shuffle(len(served[i]), func(a, b int) { served[i][a], served[i][b] = served[i][b], served[i][a] })
+	}
+
+	starts := make(map[int]bool)
+	for i, stations := range served {
+		// pass station tracks in random direction, then go to next station
+		walk := []int{}
+		for _, s := range stations {
+			a, b := s[0], s[1]
+			if g.random.Intn(2) == 0 {
+				a, b = b, a
+			}
+			if len(walk) == 0 {
+				walk = append(walk, a)
+			} else {
+				walk = append(walk, g.path(walk[len(walk)-1], a)[1:]...)
+			}
+			walk = append(walk, b)
+		}
+		walk = append(walk, g.path(walk[len(walk)-1], walk[0])[1:]...)
+		route := walk[:len(walk)-1]
+
+		// start at turntable of route where no other train starts
+		start := -1
+		for j, tt := range route {
+			if !starts[tt] {
+				start = j
+				break
+			}
+		}
+		if start < 0 {
+			// all are taken, so route goes to the nearest free turntable and back first
+			var detour []int
+			for tt := 0; tt < g.Turntables; tt++ {
+				if p := g.path(route[0], tt); !starts[tt] && (detour == nil || len(p) < len(detour)) {
+					detour = p
+				}
+			}
+			start = len(detour) - 1
+			for j := len(detour) - 2; j > 0; j-- {
+				detour = append(detour, detour[j])
+			}
+			route = append(detour, route...)
+		}
+		starts[route[start]] = true
+		refs := make([]Ref, len(route))
+		for j := range route {
+			refs[j] = IDRef(route[(start+j)%len(route)])
+		}
+		g.desc.Trains = append(g.desc.Trains, TrainDescription{
+			i, g.between(100, 250), g.between(50, 250), g.between(30, 150), fmt.Sprintf("t%d", i), refs})
+	}
+}
+
+func (g *generator) workers() {
+	for i := 0; i < g.Workers; i++ {
+		home := g.random.Intn(len(g.stations))
+		g.desc.Workers = append(g.desc.Workers, WorkerDescription{i, Ref(fmt.Sprintf("st%d", home))})
+	}
+}
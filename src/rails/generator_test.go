@@ -0,0 +1,92 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// generatorOptions returns default generator options changed by change.
+func generatorOptions(change func(o *GeneratorOptions)) GeneratorOptions {
+	o := DefaultGeneratorOptions()
+	change(&o)
+	return o
+}
+
+func TestGenerate(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		options GeneratorOptions
+	}{
+		{"default", DefaultGeneratorOptions()},
+		{"one station", generatorOptions(func(o *GeneratorOptions) { o.Turntables, o.Stations, o.Trains = 2, 1, 1 })},
+		{"one station among many turntables", generatorOptions(func(o *GeneratorOptions) { o.Turntables, o.Stations, o.Trains = 12, 1, 3 })},
+		{"trains at every turntable", generatorOptions(func(o *GeneratorOptions) { o.Turntables, o.Stations, o.Trains = 10, 2, 10 })},
+		{"trains at every station turntable", generatorOptions(func(o *GeneratorOptions) { o.Turntables, o.Stations, o.Trains = 6, 3, 6 })},
+		{"density 0", generatorOptions(func(o *GeneratorOptions) { o.Density = 0 })},
+		{"density 1", generatorOptions(func(o *GeneratorOptions) { o.Turntables, o.Stations, o.Density = 12, 4, 1 })},
+		{"no repair teams", generatorOptions(func(o *GeneratorOptions) { o.RepairTeams = 0 })},
+		{"no workers", generatorOptions(func(o *GeneratorOptions) { o.Workers = 0 })},
+		{"many repair teams", generatorOptions(func(o *GeneratorOptions) { o.RepairTeams = 3 })},
+	} {
+		for seed := int64(0); seed < 10; seed++ {
+			desc, err := Generate(c.options, rand.New(rand.NewSource(seed)))
+			if err != nil {
+				t.Errorf("%s, seed %d: %v", c.name, seed, err)
+				continue
+			}
+			data, railway := &SimulationData{}, &RailwayData{}
+			if err := desc.Apply(data, railway); err != nil {
+				t.Errorf("%s, seed %d: %v", c.name, seed, err)
+				continue
+			}
+			if err := railway.Validate(); err != nil {
+				t.Errorf("%s, seed %d: %v", c.name, seed, err)
+			}
+
+			if n := len(railway.Trains); n != c.options.Trains {
+				t.Errorf("%s, seed %d: %d trains, want %d", c.name, seed, n, c.options.Trains)
+			}
+			if n := len(railway.RepairTeams); n != c.options.RepairTeams {
+				t.Errorf("%s, seed %d: %d repair teams, want %d", c.name, seed, n, c.options.RepairTeams)
+			}
+			reachable := railway.reachable(railway.Turntables[0])
+			for _, tt := range railway.Turntables {
+				if !reachable[tt] {
+					t.Errorf("%s, seed %d: %v can't be reached from %v", c.name, seed, tt, railway.Turntables[0])
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateRejectsBadOptions(t *testing.T) {
+	for _, c := range []struct {
+		options GeneratorOptions
+		err     string
+	}{
+		{generatorOptions(func(o *GeneratorOptions) { o.SecondsPerHour = 0 }), "seconds per hour 0 must be positive"},
+		{generatorOptions(func(o *GeneratorOptions) { o.Stations = 0 }), "there must be at least one station"},
+		{generatorOptions(func(o *GeneratorOptions) { o.Turntables = 15 }), "8 stations need at least 16 turntables, there are 15"},
+		{generatorOptions(func(o *GeneratorOptions) { o.Trains = 0 }), "there must be at least one train"},
+		{generatorOptions(func(o *GeneratorOptions) { o.Trains = 25 }), "25 trains can't start at 24 turntables"},
+		{generatorOptions(func(o *GeneratorOptions) { o.RepairTeams = -1 }), "numbers of repair teams and workers must not be negative"},
+		{generatorOptions(func(o *GeneratorOptions) { o.Workers = -1 }), "numbers of repair teams and workers must not be negative"},
+		{generatorOptions(func(o *GeneratorOptions) { o.Density = 1.5 }), "density 1.5 must be between 0 and 1"},
+		{generatorOptions(func(o *GeneratorOptions) { o.Density = -0.1 }), "density -0.1 must be between 0 and 1"},
+		{generatorOptions(func(o *GeneratorOptions) { o.MinLen = 0 }), "track lengths 0-100 must be positive range"},
+		{generatorOptions(func(o *GeneratorOptions) { o.MaxLen = 10 }), "track lengths 20-10 must be positive range"},
+		{generatorOptions(func(o *GeneratorOptions) { o.MinLimit = -5 }), "speed limits -5-160 must be positive range"},
+		{generatorOptions(func(o *GeneratorOptions) { o.MaxLimit = 50 }), "speed limits 60-50 must be positive range"},
+	} {
+		if err := c.options.check(); err == nil || err.Error() != c.err {
+			t.Errorf("check: got %v, want %s", err, c.err)
+		}
+		if _, err := Generate(c.options, rand.New(rand.NewSource(1))); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("Generate: got %v, want %s", err, c.err)
+		}
+	}
+}
@@ -0,0 +1,579 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	GTFS_MAX_STATION_TRACKS = 4   // station tracks of stop served by many routes
+	GTFS_TURN_TIME          = 1   // minutes to rotate train on turntable
+	GTFS_REPAIR_TIME        = 30  // minutes to repair turntable or station track
+	GTFS_TRACK_REPAIR_TIME  = 60  // minutes to repair normal track
+	GTFS_TRAIN_REPAIR_TIME  = 60  // minutes to repair train
+	GTFS_CAPACITY           = 200 // seats of train, feeds do not tell them
+	GTFS_DEFAULT_LIMIT      = 60  // km/h on tracks between stops without times
+)
+
+// ImportGTFS creates railway description of GTFS static feed in zip archive of given size.
+// Stops, grouped by their parent stations, become stations with tracks between two turntables,
+// every route becomes a train running its longest trip there and back again, and normal tracks
+// join consecutive stops of routes with lengths measured along shapes and limits fast enough
+// for the fastest trip. Problems in feed files are reported as *ParseError.
+func ImportGTFS(r io.ReaderAt, size int64) (*Description, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("GTFS feed: %v", err)
+	}
+	feed := &gtfsFeed{files: make(map[string]*zip.File)}
+	for _, f := range archive.File {
+		// feeds are sometimes zipped together with their directory
+		feed.files[f.Name[strings.LastIndex(f.Name, "/")+1:]] = f
+	}
+	if err := feed.read(); err != nil {
+		return nil, err
+	}
+	return feed.describe()
+}
+
+// gtfsTable is a CSV file of feed with columns found by their names.
+type gtfsTable struct {
+	file    string
+	columns map[string]int
+	rows    [][]string
+	lines   []int // line numbers of rows
+}
+
+// get returns value of column in i-th row, empty when column is missing.
+func (t *gtfsTable) get(i int, column string) string {
+	if c, ok := t.columns[column]; ok && c < len(t.rows[i]) {
+		return strings.TrimSpace(t.rows[i][c])
+	}
+	return ""
+}
+
+func (t *gtfsTable) errorf(i int, format string, args ...interface{}) error {
+	return &ParseError{Line: t.lines[i], Section: t.file, Err: fmt.Errorf(format, args...)}
+}
+
+// table reads file of feed, which must have given columns. Missing optional file is empty table.
+func (feed *gtfsFeed) table(file string, optional bool, columns ...string) (*gtfsTable, error) {
+	t := &gtfsTable{file: file, columns: make(map[string]int)}
+	f, ok := feed.files[file]
+	if !ok {
+		if optional {
+			return t, nil
+		}
+		return nil, &ParseError{Section: file, Err: errors.New("file is missing in feed")}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, &ParseError{Section: file, Err: err}
+	}
+	defer rc.Close()
+
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, &ParseError{Line: 1, Section: file, Err: err}
+	}
+	for i, name := range header {
+		t.columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, column := range columns {
+		if _, ok := t.columns[column]; !ok {
+			return nil, &ParseError{Line: 1, Section: file, Err: fmt.Errorf("column %s is missing", column)}
+		}
+	}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return t, nil
+		} else if err != nil {
+			return nil, &ParseError{Section: file, Err: err}
+		}
+		line, _ := reader.FieldPos(0)
+		t.rows = append(t.rows, row)
+		t.lines = append(t.lines, line)
+	}
+}
+
+type gtfsStop struct {
+	id       string
+	name     string
+	lat, lon float64
+	station  *gtfsStation
+}
+
+// gtfsStation groups stops of one parent station.
+type gtfsStation struct {
+	name      string
+	routes    map[*gtfsRoute]bool
+	dwell     []float64 // minutes of stops of all trips
+	first     int       // turntables in description
+	second    int
+	described bool
+}
+
+type gtfsRoute struct {
+	id    string
+	name  string
+	trips []*gtfsTrip
+}
+
+type gtfsTrip struct {
+	id    string
+	shape string
+	times []gtfsStopTime
+}
+
+type gtfsStopTime struct {
+	stop               *gtfsStop
+	sequence           int
+	arrival, departure float64 // hours since midnight of service day, NaN when not given
+}
+
+type gtfsPoint struct {
+	lat, lon float64
+	sequence int
+}
+
+// gtfsSegment is a pair of consecutive stations of routes, joined by normal tracks.
+type gtfsSegment struct {
+	length float64 // km
+	speed  float64 // km/h of the fastest trip, 0 when unknown
+}
+
+type gtfsFeed struct {
+	files  map[string]*zip.File
+	stops  map[string]*gtfsStop
+	routes []*gtfsRoute
+	shapes map[string][]gtfsPoint
+}
+
+func (feed *gtfsFeed) read() error {
+	stops, err := feed.table("stops.txt", false, "stop_id")
+	if err != nil {
+		return err
+	}
+	routes, err := feed.table("routes.txt", false, "route_id")
+	if err != nil {
+		return err
+	}
+	trips, err := feed.table("trips.txt", false, "route_id", "trip_id")
+	if err != nil {
+		return err
+	}
+	stopTimes, err := feed.table("stop_times.txt", false, "trip_id", "stop_id", "stop_sequence")
+	if err != nil {
+		return err
+	}
+	shapes, err := feed.table("shapes.txt", true, "shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence")
+	if err != nil {
+		return err
+	}
+
+	// STOPS
+	feed.stops = make(map[string]*gtfsStop)
+	parents := make(map[*gtfsStop]string)
+	for i := range stops.rows {
+		stop := &gtfsStop{id: stops.get(i, "stop_id"), name: stops.get(i, "stop_name")}
+		stop.lat, _ = strconv.ParseFloat(stops.get(i, "stop_lat"), 64)
+		stop.lon, _ = strconv.ParseFloat(stops.get(i, "stop_lon"), 64)
+		if stop.name == "" {
+			stop.name = stop.id
+		}
+		if _, ok := feed.stops[stop.id]; ok {
+			return stops.errorf(i, "stop %s is repeated", stop.id)
+		}
+		feed.stops[stop.id] = stop
+		parents[stop] = stops.get(i, "parent_station")
+	}
+	// platforms are grouped by their parent station
+	for stop, id := range parents {
+		station := stop
+		if parent, ok := feed.stops[id]; ok {
+			station = parent
+		}
+		if station.station == nil {
+			station.station = &gtfsStation{name: station.name, routes: make(map[*gtfsRoute]bool)}
+		}
+		stop.station = station.station
+	}
+
+	// ROUTES
+	byID := make(map[string]*gtfsRoute)
+	for i := range routes.rows {
+		route := &gtfsRoute{id: routes.get(i, "route_id"), name: routes.get(i, "route_short_name")}
+		if route.name == "" {
+			route.name = routes.get(i, "route_long_name")
+		}
+		if route.name == "" {
+			route.name = route.id
+		}
+		byID[route.id] = route
+		feed.routes = append(feed.routes, route)
+	}
+
+	// TRIPS
+	tripsByID := make(map[string]*gtfsTrip)
+	for i := range trips.rows {
+		route, ok := byID[trips.get(i, "route_id")]
+		if !ok {
+			return trips.errorf(i, "route %s does not exist", trips.get(i, "route_id"))
+		}
+		trip := &gtfsTrip{id: trips.get(i, "trip_id"), shape: trips.get(i, "shape_id")}
+		route.trips = append(route.trips, trip)
+		tripsByID[trip.id] = trip
+	}
+	for i := range stopTimes.rows {
+		trip, ok := tripsByID[stopTimes.get(i, "trip_id")]
+		if !ok {
+			return stopTimes.errorf(i, "trip %s does not exist", stopTimes.get(i, "trip_id"))
+		}
+		stop, ok := feed.stops[stopTimes.get(i, "stop_id")]
+		if !ok {
+			return stopTimes.errorf(i, "stop %s does not exist", stopTimes.get(i, "stop_id"))
+		}
+		sequence, err := strconv.Atoi(stopTimes.get(i, "stop_sequence"))
+		if err != nil {
+			return stopTimes.errorf(i, "stop_sequence %q is not an integer", stopTimes.get(i, "stop_sequence"))
+		}
+		st := gtfsStopTime{stop: stop, sequence: sequence}
+		if st.arrival, err = gtfsTime(stopTimes.get(i, "arrival_time")); err != nil {
+			return stopTimes.errorf(i, "arrival_time: %v", err)
+		}
+		if st.departure, err = gtfsTime(stopTimes.get(i, "departure_time")); err != nil {
+			return stopTimes.errorf(i, "departure_time: %v", err)
+		}
+		trip.times = append(trip.times, st)
+	}
+	for _, trip := range tripsByID {
+		sort.SliceStable(trip.times, func(i, j int) bool { return trip.times[i].sequence < trip.times[j].sequence })
+	}
+
+	// SHAPES
+	feed.shapes = make(map[string][]gtfsPoint)
+	for i := range shapes.rows {
+		var p gtfsPoint
+		var errLat, errLon, errSeq error
+		p.lat, errLat = strconv.ParseFloat(shapes.get(i, "shape_pt_lat"), 64)
+		p.lon, errLon = strconv.ParseFloat(shapes.get(i, "shape_pt_lon"), 64)
+		p.sequence, errSeq = strconv.Atoi(shapes.get(i, "shape_pt_sequence"))
+		if errLat != nil || errLon != nil || errSeq != nil {
+			return shapes.errorf(i, "shape point must have numeric latitude, longitude and sequence")
+		}
+		id := shapes.get(i, "shape_id")
+		feed.shapes[id] = append(feed.shapes[id], p)
+	}
+	for _, points := range feed.shapes {
+		sort.SliceStable(points, func(i, j int) bool { return points[i].sequence < points[j].sequence })
+	}
+	return nil
+}
+
+// gtfsTime converts GTFS time hh:mm:ss, which can exceed 24 hours, to hours. Empty time is NaN.
+func gtfsTime(s string) (float64, error) {
+	if s == "" {
+		return math.NaN(), nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%q is not hh:mm:ss", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not hh:mm:ss", s)
+		}
+		v[i] = n
+	}
+	return float64(v[0]) + float64(v[1])/60 + float64(v[2])/3600, nil
+}
+
+// distance returns great-circle distance between two points in km.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const EARTH_RADIUS = 6371.0
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EARTH_RADIUS * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+// distances returns km travelled by trip between consecutive stops, measured along its shape
+// when it has one, otherwise in straight line.
+func (feed *gtfsFeed) distances(trip *gtfsTrip) []float64 {
+	distances := make([]float64, len(trip.times)-1)
+	points := feed.shapes[trip.shape]
+	// distance along shape from its start to every point
+	along := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		along[i] = along[i-1] + distance(points[i-1].lat, points[i-1].lon, points[i].lat, points[i].lon)
+	}
+	// nearest point of shape to stop, searching forward from previous stop
+	nearest := func(stop *gtfsStop, from int) int {
+		best := from
+		for i := from; i < len(points); i++ {
+			if distance(stop.lat, stop.lon, points[i].lat, points[i].lon) <
+				distance(stop.lat, stop.lon, points[best].lat, points[best].lon) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	at := 0
+	if len(points) > 0 {
+		at = nearest(trip.times[0].stop, 0)
+	}
+	for i := range distances {
+		a, b := trip.times[i].stop, trip.times[i+1].stop
+		distances[i] = distance(a.lat, a.lon, b.lat, b.lon)
+		if len(points) > 0 {
+			next := nearest(b, at)
+			if d := along[next] - along[at]; d > distances[i] {
+				distances[i] = d
+			}
+			at = next
+		}
+	}
+	return distances
+}
+
+// describe builds railway description of feed.
+func (feed *gtfsFeed) describe() (*Description, error) {
+	desc := &Description{
+		SecondsPerHour: 5,
+		Turntables:     make([]TurntableDescription, 0),
+		NormalTracks:   make([]NormalTrackDescription, 0),
+		StationTracks:  make([]StationTrackDescription, 0),
+		RepairTeams:    make([]RepairTeamDescription, 0),
+		Trains:         make([]TrainDescription, 0),
+		Workers:        make([]WorkerDescription, 0)}
+
+	// every route runs its longest trip
+	type line struct {
+		route    *gtfsRoute
+		trip     *gtfsTrip
+		stations []*gtfsStation
+	}
+	lines := make([]line, 0)
+	segments := make(map[[2]*gtfsStation]*gtfsSegment)
+	start := math.Inf(1)
+	for _, route := range feed.routes {
+		var longest *gtfsTrip
+		for _, trip := range route.trips {
+			if longest == nil || len(trip.times) > len(longest.times) {
+				longest = trip
+			}
+			// dwell times and speeds of all trips
+			for i, st := range trip.times {
+				if dwell := (st.departure - st.arrival) * 60; dwell >= 0 {
+					st.stop.station.dwell = append(st.stop.station.dwell, dwell)
+				}
+				if i == 0 && st.departure < start {
+					start = st.departure
+				}
+			}
+		}
+		if longest == nil {
+			continue
+		}
+		stations := make([]*gtfsStation, 0)
+		for _, st := range longest.times {
+			// stops at platforms of one station follow each other only in broken feeds
+			if n := len(stations); n == 0 || stations[n-1] != st.stop.station {
+				stations = append(stations, st.stop.station)
+			}
+		}
+		if len(stations) < 2 {
+			continue
+		}
+		lines = append(lines, line{route, longest, stations})
+		for _, s := range stations {
+			s.routes[route] = true
+		}
+	}
+	if len(lines) == 0 {
+		return nil, &ParseError{Section: "trips.txt", Err: errors.New("no trip stops at two stations")}
+	}
+
+	// SEGMENTS
+	segmentOf := func(a, b *gtfsStation) *gtfsSegment {
+		if s, ok := segments[[2]*gtfsStation{a, b}]; ok {
+			return s
+		}
+		s := &gtfsSegment{}
+		segments[[2]*gtfsStation{a, b}] = s
+		return s
+	}
+	for _, l := range lines {
+		for _, trip := range l.route.trips {
+			if len(trip.times) < 2 {
+				continue
+			}
+			distances := feed.distances(trip)
+			for i, d := range distances {
+				a, b := trip.times[i], trip.times[i+1]
+				if a.stop.station == b.stop.station {
+					continue
+				}
+				s := segmentOf(a.stop.station, b.stop.station)
+				if trip == l.trip || s.length == 0 {
+					s.length = d
+				}
+				if hours := b.arrival - a.departure; hours > 0 && d/hours > s.speed {
+					s.speed = d / hours
+				}
+			}
+		}
+	}
+
+	// STATIONS
+	names := make(map[string]bool)
+	unique := func(name string) string {
+		name = gtfsName(name)
+		candidate := name
+		for i := 2; names[strings.ToUpper(candidate)]; i++ {
+			candidate = fmt.Sprintf("%s-%d", name, i)
+		}
+		names[strings.ToUpper(candidate)] = true
+		return candidate
+	}
+	for _, l := range lines {
+		for _, s := range l.stations {
+			if s.described {
+				continue
+			}
+			s.described = true
+			s.first, s.second = len(desc.Turntables), len(desc.Turntables)+1
+			name := unique(s.name)
+			desc.Turntables = append(desc.Turntables,
+				TurntableDescription{s.first, GTFS_TURN_TIME, GTFS_REPAIR_TIME, unique(name + "-a")},
+				TurntableDescription{s.second, GTFS_TURN_TIME, GTFS_REPAIR_TIME, unique(name + "-b")})
+			tracks := int(math.Min(float64(len(s.routes)), GTFS_MAX_STATION_TRACKS))
+			for i := 0; i < tracks; i++ {
+				desc.StationTracks = append(desc.StationTracks, StationTrackDescription{
+					len(desc.StationTracks), name, gtfsDwell(s.dwell), GTFS_REPAIR_TIME,
+					IDRef(s.first), IDRef(s.second), ""})
+			}
+		}
+	}
+
+	// NORMAL TRACKS
+	// train goes from second turntable of station to first turntable of next one
+	// and back again along the same track, so one track serves both directions
+	tracks := make(map[[2]int]bool)
+	speeds := make([]float64, len(lines))
+	for i, l := range lines {
+		for j := 0; j+1 < len(l.stations); j++ {
+			a, b := l.stations[j], l.stations[j+1]
+			s := segmentOf(a, b)
+			if s.speed > speeds[i] {
+				speeds[i] = s.speed
+			}
+			if tracks[[2]int{a.second, b.first}] {
+				continue
+			}
+			tracks[[2]int{a.second, b.first}] = true
+			limit := GTFS_DEFAULT_LIMIT
+			if s.speed > 0 {
+				limit = 10 * int(math.Ceil(s.speed/10))
+			}
+			length := int(math.Max(1, math.Round(s.length)))
+			desc.NormalTracks = append(desc.NormalTracks, NormalTrackDescription{
+				len(desc.NormalTracks), length, limit, GTFS_TRACK_REPAIR_TIME, IDRef(a.second), IDRef(b.first)})
+		}
+	}
+
+	// TRAINS
+	starts := make(map[int]bool)
+	for i, l := range lines {
+		route := make([]int, 0)
+		n := len(l.stations)
+		if l.stations[0] == l.stations[n-1] {
+			// circular line goes round and starts again
+			for _, s := range l.stations[:n-1] {
+				route = append(route, s.first, s.second)
+			}
+		} else {
+			for _, s := range l.stations {
+				route = append(route, s.first, s.second)
+			}
+			// back through terminus and all stations in reverse
+			route = append(route, l.stations[n-1].first)
+			for j := n - 2; j > 0; j-- {
+				route = append(route, l.stations[j].second, l.stations[j].first)
+			}
+			route = append(route, l.stations[0].second)
+		}
+		first := -1
+		for j, tt := range route {
+			if !starts[tt] {
+				first = j
+				break
+			}
+		}
+		if first < 0 {
+			return nil, &ParseError{Section: "routes.txt",
+				Err: fmt.Errorf("route %s has no free turntable to start at", l.route.id)}
+		}
+		starts[route[first]] = true
+		refs := make([]Ref, len(route))
+		for j := range route {
+			refs[j] = IDRef(route[(first+j)%len(route)])
+		}
+		speed := GTFS_DEFAULT_LIMIT
+		if speeds[i] > 0 {
+			speed = 10 * int(math.Ceil(speeds[i]/10))
+		}
+		desc.Trains = append(desc.Trains, TrainDescription{
+			len(desc.Trains), speed, GTFS_CAPACITY, GTFS_TRAIN_REPAIR_TIME, unique(l.route.name), refs})
+	}
+
+	if !math.IsInf(start, 1) {
+		minutes := int(start*60) % (24 * 60)
+		desc.Clock = ClockDescription{Hours: minutes / 60, Minutes: minutes % 60}
+	}
+	return desc, nil
+}
+
+// gtfsDwell returns median of dwell times in minutes, at least one minute.
+func gtfsDwell(dwell []float64) int {
+	if len(dwell) == 0 {
+		return 1
+	}
+	sorted := append([]float64{}, dwell...)
+	sort.Float64s(sorted)
+	return int(math.Max(1, math.Round(sorted[len(sorted)/2])))
+}
+
+// gtfsName makes name usable in text railway description, as single field which is not a number.
+func gtfsName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '-'
+		}
+		return unicode.ToLower(r)
+	}, strings.TrimSpace(name))
+	name = strings.TrimLeft(name, "#")
+	if _, err := strconv.Atoi(name); err == nil || name == "" || name == "*" {
+		name = "s" + name
+	}
+	return name
+}
@@ -0,0 +1,250 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readFeed returns files of zipped GTFS feed by their names, in order of archive.
+func readFeed(t *testing.T, file string) ([]string, map[string]string) {
+	t.Helper()
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	names, files := make([]string, 0), make(map[string]string)
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, f.Name)
+		files[f.Name] = string(b)
+	}
+	return names, files
+}
+
+// importFeed zips files in order of names, skipping missing ones, and imports them as GTFS feed.
+func importFeed(t *testing.T, names []string, files map[string]string) (*Description, error) {
+	t.Helper()
+	var b bytes.Buffer
+	archive := zip.NewWriter(&b)
+	for _, name := range names {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return ImportGTFS(bytes.NewReader(b.Bytes()), int64(b.Len()))
+}
+
+func refs(ids ...int) []Ref {
+	r := make([]Ref, len(ids))
+	for i, id := range ids {
+		r[i] = IDRef(id)
+	}
+	return r
+}
+
+func TestImportGTFS(t *testing.T) {
+	// gtfs.zip has circular route Ring through platforms 1 and 2 of Central Station, North and East,
+	// which runs past midnight along shape bending away between North and East, and route 2
+	// out and back from Central Station through South to West without shape
+	names, files := readFeed(t, "testdata/gtfs.zip")
+	desc, err := importFeed(t, names, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	turntables := make([]string, len(desc.Turntables))
+	for i, tt := range desc.Turntables {
+		turntables[i] = tt.Name
+	}
+	if want := []string{"central-station-a", "central-station-b", "north-a", "north-b", "east-a", "east-b",
+		"south-a", "south-b", "west-a", "west-b"}; !reflect.DeepEqual(turntables, want) {
+		t.Errorf("turntables %v, want %v", turntables, want)
+	}
+	// both platforms belong to Central Station, which gets track for each of its two routes
+	stations := make(map[string]int)
+	for _, st := range desc.StationTracks {
+		stations[st.Name]++
+	}
+	if want := map[string]int{"central-station": 2, "north": 1, "east": 1, "south": 1, "west": 1}; !reflect.DeepEqual(stations, want) {
+		t.Errorf("station tracks %v, want %v", stations, want)
+	}
+
+	if len(desc.Trains) != 2 {
+		t.Fatalf("%d trains, want 2", len(desc.Trains))
+	}
+	for _, c := range []struct {
+		name  string
+		speed int
+		route []Ref
+	}{
+		// circular line goes round without turning back
+		{"ring", 80, refs(0, 1, 2, 3, 4, 5)},
+		// numeric route name is prefixed, out and back line starts at second turntable of Central Station
+		// as ring already starts at the first one
+		{"s2", 70, refs(1, 6, 7, 8, 9, 8, 7, 6, 1, 0)},
+	} {
+		var train *TrainDescription
+		for i := range desc.Trains {
+			if desc.Trains[i].Name == c.name {
+				train = &desc.Trains[i]
+			}
+		}
+		if train == nil {
+			t.Errorf("no train %s", c.name)
+			continue
+		}
+		if train.Speed != c.speed {
+			t.Errorf("%s: speed %d, want %d", c.name, train.Speed, c.speed)
+		}
+		if !reflect.DeepEqual(train.Route, c.route) {
+			t.Errorf("%s: route %v, want %v", c.name, train.Route, c.route)
+		}
+	}
+
+	// ring departs at 23:50, route 2 at 06:00
+	if desc.Clock.Hours != 6 || desc.Clock.Minutes != 0 {
+		t.Errorf("clock %02d:%02d, want 06:00", desc.Clock.Hours, desc.Clock.Minutes)
+	}
+
+	lengths := make(map[[2]Ref]int)
+	for _, nt := range desc.NormalTracks {
+		lengths[[2]Ref{nt.From, nt.To}] = nt.Len
+	}
+	for _, c := range []struct {
+		name     string
+		from, to int
+		len      int
+	}{
+		{"north to east along shape", 3, 4, 26},
+		{"south to west in straight line", 7, 8, int(math.Round(distance(51.9, 21.0, 51.9, 20.8)))},
+	} {
+		if l, ok := lengths[[2]Ref{IDRef(c.from), IDRef(c.to)}]; !ok {
+			t.Errorf("%s: no normal track from %d to %d", c.name, c.from, c.to)
+		} else if l != c.len {
+			t.Errorf("%s: %d km, want %d", c.name, l, c.len)
+		}
+	}
+	if straight := int(math.Round(distance(52.1, 21.0, 52.1, 21.2))); straight >= 26 {
+		t.Errorf("shape between north and east is not longer than straight line of %d km", straight)
+	}
+
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := desc.Apply(data, railway); err != nil {
+		t.Fatal(err)
+	}
+	if err := railway.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImportGTFSErrors(t *testing.T) {
+	names, files := readFeed(t, "testdata/gtfs.zip")
+	for _, c := range []struct {
+		name, file   string
+		change       func(content string) (string, bool)
+		section, err string
+		line         int
+	}{
+		{"missing file", "trips.txt", func(string) (string, bool) { return "", false },
+			"trips.txt", "trips.txt: file is missing in feed", 0},
+		{"missing column", "stop_times.txt", func(s string) (string, bool) {
+			return strings.Replace(s, ",stop_sequence\n", ",sequence\n", 1), true
+		}, "stop_times.txt", "line 1: stop_times.txt: column stop_sequence is missing", 1},
+		{"bad time", "stop_times.txt", func(s string) (string, bool) {
+			return strings.Replace(s, "T2,06:10:00", "T2,06:10", 1), true
+		}, "stop_times.txt", `line 7: stop_times.txt: arrival_time: "06:10" is not hh:mm:ss`, 7},
+		{"unknown stop", "stop_times.txt", func(s string) (string, bool) {
+			return strings.Replace(s, ",W,3", ",X,3", 1), true
+		}, "stop_times.txt", "line 8: stop_times.txt: stop X does not exist", 8},
+	} {
+		changed := make(map[string]string)
+		for name, content := range files {
+			changed[name] = content
+		}
+		if content, ok := c.change(files[c.file]); ok {
+			changed[c.file] = content
+		} else {
+			delete(changed, c.file)
+		}
+		_, err := importFeed(t, names, changed)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: error %v is not ParseError", c.name, err)
+			continue
+		}
+		if err.Error() != c.err || perr.Section != c.section || perr.Line != c.line {
+			t.Errorf("%s: got %q in %s at line %d, want %q", c.name, err, perr.Section, perr.Line, c.err)
+		}
+	}
+}
+
+func TestGTFSTime(t *testing.T) {
+	for _, c := range []struct {
+		s     string
+		hours float64
+		err   bool
+	}{
+		{"06:30:00", 6.5, false},
+		{"23:59:60", 24, false},
+		// trips after midnight of service day
+		{"25:15:36", 25.26, false},
+		{"6:05:00", 6 + 5.0/60, false},
+		{"06:30", 0, true},
+		{"06:-1:00", 0, true},
+		{"xx:00:00", 0, true},
+	} {
+		hours, err := gtfsTime(c.s)
+		if (err != nil) != c.err {
+			t.Errorf("%q: error %v, want error %v", c.s, err, c.err)
+		} else if !c.err && math.Abs(hours-c.hours) > 1e-9 {
+			t.Errorf("%q: %v hours, want %v", c.s, hours, c.hours)
+		}
+	}
+	if hours, err := gtfsTime(""); err != nil || !math.IsNaN(hours) {
+		t.Errorf("empty time: %v, %v, want NaN", hours, err)
+	}
+}
+
+func TestGTFSName(t *testing.T) {
+	for name, want := range map[string]string{
+		"Central Station": "central-station",
+		"  Łódź Kaliska ": "łódź-kaliska",
+		"12":              "s12",
+		"#5":              "s5",
+		"*":               "s*",
+		"":                "s",
+	} {
+		if got := gtfsName(name); got != want {
+			t.Errorf("%q: got %q, want %q", name, got, want)
+		}
+	}
+}
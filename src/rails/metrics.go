@@ -0,0 +1,153 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// METRICS_CONTENT_TYPE is content type of Prometheus text exposition format.
+const METRICS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// MetricsHandler serves current state of simulation in Prometheus text exposition format,
+// it is meant to be registered under /metrics. Metrics are written out whole before response
+// is sent, so failure gives status 500 instead of truncated exposition.
+func MetricsHandler(railway *RailwayData, data *SimulationData) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var b bytes.Buffer
+		if err := WriteMetrics(&b, railway, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", METRICS_CONTENT_TYPE)
+		w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+		if _, err := b.WriteTo(w); err != nil {
+			// status is already sent, so scraper can only learn from aborted connection
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// WriteMetrics writes current state of simulation to w in Prometheus text exposition format.
+func WriteMetrics(w io.Writer, railway *RailwayData, data *SimulationData) error {
+	b := bufio.NewWriter(w)
+	writeMetrics(b, railway, data)
+	return b.Flush()
+}
+
+func writeMetrics(b *bufio.Writer, railway *RailwayData, data *SimulationData) {
+	metric(b, "railway_simulated_seconds", "gauge", "Simulated time elapsed since start.")
+	fmt.Fprintf(b, "railway_simulated_seconds %g\n", data.Clock.Now().Seconds())
+
+	// trains by state, broken train is counted as broken wherever it stands
+	var moving, dwelling, broken int
+	for _, t := range railway.Trains {
+		switch {
+		case t.down.Value() != 0:
+			broken++
+		case isStationTrack(t.At()):
+			dwelling++
+		default:
+			moving++
+		}
+	}
+	metric(b, "railway_trains", "gauge", "Trains by state.")
+	fmt.Fprintf(b, "railway_trains{state=\"moving\"} %d\n", moving)
+	fmt.Fprintf(b, "railway_trains{state=\"dwelling\"} %d\n", dwelling)
+	fmt.Fprintf(b, "railway_trains{state=\"broken\"} %d\n", broken)
+
+	down := make(map[ElementKind]int64)
+	breakdowns := make(map[ElementKind]int64)
+	repairs := make(map[ElementKind]int64)
+	for _, tt := range railway.Turntables {
+		down[TurntableElement] += tt.down.Value()
+		breakdowns[TurntableElement] += tt.breakdowns.Value()
+		repairs[TurntableElement] += tt.repairs.Value()
+	}
+	for _, nt := range railway.NormalTracks {
+		down[NormalTrackElement] += nt.down.Value()
+		breakdowns[NormalTrackElement] += nt.breakdowns.Value()
+		repairs[NormalTrackElement] += nt.repairs.Value()
+	}
+	for _, st := range railway.StationTracks {
+		down[StationTrackElement] += st.down.Value()
+		breakdowns[StationTrackElement] += st.breakdowns.Value()
+		repairs[StationTrackElement] += st.repairs.Value()
+	}
+	for _, t := range railway.Trains {
+		down[TrainElement] += t.down.Value()
+		breakdowns[TrainElement] += t.breakdowns.Value()
+		repairs[TrainElement] += t.repairs.Value()
+	}
+	metric(b, "railway_broken_elements", "gauge", "Elements waiting for repair by kind.")
+	for _, kind := range failureKinds {
+		fmt.Fprintf(b, "railway_broken_elements{kind=%s} %d\n", quote(failureKind(kind)), down[kind])
+	}
+	metric(b, "railway_repair_queue", "gauge", "Failures taken by repair teams whose repair did not start yet.")
+	fmt.Fprintf(b, "railway_repair_queue %d\n", railway.repairQueue.Value())
+	metric(b, "railway_breakdowns_total", "counter", "Failures handed to repair teams by kind of element.")
+	for _, kind := range failureKinds {
+		fmt.Fprintf(b, "railway_breakdowns_total{kind=%s} %d\n", quote(failureKind(kind)), breakdowns[kind])
+	}
+	metric(b, "railway_repairs_total", "counter", "Completed repairs by kind of element.")
+	for _, kind := range failureKinds {
+		fmt.Fprintf(b, "railway_repairs_total{kind=%s} %d\n", quote(failureKind(kind)), repairs[kind])
+	}
+
+	workers := make([]int, len(workerStateNames))
+	for _, w := range railway.Workers {
+		if s := w.State(); s >= 0 && int(s) < len(workers) {
+			workers[s]++
+		}
+	}
+	metric(b, "railway_workers", "gauge", "Workers by state.")
+	for s, n := range workers {
+		fmt.Fprintf(b, "railway_workers{state=%s} %d\n", quote(WorkerState(s).String()), n)
+	}
+
+	metric(b, "railway_train_seats_occupied", "gauge", "Seats taken by workers per train.")
+	for _, t := range railway.Trains {
+		fmt.Fprintf(b, "railway_train_seats_occupied{train=\"%d\",name=%s} %d\n", t.ID(), quote(t.Name), len(t.Seats))
+	}
+	metric(b, "railway_train_seats", "gauge", "Capacity of trains.")
+	for _, t := range railway.Trains {
+		fmt.Fprintf(b, "railway_train_seats{train=\"%d\",name=%s} %d\n", t.ID(), quote(t.Name), cap(t.Seats))
+	}
+
+	metric(b, "railway_station_visits_total", "counter", "Train stops per station.")
+	for _, s := range railway.Stations {
+		fmt.Fprintf(b, "railway_station_visits_total{station=\"%d\",name=%s} %d\n", s.ID(), quote(s.Name), s.visits.Value())
+	}
+	metric(b, "railway_boardings_total", "counter", "Workers who got on trains per station.")
+	for _, s := range railway.Stations {
+		fmt.Fprintf(b, "railway_boardings_total{station=\"%d\",name=%s} %d\n", s.ID(), quote(s.Name), s.boardings.Value())
+	}
+}
+
+// metric writes HELP and TYPE lines of metric.
+func metric(b *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// quoteEscaper escapes s the same way for Prometheus label values and Graphviz quoted IDs.
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote returns s double quoted, as label value of Prometheus text format or Graphviz ID.
+func quote(s string) string { return `"` + quoteEscaper.Replace(s) + `"` }
+
+func isStationTrack(t Track) bool {
+	_, ok := t.(*StationTrack)
+	return ok
+}
@@ -0,0 +1,86 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	railway, data := runInput(t, "../../input", 7, 24, true, true)
+	handler := MetricsHandler(railway, data)
+
+	post := httptest.NewRecorder()
+	handler.ServeHTTP(post, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if post.Code != http.StatusMethodNotAllowed || post.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST: status %d, Allow %q, want 405 and GET, HEAD", post.Code, post.Header().Get("Allow"))
+	}
+
+	get := httptest.NewRecorder()
+	handler.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if get.Code != http.StatusOK {
+		t.Fatalf("GET: status %d:\n%s", get.Code, get.Body)
+	}
+	if ct := get.Header().Get("Content-Type"); ct != METRICS_CONTENT_TYPE {
+		t.Errorf("GET: content type %q, want %q", ct, METRICS_CONTENT_TYPE)
+	}
+
+	// every family has HELP and TYPE once, followed by its samples
+	families := map[string]string{
+		"railway_simulated_seconds":    "gauge",
+		"railway_trains":               "gauge",
+		"railway_broken_elements":      "gauge",
+		"railway_repair_queue":         "gauge",
+		"railway_breakdowns_total":     "counter",
+		"railway_repairs_total":        "counter",
+		"railway_workers":              "gauge",
+		"railway_train_seats_occupied": "gauge",
+		"railway_train_seats":          "gauge",
+		"railway_station_visits_total": "counter",
+		"railway_boardings_total":      "counter",
+	}
+	types, samples := make(map[string]int), make(map[string]int)
+	family := ""
+	for _, line := range strings.Split(strings.TrimSuffix(get.Body.String(), "\n"), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			family = fields[2]
+		case strings.HasPrefix(line, "# TYPE "):
+			if fields[2] != family || fields[3] != families[family] {
+				t.Errorf("%q follows HELP of %s, want type %s", line, family, families[family])
+			}
+			types[family]++
+		default:
+			name := fields[0]
+			if i := strings.IndexByte(name, '{'); i >= 0 {
+				name = name[:i]
+			}
+			if name != family {
+				t.Errorf("sample %q of %s follows HELP of %s", line, name, family)
+			}
+			samples[name]++
+		}
+	}
+	for name := range families {
+		if types[name] != 1 || samples[name] == 0 {
+			t.Errorf("%s: TYPE written %d times with %d samples", name, types[name], samples[name])
+		}
+	}
+	if len(types) != len(families) {
+		t.Errorf("families %v, want %v", types, families)
+	}
+	if want := len(railway.Trains); samples["railway_train_seats"] != want {
+		t.Errorf("seats of %d trains, want %d", samples["railway_train_seats"], want)
+	}
+
+	head := httptest.NewRecorder()
+	handler.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/metrics", nil))
+	if head.Code != http.StatusOK || head.Header().Get("Content-Type") != METRICS_CONTENT_TYPE {
+		t.Errorf("HEAD: status %d, content type %q", head.Code, head.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scanner reads railway description line by line, counting lines for error messages.
+// A Scanner must be created using NewScanner.
+type Scanner struct {
+	*bufio.Scanner
+	line int
+}
+
+// NewScanner creates pointer to new Scanner reading from r.
+func NewScanner(r io.Reader) *Scanner { return &Scanner{Scanner: bufio.NewScanner(r)} }
+
+// Scan advances to the next line, see bufio.Scanner.Scan.
+func (s *Scanner) Scan() bool {
+	if s.Scanner.Scan() {
+		s.line++
+		return true
+	}
+	return false
+}
+
+// Line returns number of the last scanned line, starting from 1.
+func (s *Scanner) Line() int { return s.line }
+
+// ParseError describes problem found in railway description.
+type ParseError struct {
+	Line    int    // line number in input, 0 when unknown
+	Section string // input section, like turntables or trains
+	Layout  string // expected layout of line in Section, empty when unknown
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	s := fmt.Sprintf("%s: %v", e.Section, e.Err)
+	if e.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", e.Line, s)
+	}
+	if e.Layout != "" {
+		s += fmt.Sprintf(" (expected: %s)", e.Layout)
+	}
+	return s
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// record is a single tokenized line of input section.
+// Conversion methods remember first error, which is returned by Err.
+type record struct {
+	fields  []string
+	names   []string // field names taken from layout
+	line    int
+	section string
+	layout  string
+	err     error
+}
+
+// readRecord scans lines until uncommented non-empty line, then tokenizes it.
+// Line must have between min and max fields, when max is 0 the line must match layout.
+func readRecord(scan *Scanner, section, layout string, min, max int) (*record, error) {
+	rec := &record{section: section, layout: layout}
+
+	for {
+		if !scan.Scan() {
+			err := scan.Err()
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			rec.line = scan.Line()
+			return nil, rec.wrap(err)
+		}
+		text := strings.TrimSpace(scan.Text())
+		if text != "" && !strings.HasPrefix(text, "#") {
+			rec.fields = strings.Fields(text)
+			break
+		}
+	}
+	rec.line = scan.Line()
+
+	if err := rec.reshape(section, layout, min, max); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// reshape makes r a line of given section and layout, checking number of its fields like readRecord.
+// It is used for lines whose layout is told by their first field.
+func (r *record) reshape(section, layout string, min, max int) error {
+	r.names = strings.Fields(strings.NewReplacer("[", "", "]", "").Replace(layout))
+	r.section, r.layout = section, layout
+	if max == 0 {
+		min, max = len(r.names), len(r.names)
+	}
+	if l := len(r.fields); l < min || l > max {
+		if min == max {
+			return r.errorf("expected %d fields, found %d", min, l)
+		} else if max == math.MaxInt32 {
+			return r.errorf("expected at least %d fields, found %d", min, l)
+		}
+		return r.errorf("expected %d to %d fields, found %d", min, max, l)
+	}
+	return nil
+}
+
+func (r *record) wrap(err error) error {
+	return &ParseError{Line: r.line, Section: r.section, Layout: r.layout, Err: err}
+}
+
+func (r *record) errorf(format string, args ...interface{}) error {
+	return r.wrap(fmt.Errorf(format, args...))
+}
+
+// name returns name of i-th field.
+func (r *record) name(i int) string {
+	if i < len(r.names) {
+		return r.names[i]
+	}
+	return r.names[len(r.names)-1]
+}
+
+// Len returns number of fields in r.
+func (r *record) Len() int { return len(r.fields) }
+
+// String returns i-th field of r.
+func (r *record) String(i int) string { return r.fields[i] }
+
+// Int returns i-th field of r as integer.
+func (r *record) Int(i int) int {
+	v, err := strconv.Atoi(r.fields[i])
+	if err != nil && r.err == nil {
+		r.err = r.errorf("field %s: %q is not an integer", r.name(i), r.fields[i])
+	}
+	return v
+}
+
+// Float returns i-th field of r as floating point number.
+func (r *record) Float(i int) float64 {
+	v, err := strconv.ParseFloat(r.fields[i], 64)
+	if err != nil && r.err == nil {
+		r.err = r.errorf("field %s: %q is not a number", r.name(i), r.fields[i])
+	}
+	return v
+}
+
+// Count returns i-th field of r as integer which must not be negative.
+func (r *record) Count(i int) int {
+	v := r.Int(i)
+	if v < 0 && r.err == nil {
+		r.err = r.errorf("field %s: %d must not be negative", r.name(i), v)
+	}
+	return v
+}
+
+// Ref returns i-th field of r resolved by resolve, used for fields holding id or name.
+func (r *record) Ref(i int, resolve func(ref string) (int, error)) int {
+	v, err := resolve(r.fields[i])
+	if err != nil && r.err == nil {
+		r.err = r.errorf("field %s: %v", r.name(i), err)
+	}
+	return v
+}
+
+// Err returns first conversion error of r.
+func (r *record) Err() error { return r.err }
@@ -0,0 +1,102 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// parse reads simulation and railway description from text.
+func parse(text string) error {
+	scan := NewScanner(strings.NewReader(text))
+	if err := (&SimulationData{}).Parse(scan); err != nil {
+		return err
+	}
+	return (&RailwayData{}).Parse(scan)
+}
+
+func TestParseErrors(t *testing.T) {
+	b, err := ioutil.ReadFile("../../input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := string(b)
+	cut := func(before string) string { return input[:strings.Index(input, before)] }
+
+	for _, c := range []struct {
+		name, text, err string
+		line            int
+	}{
+		{"truncated file", cut("3 30 80 30 3 4"),
+			"line 27: normalTracks: unexpected EOF (expected: id len limit repairTime from to)", 27},
+		{"truncated header", "5\n",
+			"line 1: simulation clock start: unexpected EOF (expected: hours minutes [simulated hours to run])", 1},
+		{"zero seconds per hour", "0\n12 00\n",
+			"line 1: seconds for hour simulation: field secondsPerHour: 0 must be positive (expected: secondsPerHour)", 1},
+		{"negative seconds per hour", "-5\n12 00\n",
+			"line 1: seconds for hour simulation: field secondsPerHour: -5 must be positive (expected: secondsPerHour)", 1},
+		{"bad count", strings.Replace(input, "1 2 8 8 7 5", "1 2 8 x 7 5", 1),
+			`line 10: amount of defined objects: field normalTracks: "x" is not an integer (expected: repairTeams trains turntables normalTracks stationTracks workers)`, 10},
+		{"negative count", strings.Replace(input, "1 2 8 8 7 5", "1 2 -8 8 7 5", 1),
+			"line 10: amount of defined objects: field turntables: -8 must not be negative (expected: repairTeams trains turntables normalTracks stationTracks workers)", 10},
+		{"missing field", strings.Replace(input, "\n3 glw 15 40 4 5", "\n3 glw 15 40 4", 1),
+			"line 40: stationTracks: expected 6 to 7 fields, found 5 (expected: id name time repairTime from to [role])", 40},
+		{"unknown station role", strings.Replace(input, "2 2 depot", "2 2 storage", 1),
+			`line 43: stationTracks: field role: unknown role "storage", expected one of: passenger, depot, freight (expected: id name time repairTime from to [role])`, 43},
+		{"unknown station", strings.Replace(input, "0 0\n1 1\n2 3", "0 0\n1 9\n2 3", 1),
+			"line 66: workers: field stationId|station: station track 9 does not exist, there are 7 (expected: id stationId|station)", 66},
+		{"unknown station name", strings.Replace(input, "0 0\n1 1\n2 3", "0 0\n1 kat\n2 3", 1),
+			`line 66: workers: field stationId|station: station "kat" does not exist (expected: id stationId|station)`, 66},
+		{"unknown route turntable", strings.Replace(input, "0 2 3 5 4 1", "0 2 3 5 4 x", 1),
+			`line 56: trains: field route: turntable "x" does not exist (expected: route by ids or names)`, 56},
+		{"unknown failure element", strings.Replace(input, "failure train * perUse", "failure bridge * perUse", 1),
+			`line 77: failures: field element: unknown element "bridge", expected one of: turntable, normalTrack, stationTrack, train (expected: failure element id|name|* model [parameters])`, 77},
+		{"unknown failure model", strings.Replace(input, "failure train * perUse", "failure train * often", 1),
+			`line 77: failures: field model: unknown failure model "often", expected: perUse probability | mtbf hours | weibull scaleHours shape [ageHours] (expected: failure element id|name|* model [parameters])`, 77},
+		{"bad failure parameter", strings.Replace(input, "failure train * perUse 0.02", "failure train * perUse abc", 1),
+			`line 77: failures: field parameters: "abc" is not a number (expected: failure element id|name|* model [parameters])`, 77},
+		{"bad failure id", strings.Replace(input, "failure normalTrack * perUse", "failure normalTrack 9 perUse", 1),
+			"line 75: failures: field id|name|*: normal track 9 does not exist, there are 8 (expected: failure element id|name|* model [parameters])", 75},
+		{"unknown line kind", strings.Replace(input, "dispatcher random 3", "dispatch random 3", 1),
+			`line 87: optional lines: unknown line kind "dispatch" (expected: failure|dispatcher|demand|job|plan [fields])`, 87},
+		{"bad dispatcher timing", strings.Replace(input, "dispatcher random 3 2", "dispatcher random 0 0", 1),
+			"line 87: dispatcher: minWait or waitSpan must be positive, jobs would be posted without time passing (expected: dispatcher policy [minWait waitSpan minWorkers workersSpan minWork workSpan])", 87},
+		{"unknown plan station", strings.Replace(input, "plan === nad 13:15", "plan === krk 13:15", 1),
+			`line 91: plan: field stationId|station: station "krk" does not exist (expected: plan trainId|train stationId|station arrival departure)`, 91},
+		{"unknown plan train", strings.Replace(input, "plan === nad 13:15", "plan xyz nad 13:15", 1),
+			`line 91: plan: field trainId|train: train "xyz" does not exist (expected: plan trainId|train stationId|station arrival departure)`, 91},
+		{"bad plan time", strings.Replace(input, "plan === nad 13:15", "plan === nad 25:15", 1),
+			`line 91: plan: field arrival: "25:15" is not a time of day, expected hh:mm[:ss] (expected: plan trainId|train stationId|station arrival departure)`, 91},
+		{"short plan line", strings.Replace(input, "plan === nad 13:15 13:25", "plan === nad 13:15", 1),
+			"line 91: plan: expected 5 fields, found 4 (expected: plan trainId|train stationId|station arrival departure)", 91},
+	} {
+		err := parse(c.text)
+		if err == nil {
+			t.Errorf("%s: no error, want %q", c.name, c.err)
+			continue
+		}
+		if err.Error() != c.err {
+			t.Errorf("%s: error %q, want %q", c.name, err, c.err)
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != c.line {
+			t.Errorf("%s: error %#v is not ParseError at line %d", c.name, err, c.line)
+		}
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	for _, file := range []string{"../../input", "../../poland"} {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parse(string(b)); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
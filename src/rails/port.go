@@ -0,0 +1,149 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"context"
+	"sync"
+)
+
+// portsLock guards waiters of all ports, hand-offs are short so one lock is enough.
+var portsLock sync.Mutex
+
+// Port is a synchronous hand-off of values between simulation goroutines, like unbuffered channel.
+// Unlike channel, goroutines waiting at ports are known to Clock, so EventClock runs them one at a time
+// in order of hand-offs and advances time only when none can go on. Waiting senders and receivers
+// are served in order of arrival. A Port must be created using NewPort.
+type Port struct {
+	senders   []*portWaiter
+	receivers []*portWaiter
+}
+
+// portWaiter is a goroutine waiting at ports.
+type portWaiter struct {
+	turn  chan bool   // closed when waiter can go on
+	value interface{} // value sent, or received once done
+	ports []*Port     // ports waiter receives from, nil for sender
+	from  int         // index of port value was received from
+	done  bool        // hand-off completed or given up
+}
+
+// NewPort creates pointer to new Port without waiting goroutines.
+func NewPort() *Port { return &Port{} }
+
+// Send hands v to goroutine receiving from p and waits until it is taken.
+// Returns false when ctx is cancelled first.
+func (p *Port) Send(ctx context.Context, clock Clock, v interface{}) bool {
+	portsLock.Lock()
+	if p.hand(clock, v) {
+		portsLock.Unlock()
+		return true
+	}
+	w := &portWaiter{turn: make(chan bool), value: v}
+	p.senders = append(p.senders, w)
+	portsLock.Unlock()
+
+	if park(ctx, clock, w.turn) == nil {
+		return true
+	}
+	portsLock.Lock()
+	defer portsLock.Unlock()
+	p.senders = without(p.senders, w)
+	w.done = true
+	return false
+}
+
+// TrySend hands v to goroutine already waiting to receive from p, reports whether there was one.
+func (p *Port) TrySend(clock Clock, v interface{}) bool {
+	portsLock.Lock()
+	defer portsLock.Unlock()
+	return p.hand(clock, v)
+}
+
+// Receive waits for value sent to p. Returns false when ctx is cancelled first.
+func (p *Port) Receive(ctx context.Context, clock Clock) (interface{}, bool) {
+	_, v, ok := receive(ctx, clock, p)
+	return v, ok
+}
+
+// hand gives v to the first goroutine waiting to receive from p, portsLock must be held.
+func (p *Port) hand(clock Clock, v interface{}) bool {
+	if len(p.receivers) == 0 {
+		return false
+	}
+	r := p.receivers[0]
+	for i, q := range r.ports {
+		if q == p {
+			r.from = i
+		}
+		q.receivers = without(q.receivers, r)
+	}
+	r.value, r.done = v, true
+	r.wake(clock)
+	return true
+}
+
+// receive waits for value sent to any of ports, earlier ports are preferred when senders wait at many.
+// Returns index of port value came from, false when ctx is cancelled first.
+func receive(ctx context.Context, clock Clock, ports ...*Port) (int, interface{}, bool) {
+	portsLock.Lock()
+	for i, p := range ports {
+		if len(p.senders) > 0 {
+			s := p.senders[0]
+			p.senders = p.senders[1:]
+			s.done = true
+			s.wake(clock)
+			portsLock.Unlock()
+			return i, s.value, true
+		}
+	}
+	w := &portWaiter{turn: make(chan bool), ports: ports}
+	for _, p := range ports {
+		p.receivers = append(p.receivers, w)
+	}
+	portsLock.Unlock()
+
+	if park(ctx, clock, w.turn) == nil {
+		return w.from, w.value, true
+	}
+	portsLock.Lock()
+	defer portsLock.Unlock()
+	for _, p := range ports {
+		p.receivers = without(p.receivers, w)
+	}
+	w.done = true
+	return -1, nil, false
+}
+
+// wake lets w go on, in its turn when clock schedules goroutines. portsLock must be held.
+func (w *portWaiter) wake(clock Clock) {
+	if s, ok := clock.(scheduler); ok {
+		s.ready(w.turn)
+	} else {
+		close(w.turn)
+	}
+}
+
+// park waits until turn is closed, letting other goroutines run meanwhile when clock schedules them.
+func park(ctx context.Context, clock Clock, turn chan bool) error {
+	if s, ok := clock.(scheduler); ok {
+		return s.wait(ctx, turn)
+	}
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// without returns waiters without w, keeping their order.
+func without(waiters []*portWaiter, w *portWaiter) []*portWaiter {
+	for i, x := range waiters {
+		if x == w {
+			return append(waiters[:i:i], waiters[i+1:]...)
+		}
+	}
+	return waiters
+}
@@ -6,20 +6,16 @@
 package rails
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-const (
-	NORMAL_TRACK_BREAK_PROBABILITY  = 0.02
-	STATION_TRACK_BREAK_PROBABILITY = 0.02
-	TURNTABLE_BREAK_PROBABILITY     = 0.005
-)
-
 type ConnectionsGraph []map[int][]Track
 
 func NewConnectionsGraph(n int) (connections ConnectionsGraph) {
@@ -40,13 +36,14 @@ type StationTrackSlice []*StationTrack
 // Track is an interface for NormalTrack, StationTrack, Turntable that enables
 // basic operations on them without knowing precise type
 type Track interface {
-	Sleep(speed int, sph int)
+	ActionTime(speed int) time.Duration
 	ID() int
-	Reserve() bool
-	Cancel()
+	Reserve(clock Clock) bool
+	Cancel(ctx context.Context, clock Clock)
 	isAvailable() bool
 	Neighbors(connections ConnectionsGraph) (ns Neighbors)
-	Simulate(railway *RailwayData, data *SimulationData)
+	Simulate(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup)
+	Stats() TrackStats
 	String() string
 	GoString() string
 }
@@ -58,16 +55,27 @@ type NormalTrack struct {
 	len        int // track length in km
 	limit      int // speed limit on track in km/h
 	repairTime int
+	random     *rand.Rand // source for break rolls, set by Simulate
+	failure    failure
 	first      *Turntable
 	second     *Turntable
-	Rider      chan *Train
-	TeamRider  chan *RepairTeam
-	Done       chan bool
-	Reserved   chan bool
+	Rider      *Port
+	TeamRider  *Port
+	Done       *Port
+	Reserved   *Port
 	Available  chan bool
-	Cancelled  chan bool
-	Repaired   chan bool
+	Cancelled  *Port
+	Repaired   *Port
 	Broke      chan *NormalTrack
+	breakdowns counter
+	repairs    counter
+	dropped    counter // failures no repair team took
+	down       gauge   // 1 while broken
+	occupied   timer   // taken by trains and repair teams
+	reserved   timer   // reserved for repair team on its way
+	broken     timer   // waiting for repair
+	waited     timer   // trains waited before they were let in
+	riders     counter // trains let in
 }
 
 // StationTrack represents Track interface implementation to stationed TrainSlice.
@@ -76,34 +84,57 @@ type StationTrack struct {
 	id         int // identification
 	stopTime   int // minimum stopTime on station in minutes
 	repairTime int
+	random     *rand.Rand // source for break rolls, set by Simulate
+	failure    failure
 	Name       string
 	first      *Turntable
 	second     *Turntable
 	station    *Station
-	Rider      chan *Train
-	TeamRider  chan *RepairTeam
-	Done       chan bool
-	Reserved   chan bool
+	Rider      *Port
+	TeamRider  *Port
+	Done       *Port
+	Reserved   *Port
 	Available  chan bool
-	Cancelled  chan bool
-	Repaired   chan bool
+	Cancelled  *Port
+	Repaired   *Port
 	Broke      chan *StationTrack
+	breakdowns counter
+	repairs    counter
+	dropped    counter // failures no repair team took
+	down       gauge   // 1 while broken
+	occupied   timer   // taken by trains and repair teams
+	reserved   timer   // reserved for repair team on its way
+	broken     timer   // waiting for repair
+	waited     timer   // trains waited before they were let in
+	riders     counter // trains let in
 }
 
 // Turntable represents Track interface implementation to rotate Train and move from one track to another.
 // Turntable is a node connecting edges in railroad representation.
 type Turntable struct {
-	id         int // identification
-	turnTime   int // minimum stopTime needed to rotate the train
+	id         int    // identification
+	Name       string // optional name, can be used instead of id in railway description
+	turnTime   int    // minimum stopTime needed to rotate the train
 	repairTime int
-	Rider      chan *Train
-	TeamRider  chan *RepairTeam
-	Done       chan bool
-	Reserved   chan bool
+	random     *rand.Rand // source for break rolls, set by Simulate
+	failure    failure
+	Rider      *Port
+	TeamRider  *Port
+	Done       *Port
+	Reserved   *Port
 	Available  chan bool
-	Cancelled  chan bool
-	Repaired   chan bool
+	Cancelled  *Port
+	Repaired   *Port
 	Broke      chan *Turntable
+	breakdowns counter
+	repairs    counter
+	dropped    counter // failures no repair team took
+	down       gauge   // 1 while broken
+	occupied   timer   // taken by trains and repair teams
+	reserved   timer   // reserved for repair team on its way
+	broken     timer   // waiting for repair
+	waited     timer   // trains waited before they were let in
+	riders     counter // trains let in
 }
 
 // NewNormalTrack creates pointer to new NormalTrack type instance.
@@ -117,14 +148,15 @@ func NewNormalTrack(id, len, limit, repTime int, fst, snd *Turntable) (nt *Norma
 		repairTime: repTime,
 		first:      fst,
 		second:     snd,
-		Rider:      make(chan *Train),
-		TeamRider:  make(chan *RepairTeam),
-		Done:       make(chan bool),
-		Reserved:   make(chan bool),
+		Rider:      NewPort(),
+		TeamRider:  NewPort(),
+		Done:       NewPort(),
+		Reserved:   NewPort(),
 		Available:  make(chan bool, 1),
-		Cancelled:  make(chan bool),
-		Repaired:   make(chan bool),
+		Cancelled:  NewPort(),
+		Repaired:   NewPort(),
 		Broke:      make(chan *NormalTrack, 1)}
+	nt.failure.model = DefaultFailure(NormalTrackElement)
 	return
 }
 
@@ -139,230 +171,367 @@ func NewStationTrack(id int, name string, time, repTime int, fst, snd *Turntable
 		Name:       strings.ToUpper(name),
 		first:      fst,
 		second:     snd,
-		Rider:      make(chan *Train),
-		TeamRider:  make(chan *RepairTeam),
-		Done:       make(chan bool),
-		Reserved:   make(chan bool),
+		Rider:      NewPort(),
+		TeamRider:  NewPort(),
+		Done:       NewPort(),
+		Reserved:   NewPort(),
 		Available:  make(chan bool, 1),
-		Cancelled:  make(chan bool),
-		Repaired:   make(chan bool),
+		Cancelled:  NewPort(),
+		Repaired:   NewPort(),
 		Broke:      make(chan *StationTrack, 1)}
+	st.failure.model = DefaultFailure(StationTrackElement)
 	return
 }
 
-// NewTurntable creates pointer to new Turntable type instance.
+// NewTurntable creates pointer to new Turntable type instance, name can be empty.
 // Created Turntable is unlocked.
 // Turntable should always be created using NewTurntable.
-func NewTurntable(id, time, repTime int) (tt *Turntable) {
+func NewTurntable(id, time, repTime int, name string) (tt *Turntable) {
 	tt = &Turntable{
 		id:         id,
+		Name:       strings.ToUpper(name),
 		turnTime:   time,
 		repairTime: repTime,
-		Rider:      make(chan *Train),
-		TeamRider:  make(chan *RepairTeam),
-		Done:       make(chan bool),
-		Reserved:   make(chan bool),
+		Rider:      NewPort(),
+		TeamRider:  NewPort(),
+		Done:       NewPort(),
+		Reserved:   NewPort(),
 		Available:  make(chan bool, 1),
-		Cancelled:  make(chan bool),
-		Repaired:   make(chan bool),
+		Cancelled:  NewPort(),
+		Repaired:   NewPort(),
 		Broke:      make(chan *Turntable, 1)}
+	tt.failure.model = DefaultFailure(TurntableElement)
 	return
 }
 
-func (nt *NormalTrack) Simulate(railway *RailwayData, data *SimulationData) {
+func (nt *NormalTrack) Simulate(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
+	defer wg.Done()
+
 	for {
 		select {
 		case <-nt.Broke:
-			select {
-			case railway.RepairChannel <- nt:
-				logger.Printf("%s %v broke", ClockTime(data), nt)
-				<-nt.Repaired
-				logger.Printf("%s %v repaired", ClockTime(data), nt)
-			default:
-				continue
+			if railway.RepairChannel.TrySend(data.Clock, nt) {
+				nt.breakdowns.inc()
+				data.publish(brokenEvent(nt))
+				nt.down.set(1)
+				broke := data.Clock.Now()
+				if !await(ctx, data.Clock, nt.Repaired) {
+					return
+				}
+				nt.down.set(0)
+				nt.broken.add(data.Clock.Now() - broke)
+				nt.repairs.inc()
+				nt.failure.repaired(data.Clock.Now())
+			} else {
+				nt.dropped.inc()
 			}
-		case <-nt.Reserved:
-			select {
-			case <-nt.Cancelled:
+			continue
+		default:
+		}
+
+		_, v, ok := receive(ctx, data.Clock, nt.Reserved, nt.Rider, nt.TeamRider)
+		if !ok {
+			return
+		}
+		switch v := v.(type) {
+		case bool: // reserved for repair team on its way
+			reserved := data.Clock.Now()
+			from, team, ok := receive(ctx, data.Clock, nt.Cancelled, nt.TeamRider)
+			if !ok {
+				return
+			} else if from == 0 {
+				nt.reserved.add(data.Clock.Now() - reserved)
 				continue
-			case rt := <-nt.TeamRider:
-				rt.Done <- true
+			}
+			rt := team.(*RepairTeam)
+			entered := data.Clock.Now()
+			nt.reserved.add(entered - reserved)
+			if !signal(ctx, data.Clock, rt.Done) {
+				return
+			}
 
-				rt.SetAt(nt)
-				logger.Printf("%s %v travels along reserved %v",
-					ClockTime(data), rt, nt)
-				nt.Sleep(rt.Speed(), data.SecondsPerHour)
+			rt.SetAt(nt)
+			data.publish(teamEvent(TeamEntered, rt, ElementOf(nt)))
+			if data.Clock.Sleep(ctx, nt.ActionTime(rt.Speed())) != nil {
+				return
+			}
 
-				nt.Done <- true
-				<-rt.Done
+			if !signal(ctx, data.Clock, nt.Done) || !await(ctx, data.Clock, rt.Done) {
+				return
+			}
+			nt.occupied.add(data.Clock.Now() - entered)
+		case *Train:
+			t := v
+			entered := data.Clock.Now()
+			nt.riders.inc()
+			if !signal(ctx, data.Clock, t.Done) {
+				return
 			}
-		case t := <-nt.Rider:
-			t.Done <- true
 
+			data.publish(trainEvent(TrainLeft, t, t.At()))
 			t.SetAt(nt)
-			logger.Printf("%s %v travels along %v",
-				ClockTime(data), t, nt)
-			nt.Sleep(t.Speed(), data.SecondsPerHour)
+			data.publish(trainEvent(TrainEntered, t, nt))
+			if data.Clock.Sleep(ctx, nt.ActionTime(t.Speed())) != nil {
+				return
+			}
 
-			nt.Done <- true
-			<-t.Done
-			if rand.Float64() < NORMAL_TRACK_BREAK_PROBABILITY {
+			if !signal(ctx, data.Clock, nt.Done) || !await(ctx, data.Clock, t.Done) {
+				return
+			}
+			nt.occupied.add(data.Clock.Now() - entered)
+			if nt.failure.breaks(nt.random, data.Clock.Now()) {
 				nt.Broke <- nt
 			}
-		case rt := <-nt.TeamRider:
-			rt.Done <- true
+		case *RepairTeam:
+			rt := v
+			entered := data.Clock.Now()
+			if !signal(ctx, data.Clock, rt.Done) {
+				return
+			}
 
 			rt.SetAt(nt)
-			logger.Printf("%s %v travels along %v",
-				ClockTime(data), rt, nt)
-			nt.Sleep(rt.Speed(), data.SecondsPerHour)
+			data.publish(teamEvent(TeamEntered, rt, ElementOf(nt)))
+			if data.Clock.Sleep(ctx, nt.ActionTime(rt.Speed())) != nil {
+				return
+			}
 
-			nt.Done <- true
-			<-rt.Done
+			if !signal(ctx, data.Clock, nt.Done) || !await(ctx, data.Clock, rt.Done) {
+				return
+			}
+			nt.occupied.add(data.Clock.Now() - entered)
 		}
 	}
 }
 
-func (st *StationTrack) Simulate(railway *RailwayData, data *SimulationData) {
+func (st *StationTrack) Simulate(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
+	defer wg.Done()
+
 	for {
 		select {
 		case <-st.Broke:
-			select {
-			case railway.RepairChannel <- st:
-				logger.Printf("%s %v broke", ClockTime(data), st)
-				<-st.Repaired
-				logger.Printf("%s %v repaired", ClockTime(data), st)
-			default:
-				continue
+			if railway.RepairChannel.TrySend(data.Clock, st) {
+				st.breakdowns.inc()
+				data.publish(brokenEvent(st))
+				st.down.set(1)
+				broke := data.Clock.Now()
+				if !await(ctx, data.Clock, st.Repaired) {
+					return
+				}
+				st.down.set(0)
+				st.broken.add(data.Clock.Now() - broke)
+				st.repairs.inc()
+				st.failure.repaired(data.Clock.Now())
+			} else {
+				st.dropped.inc()
 			}
-		case <-st.Reserved:
-			select {
-			case <-st.Cancelled:
+			continue
+		default:
+		}
+
+		_, v, ok := receive(ctx, data.Clock, st.Reserved, st.Rider, st.TeamRider)
+		if !ok {
+			return
+		}
+		switch v := v.(type) {
+		case bool: // reserved for repair team on its way
+			reserved := data.Clock.Now()
+			from, team, ok := receive(ctx, data.Clock, st.Cancelled, st.TeamRider)
+			if !ok {
+				return
+			} else if from == 0 {
+				st.reserved.add(data.Clock.Now() - reserved)
 				continue
-			case rt := <-st.TeamRider:
-				rt.Done <- true
+			}
+			rt := team.(*RepairTeam)
+			entered := data.Clock.Now()
+			st.reserved.add(entered - reserved)
+			if !signal(ctx, data.Clock, rt.Done) {
+				return
+			}
 
-				rt.SetAt(st)
-				logger.Printf("%s %v waits on reserved %v",
-					ClockTime(data), rt, st)
-				st.Sleep(rt.Speed(), data.SecondsPerHour)
+			rt.SetAt(st)
+			data.publish(teamEvent(TeamEntered, rt, ElementOf(st)))
+			if data.Clock.Sleep(ctx, st.ActionTime(rt.Speed())) != nil {
+				return
+			}
 
-				st.Done <- true
-				<-rt.Done
+			if !signal(ctx, data.Clock, st.Done) || !await(ctx, data.Clock, rt.Done) {
+				return
+			}
+			st.occupied.add(data.Clock.Now() - entered)
+		case *Train:
+			t := v
+			entered := data.Clock.Now()
+			st.riders.inc()
+			if !signal(ctx, data.Clock, t.Done) {
+				return
 			}
-		case t := <-st.Rider:
-			t.Done <- true
 
-			*data.StatisticsChannel <- fmt.Sprintf("%v\t%s >- %v\n",
-				t, ClockTime(data), st)
-			// calculate real seconds to simulate action time
+			t.visits.inc()
+			st.station.visits.inc()
+			data.publish(trainEvent(TrainLeft, t, t.At()))
 			t.SetAt(st)
-			logger.Printf("%s %v waits on %v",
-				ClockTime(data), t, st)
+			data.publish(trainEvent(TrainEntered, t, st))
+			data.publish(trainEvent(StationArrival, t, st))
+			t.planArrival(st.station, data.Clock.Now())
 
-			t.letPassengersOut(st.station, data)
-			t.validateTickets(st.station)
+			t.letPassengersOut(ctx, st.station, data)
+			t.validateTickets(st.station, data)
 
-			st.Sleep(t.Speed(), data.SecondsPerHour)
+			if data.Clock.Sleep(ctx, st.ActionTime(t.Speed())) != nil {
+				return
+			}
 
-			st.Done <- true
-			<-t.Done
-			if rand.Float64() < STATION_TRACK_BREAK_PROBABILITY {
+			if !signal(ctx, data.Clock, st.Done) || !await(ctx, data.Clock, t.Done) {
+				return
+			}
+			st.occupied.add(data.Clock.Now() - entered)
+			if st.failure.breaks(st.random, data.Clock.Now()) {
 				st.Broke <- st
 			}
-		case rt := <-st.TeamRider:
-			rt.Done <- true
+		case *RepairTeam:
+			rt := v
+			entered := data.Clock.Now()
+			if !signal(ctx, data.Clock, rt.Done) {
+				return
+			}
 
 			rt.SetAt(st)
-			logger.Printf("%s %v waits on %v",
-				ClockTime(data), rt, st)
-			st.Sleep(rt.Speed(), data.SecondsPerHour)
+			data.publish(teamEvent(TeamEntered, rt, ElementOf(st)))
+			if data.Clock.Sleep(ctx, st.ActionTime(rt.Speed())) != nil {
+				return
+			}
 
-			st.Done <- true
-			<-rt.Done
+			if !signal(ctx, data.Clock, st.Done) || !await(ctx, data.Clock, rt.Done) {
+				return
+			}
+			st.occupied.add(data.Clock.Now() - entered)
 		}
 	}
 }
 
-func (tt *Turntable) Simulate(railway *RailwayData, data *SimulationData) {
+func (tt *Turntable) Simulate(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
+	defer wg.Done()
+
 	for {
 		select {
 		case <-tt.Broke:
-			select {
-			case railway.RepairChannel <- tt:
-				logger.Printf("%s %v broke", ClockTime(data), tt)
-				<-tt.Repaired
-				logger.Printf("%s %v repaired", ClockTime(data), tt)
-			default:
-				continue
+			if railway.RepairChannel.TrySend(data.Clock, tt) {
+				tt.breakdowns.inc()
+				data.publish(brokenEvent(tt))
+				tt.down.set(1)
+				broke := data.Clock.Now()
+				if !await(ctx, data.Clock, tt.Repaired) {
+					return
+				}
+				tt.down.set(0)
+				tt.broken.add(data.Clock.Now() - broke)
+				tt.repairs.inc()
+				tt.failure.repaired(data.Clock.Now())
+			} else {
+				tt.dropped.inc()
 			}
-		case <-tt.Reserved:
-			select {
-			case <-tt.Cancelled:
+			continue
+		default:
+		}
+
+		_, v, ok := receive(ctx, data.Clock, tt.Reserved, tt.Rider, tt.TeamRider)
+		if !ok {
+			return
+		}
+		switch v := v.(type) {
+		case bool: // reserved for repair team on its way
+			reserved := data.Clock.Now()
+			from, team, ok := receive(ctx, data.Clock, tt.Cancelled, tt.TeamRider)
+			if !ok {
+				return
+			} else if from == 0 {
+				tt.reserved.add(data.Clock.Now() - reserved)
 				continue
-			case rt := <-tt.TeamRider:
-				rt.Done <- true
+			}
+			rt := team.(*RepairTeam)
+			entered := data.Clock.Now()
+			tt.reserved.add(entered - reserved)
+			if !signal(ctx, data.Clock, rt.Done) {
+				return
+			}
 
-				rt.SetAt(tt)
-				logger.Printf("%s %v rotates at reserved %v",
-					ClockTime(data), rt, tt)
-				tt.Sleep(rt.Speed(), data.SecondsPerHour)
-				tt.Done <- true
-				<-rt.Done
+			rt.SetAt(tt)
+			data.publish(teamEvent(TeamEntered, rt, ElementOf(tt)))
+			if data.Clock.Sleep(ctx, tt.ActionTime(rt.Speed())) != nil {
+				return
+			}
+			if !signal(ctx, data.Clock, tt.Done) || !await(ctx, data.Clock, rt.Done) {
+				return
+			}
+			tt.occupied.add(data.Clock.Now() - entered)
+		case *Train:
+			t := v
+			entered := data.Clock.Now()
+			tt.riders.inc()
+			if !signal(ctx, data.Clock, t.Done) {
+				return
 			}
-		case t := <-tt.Rider:
-			t.Done <- true
 
-			switch t.At().(type) {
-			// if train left station save it to timetable
+			switch from := t.At(); from.(type) {
+			case *Turntable:
+				// train starts its route here, it did not leave anything
 			case *StationTrack:
-				*data.StatisticsChannel <- fmt.Sprintf("%v\t%s -> %v\n",
-					t, ClockTime(data), t.At())
+				// if train left station save it to timetable
+				data.publish(trainEvent(TrainLeft, t, from))
+				data.publish(trainEvent(StationDeparture, t, from))
+				t.planDeparture(data.Clock.Now())
+			default:
+				data.publish(trainEvent(TrainLeft, t, from))
 			}
-			// calculate real seconds to simulate action time
 			t.SetAt(tt)
-			logger.Printf("%s %v rotates at %v",
-				ClockTime(data), t, tt)
-			tt.Sleep(t.Speed(), data.SecondsPerHour)
+			data.publish(trainEvent(TrainEntered, t, tt))
+			if data.Clock.Sleep(ctx, tt.ActionTime(t.Speed())) != nil {
+				return
+			}
 
-			tt.Done <- true
-			<-t.Done
-			if rand.Float64() < TURNTABLE_BREAK_PROBABILITY {
+			if !signal(ctx, data.Clock, tt.Done) || !await(ctx, data.Clock, t.Done) {
+				return
+			}
+			tt.occupied.add(data.Clock.Now() - entered)
+			if tt.failure.breaks(tt.random, data.Clock.Now()) {
 				tt.Broke <- tt
 			}
-		case rt := <-tt.TeamRider:
-			rt.Done <- true
+		case *RepairTeam:
+			rt := v
+			entered := data.Clock.Now()
+			if !signal(ctx, data.Clock, rt.Done) {
+				return
+			}
 
 			rt.SetAt(tt)
-			logger.Printf("%s %v rotates at %v",
-				ClockTime(data), rt, tt)
-			tt.Sleep(rt.Speed(), data.SecondsPerHour)
+			data.publish(teamEvent(TeamEntered, rt, ElementOf(tt)))
+			if data.Clock.Sleep(ctx, tt.ActionTime(rt.Speed())) != nil {
+				return
+			}
 
-			tt.Done <- true
-			<-rt.Done
+			if !signal(ctx, data.Clock, tt.Done) || !await(ctx, data.Clock, rt.Done) {
+				return
+			}
+			tt.occupied.add(data.Clock.Now() - entered)
 		}
 	}
 }
 
-// ActionTime returns stopTime in simulation hours that traveling along NormalTrack will take.
-func (nt *NormalTrack) Sleep(speed int, sph int) {
+// ActionTime returns simulated time that traveling along NormalTrack will take.
+func (nt *NormalTrack) ActionTime(speed int) time.Duration {
 	duration := float64(nt.len) / math.Min(float64(nt.limit), float64(speed))
-	sleepTime := float64(sph) * duration * 1000.0
-	time.Sleep(time.Duration(sleepTime) * time.Millisecond)
+	return time.Duration(duration * float64(time.Hour))
 }
 
-// ActionTime returns stopTime in simulation hours that stationing on StationTrack will take.
-func (st *StationTrack) Sleep(speed int, sph int) {
-	duration := float64(st.stopTime) / 60.0
-	sleepTime := float64(sph) * duration * 1000.0
-	time.Sleep(time.Duration(sleepTime) * time.Millisecond)
+// ActionTime returns simulated time that stationing on StationTrack will take.
+func (st *StationTrack) ActionTime(speed int) time.Duration {
+	return time.Duration(st.stopTime) * time.Minute
 }
 
-// ActionTime returns stopTime in simulation hours that rotating on Turntable will take.
-func (tt *Turntable) Sleep(speed int, sph int) {
-	duration := float64(tt.turnTime) / 60.0
-	sleepTime := float64(sph) * duration * 1000.0
-	time.Sleep(time.Duration(sleepTime) * time.Millisecond)
+// ActionTime returns simulated time that rotating on Turntable will take.
+func (tt *Turntable) ActionTime(speed int) time.Duration {
+	return time.Duration(tt.turnTime) * time.Minute
 }
 
 // ID returns unexported field id
@@ -374,52 +543,92 @@ func (st *StationTrack) ID() int { return st.id }
 // ID returns unexported field id
 func (tt *Turntable) ID() int { return tt.id }
 
-func (nt *NormalTrack) Reserve() bool {
+// TrackStats are utilization statistics of Track collected during simulation.
+type TrackStats struct {
+	Occupied   time.Duration // taken by trains and repair teams
+	Reserved   time.Duration // reserved for repair team on its way
+	Broken     time.Duration // waiting for repair
+	Waited     time.Duration // trains waited before they were let in, waiting for any of parallel tracks counts for the one taken
+	Riders     int64         // trains let in
+	Breakdowns int64
+}
+
+// Wait returns average time trains waited before they were let in.
+func (s TrackStats) Wait() time.Duration {
+	if s.Riders == 0 {
+		return 0
+	}
+	return s.Waited / time.Duration(s.Riders)
+}
+
+// Stats returns utilization of NormalTrack collected so far.
+func (nt *NormalTrack) Stats() TrackStats {
+	return TrackStats{nt.occupied.Value(), nt.reserved.Value(), nt.broken.Value(),
+		nt.waited.Value(), nt.riders.Value(), nt.breakdowns.Value()}
+}
+
+// Stats returns utilization of StationTrack collected so far.
+func (st *StationTrack) Stats() TrackStats {
+	return TrackStats{st.occupied.Value(), st.reserved.Value(), st.broken.Value(),
+		st.waited.Value(), st.riders.Value(), st.breakdowns.Value()}
+}
+
+// Stats returns utilization of Turntable collected so far.
+func (tt *Turntable) Stats() TrackStats {
+	return TrackStats{tt.occupied.Value(), tt.reserved.Value(), tt.broken.Value(),
+		tt.waited.Value(), tt.riders.Value(), tt.breakdowns.Value()}
+}
+
+func (nt *NormalTrack) Reserve(clock Clock) bool {
+	if !nt.Reserved.TrySend(clock, true) {
+		return false
+	}
 	select {
-	case nt.Reserved <- true:
-		select {
-		case nt.Available <- true:
-		default:
-			<-nt.Available
-			nt.Available <- true
-		}
-		return true
+	case nt.Available <- true:
 	default:
-		return false
+		<-nt.Available
+		nt.Available <- true
 	}
+	return true
 }
-func (st *StationTrack) Reserve() bool {
+func (st *StationTrack) Reserve(clock Clock) bool {
+	if !st.Reserved.TrySend(clock, true) {
+		return false
+	}
 	select {
-	case st.Reserved <- true:
-		select {
-		case st.Available <- true:
-		default:
-			<-st.Available
-			st.Available <- true
-		}
-		return true
+	case st.Available <- true:
 	default:
-		return false
+		<-st.Available
+		st.Available <- true
 	}
+	return true
 }
-func (tt *Turntable) Reserve() bool {
+func (tt *Turntable) Reserve(clock Clock) bool {
+	if !tt.Reserved.TrySend(clock, true) {
+		return false
+	}
 	select {
-	case tt.Reserved <- true:
-		select {
-		case tt.Available <- true:
-		default:
-			<-tt.Available
-			tt.Available <- true
-		}
-		return true
+	case tt.Available <- true:
 	default:
-		return false
+		<-tt.Available
+		tt.Available <- true
 	}
+	return true
 }
 
-func (nt *NormalTrack) Cancel()  { nt.Cancelled <- true }
-func (st *StationTrack) Cancel() { st.Cancelled <- true }
-func (tt *Turntable) Cancel()    { tt.Cancelled <- true }
+// Cancel gives up reservation of track, dropping its availability left unused by path search.
+func (nt *NormalTrack) Cancel(ctx context.Context, clock Clock) {
+	nt.isAvailable()
+	signal(ctx, clock, nt.Cancelled)
+}
+func (st *StationTrack) Cancel(ctx context.Context, clock Clock) {
+	st.isAvailable()
+	signal(ctx, clock, st.Cancelled)
+}
+func (tt *Turntable) Cancel(ctx context.Context, clock Clock) {
+	tt.isAvailable()
+	signal(ctx, clock, tt.Cancelled)
+}
 
 func (nt *NormalTrack) isAvailable() bool {
 	select {
@@ -460,7 +669,12 @@ func (nt *NormalTrack) String() string { return "NormalTrack" + strconv.Itoa(nt.
 func (st *StationTrack) String() string { return fmt.Sprintf("StationTrack%d %s", st.id, st.Name) }
 
 // String returns human-friendly label for Turntable
-func (tt *Turntable) String() string { return "Turntable" + strconv.Itoa(tt.id) }
+func (tt *Turntable) String() string {
+	if tt.Name != "" {
+		return fmt.Sprintf("Turntable%d %s", tt.id, tt.Name)
+	}
+	return "Turntable" + strconv.Itoa(tt.id)
+}
 
 // GoString returns more verbose human-friendly representation for NormalTrack
 func (nt *NormalTrack) GoString() string {
@@ -490,3 +704,12 @@ func (st *StationTrack) SetStation(s *Station) {
 	st.station = s
 }
 func (st *StationTrack) Station() *Station { return st.station }
+
+// signal sends true on p unless ctx is cancelled first. Returns false on cancel.
+func signal(ctx context.Context, clock Clock, p *Port) bool { return p.Send(ctx, clock, true) }
+
+// await receives from p unless ctx is cancelled first. Returns false on cancel.
+func await(ctx context.Context, clock Clock, p *Port) bool {
+	_, ok := p.Receive(ctx, clock)
+	return ok
+}
@@ -4,9 +4,11 @@
 package rails
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"hash/fnv"
+	"io"
 	"math"
 	"math/rand"
 	"strconv"
@@ -15,56 +17,86 @@ import (
 	"time"
 )
 
-var logger *log.Logger
-
 type SimulationData struct {
-	SecondsPerHour    int                // how many seconds one hour of simulation lasts
-	clock             struct{ h, m int } // simulation clock start hours and minutes
-	Start             time.Time          // simulation start time for calculating simulation clock
-	StatisticsChannel *chan string
-	SimulateRepairs   bool
-	SimulateWorkers   bool
-}
-
-func (d *SimulationData) Parse(scan *bufio.Scanner) {
-	fields, err := readFields(scan, 1)
-	check(err)
-	sph, err := strconv.Atoi(fields[0])
-	check(err)
+	SecondsPerHour  int                // how many seconds one hour of simulation lasts
+	clock           struct{ h, m int } // simulation clock start hours and minutes
+	Clock           Clock              // simulation time source, RealClock is used when nil
+	Statistics      io.Writer          // timetable of trains arrivals and departures, discarded when nil
+	SimulateRepairs bool
+	SimulateWorkers bool
+	Seed            int64         // base seed for all random sources used in simulation
+	Duration        time.Duration // simulated time after which simulation stops, 0 runs forever
+	events          *eventBus     // subscribers of state changes, set by Simulation
+}
+
+// Parse reads simulation settings from the beginning of railway description.
+func (d *SimulationData) Parse(scan *Scanner) error {
+	rec, err := readRecord(scan, "seconds for hour simulation", SECONDS_PER_HOUR_LAYOUT, 0, 0)
+	if err != nil {
+		return err
+	}
+	sph := rec.Int(0)
+	if err := rec.Err(); err != nil {
+		return err
+	}
+	if sph <= 0 {
+		return rec.errorf("field %s: %d must be positive", rec.name(0), sph)
+	}
 	d.SecondsPerHour = sph
 
-	fields, err = readFields(scan, 2)
-	check(err)
-	h, err := strconv.Atoi(fields[0])
-	check(err)
-	m, err := strconv.Atoi(fields[1])
-	check(err)
+	rec, err = readRecord(scan, "simulation clock start", CLOCK_LAYOUT, 2, 3)
+	if err != nil {
+		return err
+	}
+	h, m := rec.Int(0), rec.Int(1)
+	duration := 0
+	if rec.Len() == 3 {
+		duration = rec.Count(2)
+	}
+	if err := rec.Err(); err != nil {
+		return err
+	}
 	d.clock.h = h
 	d.clock.m = m
+	d.Duration = time.Duration(duration) * time.Hour
+	return nil
 }
 
 func (d *SimulationData) String() string {
-	return fmt.Sprintf(
+	s := fmt.Sprintf(
 		"hour takes %d seconds\n"+
 			"simulation start %02d:%02d",
 		d.SecondsPerHour, d.clock.h, d.clock.m)
+	if d.Duration > 0 {
+		s += fmt.Sprintf(" for %v", d.Duration)
+	}
+	return s
 }
 
-func ClockTime(data *SimulationData) string {
-	d := time.Since(data.Start)
+// NewRand creates random source for simulation entity of given kind and id.
+// Sources depend only on Seed, kind and id, so entities draw the same numbers in every run
+// with the same Seed. Output repeats as well only when simulation runs on EventClock.
+func (d *SimulationData) NewRand(kind string, id int) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s%d", kind, id)
+	return rand.New(rand.NewSource(d.Seed ^ int64(h.Sum64())))
+}
 
-	sH, f := math.Modf(d.Seconds() / float64(data.SecondsPerHour))
-	sM, f := math.Modf(60.0 * f)
-	sS := 60.0 * f
+// start returns simulation clock time when simulation starts.
+func (d *SimulationData) start() time.Duration {
+	return time.Duration(d.clock.h)*time.Hour + time.Duration(d.clock.m)*time.Minute
+}
 
-	h := int(sH) + data.clock.h
-	h = h % 24
-	m := int(sM) + data.clock.m
-	if m > 59 {
-		h++
-	}
-	m = m % 60
-	s := int(sS)
+// ClockTime returns current simulation clock as hh:mm:ss.
+func ClockTime(data *SimulationData) string { return data.ClockAt(data.Clock.Now()) }
+
+// ClockAt returns simulation clock as hh:mm:ss after elapsed simulated time.
+func (d *SimulationData) ClockAt(elapsed time.Duration) string {
+	t := elapsed + d.start()
+
+	h := int(t.Hours()) % 24
+	m := int(t.Minutes()) % 60
+	s := int(t.Seconds()) % 60
 
 	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
 }
@@ -77,9 +109,15 @@ type RailwayData struct {
 	StationTracks              StationTrackSlice
 	Trains                     TrainSlice
 	RepairTeams                RepairTeamSlice
-	RepairChannel              chan BrokenFella
+	RepairChannel              *Port // hands BrokenFella to repair teams
 	Stations                   StationSlice
 	Workers                    WorkerSlice
+	Failures                   map[ElementKind]FailureModel // default failure models set in description
+	Dispatcher                 Dispatcher                   // posts jobs for Workers, DefaultDispatcher is used when nil
+	jobs                       []*Job                       // jobs posted by Dispatcher, in order
+	jobsLock                   sync.Mutex
+	repairQueue                gauge         // failures taken by repair teams whose repair did not start yet
+	Plan                       []PlannedStop // planned timetable of trains, compared with actual stops
 }
 
 func (r *RailwayData) String() string {
@@ -92,198 +130,462 @@ func (r *RailwayData) String() string {
 		r.ts, r.rts, r.tts, r.nts, r.sts, r.ws)
 }
 
-// readFields scans lines until uncommented non-empty line, then tokenize it and returns
-func readFields(scan *bufio.Scanner, expected int) ([]string, error) {
-	scan.Scan()
-	text := scan.Text()
-	for strings.HasPrefix(text, "#") || text == "" {
-		scan.Scan()
-		text = scan.Text()
-	}
-	fields := strings.Fields(text)
-	if l := len(fields); l != expected {
-		return fields, fmt.Errorf("expected to read %d fields, found %d", expected, l)
-	}
-	return fields, nil
-}
-
-func (r *RailwayData) Parse(scan *bufio.Scanner) {
-	fields, err := readFields(scan, 6)
-	check(err)
-	r.rts, err = strconv.Atoi(fields[0])
-	check(err)
-	r.ts, err = strconv.Atoi(fields[1])
-	check(err)
-	r.tts, err = strconv.Atoi(fields[2])
-	check(err)
-	r.nts, err = strconv.Atoi(fields[3])
-	check(err)
-	r.sts, err = strconv.Atoi(fields[4])
-	check(err)
-	r.ws, err = strconv.Atoi(fields[5])
+// Parse reads railway elements following simulation settings in railway description.
+func (r *RailwayData) Parse(scan *Scanner) error {
+	rec, err := readRecord(scan, "amount of defined objects", AMOUNTS_LAYOUT, 0, 0)
+	if err != nil {
+		return err
+	}
+	r.rts, r.ts, r.tts = rec.Count(0), rec.Count(1), rec.Count(2)
+	r.nts, r.sts, r.ws = rec.Count(3), rec.Count(4), rec.Count(5)
+	if err := rec.Err(); err != nil {
+		return err
+	}
 
-	r.Connections = NewConnectionsGraph(r.tts)
-	r.Turntables = make(TurntableSlice, r.tts)
-	r.NormalTracks = make(NormalTrackSlice, r.nts)
-	r.StationTracks = make(StationTrackSlice, r.sts)
-	r.Trains = make(TrainSlice, r.ts)
-	r.RepairTeams = make(RepairTeamSlice, r.rts)
-	r.Workers = make(WorkerSlice, r.ws)
-	r.Stations = make(StationSlice, 0)
+	r.allocate()
 
-	r.parseTurntables(scan)
-	r.parseNormalTracks(scan)
-	r.parseStationTracks(scan)
+	if err := r.parseTurntables(scan); err != nil {
+		return err
+	}
+	if err := r.parseNormalTracks(scan); err != nil {
+		return err
+	}
+	roles, err := r.parseStationTracks(scan)
+	if err != nil {
+		return err
+	}
 	r.createStations()
-	r.parseRepairTeams(scan)
-	r.parseTrains(scan)
-	r.parseWorkers(scan)
+	if err := r.parseRepairTeams(scan); err != nil {
+		return err
+	}
+	r.assignRoles(roles)
+	if err := r.parseTrains(scan); err != nil {
+		return err
+	}
+	if err := r.parseWorkers(scan); err != nil {
+		return err
+	}
+	return r.parseOptional(scan)
 }
 
-func (r *RailwayData) parseTurntables(scan *bufio.Scanner) {
+func (r *RailwayData) parseTurntables(scan *Scanner) error {
 	for i := range r.Turntables {
-		fields, err := readFields(scan, 3)
-		check(err)
-
-		id, err := strconv.Atoi(fields[0])
-		check(err)
-		rTime, err := strconv.Atoi(fields[1])
-		check(err)
-		repTime, err := strconv.Atoi(fields[2])
-		check(err)
+		rec, err := readRecord(scan, "turntables", TURNTABLES_LAYOUT, 3, 4)
+		if err != nil {
+			return err
+		}
+		id, rTime, repTime := rec.Int(0), rec.Int(1), rec.Int(2)
+		if err := rec.Err(); err != nil {
+			return err
+		}
+		name := ""
+		if rec.Len() == 4 {
+			name = rec.String(3)
+			if err := r.checkTurntableName(name, i); err != nil {
+				return rec.errorf("field name: %v", err)
+			}
+		}
 
-		r.Turntables[i] = NewTurntable(id, rTime, repTime)
+		r.Turntables[i] = NewTurntable(id, rTime, repTime, name)
 	}
+	return nil
 }
 
-func (r *RailwayData) parseNormalTracks(scan *bufio.Scanner) {
+func (r *RailwayData) parseNormalTracks(scan *Scanner) error {
 	for i := range r.NormalTracks {
-		fields, err := readFields(scan, 6)
-		check(err)
-
-		id, err := strconv.Atoi(fields[0])
-		check(err)
-		length, err := strconv.Atoi(fields[1])
-		check(err)
-		speed, err := strconv.Atoi(fields[2])
-		check(err)
-		repTime, err := strconv.Atoi(fields[3])
-		check(err)
-		fst, err := strconv.Atoi(fields[4])
-		check(err)
-		snd, err := strconv.Atoi(fields[5])
-		check(err)
+		rec, err := readRecord(scan, "normalTracks", NORMAL_TRACKS_LAYOUT, 0, 0)
+		if err != nil {
+			return err
+		}
+		id, length, speed, repTime := rec.Int(0), rec.Int(1), rec.Int(2), rec.Int(3)
+		fst, snd := rec.Ref(4, r.turntableRef), rec.Ref(5, r.turntableRef)
+		if err := rec.Err(); err != nil {
+			return err
+		}
 
 		r.NormalTracks[i] = NewNormalTrack(id, length, speed, repTime, r.Turntables[fst], r.Turntables[snd])
-
-		r.Connections[fst][snd] = append(r.Connections[fst][snd], r.NormalTracks[i])
-		r.Connections[snd][fst] = append(r.Connections[snd][fst], r.NormalTracks[i])
+		r.connect(r.NormalTracks[i], fst, snd)
 	}
+	return nil
 }
 
-func (r *RailwayData) parseStationTracks(scan *bufio.Scanner) {
+// parseStationTracks reads station tracks and roles declared for their stations.
+func (r *RailwayData) parseStationTracks(scan *Scanner) (roles map[[2]*Turntable]Role, err error) {
+	roles = make(map[[2]*Turntable]Role)
 	for i := range r.StationTracks {
-		fields, err := readFields(scan, 6)
-		check(err)
-
-		id, err := strconv.Atoi(fields[0])
-		check(err)
-		name := fields[1]
-		sTime, err := strconv.Atoi(fields[2])
-		check(err)
-		repTime, err := strconv.Atoi(fields[3])
-		check(err)
-		fst, err := strconv.Atoi(fields[4])
-		check(err)
-		snd, err := strconv.Atoi(fields[5])
-		check(err)
+		rec, err := readRecord(scan, "stationTracks", STATION_TRACKS_LAYOUT, 6, 7)
+		if err != nil {
+			return nil, err
+		}
+		id, name, sTime, repTime := rec.Int(0), rec.String(1), rec.Int(2), rec.Int(3)
+		fst, snd := rec.Ref(4, r.turntableRef), rec.Ref(5, r.turntableRef)
+		if err := rec.Err(); err != nil {
+			return nil, err
+		}
 
 		r.StationTracks[i] = NewStationTrack(id, name, sTime, repTime, r.Turntables[fst], r.Turntables[snd])
-
-		r.Connections[fst][snd] = append(r.Connections[fst][snd], r.StationTracks[i])
-		if fst != snd {
-			r.Connections[snd][fst] = append(r.Connections[snd][fst], r.StationTracks[i])
+		r.connect(r.StationTracks[i], fst, snd)
+		if rec.Len() == 7 {
+			role, err := ParseRole(rec.String(6))
+			if err == nil {
+				err = declareRole(roles, r.StationTracks[i], role)
+			}
+			if err != nil {
+				return nil, rec.errorf("field role: %v", err)
+			}
 		}
 	}
+	return roles, nil
 }
 
-func (r *RailwayData) parseRepairTeams(scan *bufio.Scanner) {
+func (r *RailwayData) parseRepairTeams(scan *Scanner) error {
 	for i := range r.RepairTeams {
-		fields, err := readFields(scan, 3)
-		check(err)
-
-		id, err := strconv.Atoi(fields[0])
-		check(err)
-		speed, err := strconv.Atoi(fields[1])
-		check(err)
-		stationId, err := strconv.Atoi(fields[2])
-		check(err)
+		rec, err := readRecord(scan, "repairTeams", REPAIR_TEAMS_LAYOUT, 0, 0)
+		if err != nil {
+			return err
+		}
+		id, speed, stationId := rec.Int(0), rec.Int(1), rec.Ref(2, r.stationTrackRef)
+		if err := rec.Err(); err != nil {
+			return err
+		}
 
 		r.RepairTeams[i] = NewRepairTeam(id, speed, r.StationTracks[stationId])
 	}
+	return nil
 }
 
-func (r *RailwayData) parseTrains(scan *bufio.Scanner) {
+func (r *RailwayData) parseTrains(scan *Scanner) error {
 	for i := range r.Trains {
-		fields, err := readFields(scan, 6)
-		check(err)
-
-		id, err := strconv.Atoi(fields[0])
-		check(err)
-		speed, err := strconv.Atoi(fields[1])
-		check(err)
-		capacity, err := strconv.Atoi(fields[2])
-		check(err)
-		repTime, err := strconv.Atoi(fields[3])
-		check(err)
-		name := fields[4]
-		length, err := strconv.Atoi(fields[5])
-		check(err)
-
-		fields, err = readFields(scan, length)
-		check(err)
+		rec, err := readRecord(scan, "trains", TRAINS_LAYOUT, 0, 0)
+		if err != nil {
+			return err
+		}
+		id, speed, capacity, repTime := rec.Int(0), rec.Int(1), rec.Count(2), rec.Int(3)
+		name, length := rec.String(4), rec.Count(5)
+		if err := rec.Err(); err == nil && length == 0 {
+			return rec.errorf("field len(route): route must not be empty")
+		} else if err != nil {
+			return err
+		}
 
+		rec, err = readRecord(scan, "trains", ROUTE_LAYOUT, length, length)
+		if err != nil {
+			return err
+		}
+		rec.names = []string{"route"}
 		route := Route{}
 		for j := 0; j < length; j++ {
-			index, err := strconv.Atoi(fields[j])
-			check(err)
+			index := rec.Ref(j, r.turntableRef)
+			if err := rec.Err(); err != nil {
+				return err
+			}
 
 			route = append(route, r.Turntables[index])
 		}
 
-		train := NewTrain(id, speed, capacity, repTime, name, route)
+		r.addTrain(i, NewTrain(id, speed, capacity, repTime, name, route))
+	}
+	return nil
+}
 
-		prev := route[len(route)-1]
-		for i := 0; i < len(route)-1; i++ {
-			next := route[i]
-			for _, s := range r.Stations {
-				if s.Connects(prev, next) {
-					train.Connects = append(train.Connects, s)
-					s.Trains = append(s.Trains, train)
-					s.TicketsFor[train] = make(Tickets, 0)
-				}
+func (r *RailwayData) parseWorkers(scan *Scanner) error {
+	for i := range r.Workers {
+		rec, err := readRecord(scan, "workers", WORKERS_LAYOUT, 0, 0)
+		if err != nil {
+			return err
+		}
+		id, home := rec.Int(0), rec.Ref(1, r.stationTrackRef)
+		if err := rec.Err(); err != nil {
+			return err
+		}
+
+		r.addWorker(i, id, home)
+	}
+	return nil
+}
+
+// parseOptional reads optional lines ending railway description. First field of every line
+// tells its kind: failure, dispatcher, demand or job. Lines of one kind are applied in order,
+// demand and job lines must follow dispatcher line of their policy.
+func (r *RailwayData) parseOptional(scan *Scanner) error {
+	for {
+		rec, err := readRecord(scan, "optional lines", OPTIONAL_LAYOUT, 1, math.MaxInt32)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch strings.ToLower(rec.String(0)) {
+		case "failure":
+			err = r.parseFailure(rec)
+		case "dispatcher":
+			err = r.parseDispatcher(rec)
+		case "demand":
+			err = r.parseDemand(rec)
+		case "job":
+			err = r.parseJob(rec)
+		case "plan":
+			err = r.parsePlan(rec)
+		default:
+			err = rec.errorf("unknown line kind %q", rec.String(0))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *RailwayData) parseFailure(rec *record) error {
+	if err := rec.reshape("failures", FAILURES_LAYOUT, 5, 7); err != nil {
+		return err
+	}
+	parameters := make([]float64, 0)
+	for i := 4; i < rec.Len(); i++ {
+		parameters = append(parameters, rec.Float(i))
+	}
+	if err := rec.Err(); err != nil {
+		return err
+	}
+	kind, err := parseFailureKind(rec.String(1))
+	if err != nil {
+		return rec.errorf("field element: %v", err)
+	}
+	model, err := NewFailureModel(rec.String(3), parameters)
+	if err != nil {
+		return rec.errorf("field model: %v", err)
+	}
+	if err := r.SetFailure(kind, rec.String(2), model); err != nil {
+		return rec.errorf("field id|name|*: %v", err)
+	}
+	return nil
+}
+
+func (r *RailwayData) parseDispatcher(rec *record) error {
+	if err := rec.reshape("dispatcher", DISPATCHER_LAYOUT, 2, 8); err != nil {
+		return err
+	} else if l := rec.Len(); l != 2 && l != 8 {
+		return rec.errorf("expected 2 or 8 fields, found %d", l)
+	}
+	dispatcher, err := newDispatcher(rec.String(1))
+	if err != nil {
+		return rec.errorf("field policy: %v", err)
+	}
+	if rec.Len() == 8 {
+		d := timing(dispatcher)
+		if d == nil {
+			return rec.errorf("field policy: %s policy has no timing", rec.String(1))
+		}
+		d.MinWait, d.WaitSpan, d.MinWorkers = rec.Count(2), rec.Count(3), rec.Count(4)
+		d.WorkersSpan, d.MinWork, d.WorkSpan = rec.Float(5), rec.Count(6), rec.Count(7)
+		if err := rec.Err(); err != nil {
+			return err
+		}
+		if err := d.check(); err != nil {
+			return rec.errorf("%v", err)
+		}
+	}
+	r.Dispatcher = dispatcher
+	return nil
+}
+
+func (r *RailwayData) parseDemand(rec *record) error {
+	if err := rec.reshape("demand", DEMAND_LAYOUT, 0, 0); err != nil {
+		return err
+	}
+	d, ok := r.Dispatcher.(*DemandDispatcher)
+	if !ok {
+		return rec.errorf("demand can be given only after dispatcher demand line")
+	}
+	station, weight := rec.Ref(1, r.stationTrackRef), rec.Float(2)
+	if err := rec.Err(); err != nil {
+		return err
+	}
+	if !(weight >= 0) || math.IsInf(weight, 0) {
+		return rec.errorf("field weight: %v must not be negative", weight)
+	}
+	d.Demand = append(d.Demand, Demand{r.StationTracks[station].Station(), weight})
+	return nil
+}
+
+func (r *RailwayData) parseJob(rec *record) error {
+	if err := rec.reshape("jobs", JOBS_LAYOUT, 6, math.MaxInt32); err != nil {
+		return err
+	}
+	d, ok := r.Dispatcher.(*ScheduleDispatcher)
+	if !ok {
+		return rec.errorf("job can be given only after dispatcher schedule line")
+	}
+	h, m, duration := rec.Count(1), rec.Count(2), rec.Count(3)
+	station := rec.Ref(4, r.stationTrackRef)
+	workers := make(WorkerSlice, 0)
+	for i := 5; i < rec.Len(); i++ {
+		if w := rec.Ref(i, r.workerRef); rec.Err() == nil {
+			workers = append(workers, r.Workers[w])
+		}
+	}
+	if err := rec.Err(); err != nil {
+		return err
+	}
+	job, err := newScheduledJob(h, m, duration, r.StationTracks[station].Station(), workers)
+	if err != nil {
+		return rec.errorf("%v", err)
+	}
+	*d = *NewScheduleDispatcher(append(d.Jobs, job))
+	return nil
+}
+
+func (r *RailwayData) parsePlan(rec *record) error {
+	if err := rec.reshape("plan", PLAN_LAYOUT, 5, 5); err != nil {
+		return err
+	}
+	train, station := rec.Ref(1, r.trainRef), rec.Ref(2, r.stationTrackRef)
+	if err := rec.Err(); err != nil {
+		return err
+	}
+	stop, err := newPlannedStop(r.Trains[train], r.StationTracks[station].Station(), rec.String(3), rec.String(4))
+	if err != nil {
+		return rec.errorf("%v", err)
+	}
+	r.Plan = append(r.Plan, stop)
+	return nil
+}
+
+// allocate makes room for railway elements in numbers read from description.
+func (r *RailwayData) allocate() {
+	r.Connections = NewConnectionsGraph(r.tts)
+	r.Turntables = make(TurntableSlice, r.tts)
+	r.NormalTracks = make(NormalTrackSlice, r.nts)
+	r.StationTracks = make(StationTrackSlice, r.sts)
+	r.Trains = make(TrainSlice, r.ts)
+	r.RepairTeams = make(RepairTeamSlice, r.rts)
+	r.Workers = make(WorkerSlice, r.ws)
+	r.Stations = make(StationSlice, 0)
+}
+
+// connect joins turntables fst and snd with track in Connections.
+func (r *RailwayData) connect(track Track, fst, snd int) {
+	r.Connections[fst][snd] = append(r.Connections[fst][snd], track)
+	if fst != snd {
+		r.Connections[snd][fst] = append(r.Connections[snd][fst], track)
+	}
+}
+
+// addTrain puts train on i-th position and links it with stations on its route.
+// Stations must be created first.
+func (r *RailwayData) addTrain(i int, train *Train) {
+	route := train.route
+	prev := route[len(route)-1]
+	for i := 0; i < len(route); i++ {
+		next := route[i]
+		for _, s := range r.Stations {
+			if s.Connects(prev, next) {
+				train.Connects = append(train.Connects, s)
+				s.Trains = append(s.Trains, train)
+				s.TicketsFor[train] = make(Tickets, 0)
 			}
-			prev = next
 		}
+		prev = next
+	}
+
+	r.Trains[i] = train
+}
+
+// addWorker puts new worker on i-th position, living at station of home station track.
+// Stations must be created first.
+func (r *RailwayData) addWorker(i, id, home int) {
+	station := r.StationTracks[home].Station()
+	r.Workers[i] = NewWorker(id, station)
+	station.Residents = append(station.Residents, r.Workers[i])
+}
 
-		r.Trains[i] = train
+// turntableRef resolves turntable given by id or name to its position in Turntables.
+// Only turntables defined so far can be referenced.
+func (r *RailwayData) turntableRef(ref string) (int, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		if id < 0 || id >= len(r.Turntables) || r.Turntables[id] == nil {
+			return 0, fmt.Errorf("turntable %d does not exist, there are %d", id, len(r.Turntables))
+		}
+		return id, nil
+	}
+	for i, tt := range r.Turntables {
+		if tt != nil && tt.Name != "" && strings.EqualFold(tt.Name, ref) {
+			return i, nil
+		}
 	}
+	return 0, fmt.Errorf("turntable %q does not exist", ref)
 }
 
-func (r *RailwayData) parseWorkers(scan *bufio.Scanner) {
-	for i := range r.Workers {
-		fields, err := readFields(scan, 2)
-		check(err)
+// trainRef resolves train given by id or name to its position in Trains.
+func (r *RailwayData) trainRef(ref string) (int, error) {
+	if _, err := strconv.Atoi(ref); err == nil {
+		return indexRef(ref, len(r.Trains), "train")
+	}
+	for i, t := range r.Trains {
+		if t != nil && strings.EqualFold(t.Name, ref) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("train %q does not exist", ref)
+}
 
-		id, err := strconv.Atoi(fields[0])
-		check(err)
-		home, err := strconv.Atoi(fields[1])
-		check(err)
+// workerRef resolves worker given by id to its position in Workers.
+func (r *RailwayData) workerRef(ref string) (int, error) {
+	return indexRef(ref, len(r.Workers), "worker")
+}
 
-		station := r.StationTracks[home].Station()
-		r.Workers[i] = NewWorker(id, station)
-		station.Residents = append(station.Residents, r.Workers[i])
+// indexRef resolves element of given kind referenced by id to its position among n elements.
+func indexRef(ref string, n int, kind string) (int, error) {
+	id, err := strconv.Atoi(ref)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not %s id", ref, kind)
+	}
+	if id < 0 || id >= n {
+		return 0, fmt.Errorf("%s %d does not exist, there are %d", kind, id, n)
 	}
+	return id, nil
+}
+
+// stationTrackRef resolves station track given by id, or station given by name,
+// to position of the station track, or first track of the station, in StationTracks.
+// Stations must be created first.
+func (r *RailwayData) stationTrackRef(ref string) (int, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		if id < 0 || id >= len(r.StationTracks) {
+			return 0, fmt.Errorf("station track %d does not exist, there are %d", id, len(r.StationTracks))
+		}
+		return id, nil
+	}
+	var found *Station
+	for _, s := range r.Stations {
+		if strings.EqualFold(s.Name, ref) {
+			if found != nil {
+				return 0, fmt.Errorf("there are many stations named %q, use station track id", ref)
+			}
+			found = s
+		}
+	}
+	if found == nil {
+		return 0, fmt.Errorf("station %q does not exist", ref)
+	}
+	for i, st := range r.StationTracks {
+		if st == found.StationTracks[0] {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("station %q has no tracks", ref)
+}
+
+// checkTurntableName reports names which can't be used to refer to i-th turntable.
+func (r *RailwayData) checkTurntableName(name string, i int) error {
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("%q is a number, it can't be told from id", name)
+	}
+	for _, tt := range r.Turntables[:i] {
+		if strings.EqualFold(tt.Name, name) {
+			return fmt.Errorf("%q is already a name of %v", name, tt)
+		}
+	}
+	return nil
 }
 
 func (r *RailwayData) createStations() {
@@ -302,79 +604,117 @@ CreateStations:
 	}
 }
 
-func Simulate(railway *RailwayData, data *SimulationData, log *log.Logger, wg *sync.WaitGroup) {
-	logger = log
+// declareRole remembers role declared for station of st in roles,
+// reporting roles different from declared for other tracks of the station.
+func declareRole(roles map[[2]*Turntable]Role, st *StationTrack, role Role) error {
+	key := [2]*Turntable{st.first, st.second}
+	if declared, ok := roles[key]; ok && declared != role {
+		return fmt.Errorf("%v is %v, but other track of its station is %v", st, role, declared)
+	}
+	roles[key] = role
+	return nil
+}
 
-	// START SIMULATION
-	data.Start = time.Now()
+// assignRoles sets declared roles of stations, stations without declared role are depots
+// when repair team is based there, otherwise passenger stations.
+// Repair teams must be created first.
+func (r *RailwayData) assignRoles(roles map[[2]*Turntable]Role) {
+	for _, s := range r.Stations {
+		if role, ok := roles[[2]*Turntable{s.first, s.second}]; ok {
+			s.Role = role
+		} else {
+			s.Role = r.defaultRole(s)
+		}
+	}
+}
+
+// defaultRole returns role of station s when none is declared.
+func (r *RailwayData) defaultRole(s *Station) Role {
+	for _, rt := range r.RepairTeams {
+		if rt.station.station == s {
+			return Depot
+		}
+	}
+	return Passenger
+}
+
+// simulate starts goroutines for every simulated entity and returns immediately.
+// All goroutines are added to wg and return once ctx is cancelled or Duration passes.
+// Clock and events of data must be set up by Simulation first.
+func simulate(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
+	if railway.RepairChannel == nil {
+		railway.RepairChannel = NewPort()
+	}
+	goroutines := make([]func(), 0)
+	run := func(f func()) {
+		wg.Add(1)
+		goroutines = append(goroutines, f)
+	}
+
+	// DURATION
+	if data.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		run(func() {
+			defer wg.Done()
+			defer cancel()
+			if data.Clock.Sleep(ctx, data.Duration) == nil {
+				data.publish(NewEvent(SimulationEnded))
+			}
+		})
+	}
 	// TURNTABLES
 	for _, t := range railway.Turntables {
-		go t.Simulate(railway, data)
+		t := t
+		t.random = data.NewRand("Turntable", t.id)
+		run(func() { t.Simulate(ctx, railway, data, wg) })
 	}
 	// NORMAL TRACKS
 	for _, nt := range railway.NormalTracks {
-		go nt.Simulate(railway, data)
+		nt := nt
+		nt.random = data.NewRand("NormalTrack", nt.id)
+		run(func() { nt.Simulate(ctx, railway, data, wg) })
 	}
 	// STATION TRACKS
 	for _, st := range railway.StationTracks {
-		go st.Simulate(railway, data)
+		st := st
+		st.random = data.NewRand("StationTrack", st.id)
+		run(func() { st.Simulate(ctx, railway, data, wg) })
 	}
 	// REPAIR TEAMS
 	if data.SimulateRepairs {
 		for _, rt := range railway.RepairTeams {
-			go rt.Simulate(railway, data)
+			rt := rt
+			run(func() { rt.Simulate(ctx, railway, data, wg) })
 		}
 	}
 	// TRAINS
 	for _, t := range railway.Trains {
-		go t.Simulate(railway, data, wg)
+		t := t
+		t.random = data.NewRand("Train", t.id)
+		run(func() { t.Simulate(ctx, railway, data, wg) })
 	}
 	if data.SimulateWorkers {
 		// WORKERS
 		for _, w := range railway.Workers {
-			go w.Simulate(railway, data)
+			w := w
+			run(func() { w.Simulate(ctx, railway, data, wg) })
 		}
 		// DISPATCHER
-		const (
-			MIN_WAIT_H                    = 3
-			WAIT_SPAN_H                   = 2
-			MIN_WORKERS           float64 = 2
-			WORKERS_SPAN_FRACTION         = 0.25
-			MIN_WORK_M                    = 30
-			WORK_SPAN_M                   = 60
-		)
-		go func() {
-			workers_span := int(WORKERS_SPAN_FRACTION * float64(len(railway.Workers)))
-			for {
-				// wait couple hours between jobs
-				duration := MIN_WAIT_H + rand.Intn(WAIT_SPAN_H+1)
-				breakTime := data.SecondsPerHour * duration * 1000.0
-				time.Sleep(time.Duration(breakTime) * time.Millisecond)
-				// choose number of workers for the job
-				n := int(math.Min(
-					MIN_WORKERS+float64(rand.Intn(workers_span)),
-					float64(len(railway.Workers))))
-				subset := railway.Workers.Subset(n)
-				// only if all workers chosen ara available
-				if subset.available() {
-					// avoid working at depots
-					m := rand.Intn(len(railway.Stations) - railway.rts)
-					workplace := railway.Stations[m]
-					// work for some random time
-					workTime := MIN_WORK_M + rand.Intn(WORK_SPAN_M+1)
-
-					job := NewJob(workTime, workplace, subset)
-					for _, w := range subset {
-						w.Work <- job
-					}
-				}
-			}
-		}()
+		run(func() { dispatch(ctx, railway, data, wg) })
 	}
-}
 
-func check(e error) {
-	if e != nil {
-		panic(e)
+	// START SIMULATION
+	// scheduling clock starts once every goroutine is spawned, so that none is left behind at start
+	if s, ok := data.Clock.(scheduler); ok {
+		for _, f := range goroutines {
+			s.spawn(ctx, f)
+		}
+		data.Clock.Start(ctx)
+	} else {
+		data.Clock.Start(ctx)
+		for _, f := range goroutines {
+			go f()
+		}
 	}
 }
@@ -0,0 +1,172 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runOutputs simulates railway described in file on EventClock for given hours
+// and returns its statistics and report.
+func runOutputs(t *testing.T, file string, seed int64, hours int, repairs, workers bool) (string, string) {
+	t.Helper()
+	in, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	var timetable, report bytes.Buffer
+	data := &SimulationData{Statistics: &timetable, Clock: NewEventClock(), Seed: seed,
+		SimulateRepairs: repairs, SimulateWorkers: workers}
+	railway := &RailwayData{}
+	scan := NewScanner(in)
+	if err := data.Parse(scan); err != nil {
+		t.Fatal(err)
+	}
+	if err := railway.Parse(scan); err != nil {
+		t.Fatal(err)
+	}
+	data.Duration = time.Duration(hours) * time.Hour
+
+	simulation := NewSimulation(railway, data)
+	if err := simulation.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-simulation.Done():
+	case <-time.After(time.Minute):
+		simulation.Stop()
+		t.Fatalf("%s: simulation of %dh did not end", file, hours)
+	}
+	if err := simulation.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteReport(&report, railway, data); err != nil {
+		t.Fatal(err)
+	}
+	return timetable.String(), report.String()
+}
+
+// runInput runs railway described in file on EventClock for given hours, passing events to sinks,
+// and returns it when simulation ends.
+func runInput(t *testing.T, file string, seed int64, hours int, repairs, workers bool, sinks ...Sink) (*RailwayData, *SimulationData) {
+	t.Helper()
+	in, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := Load(in, FormatOf(file), data, railway); err != nil {
+		t.Fatal(err)
+	}
+	data.Clock = NewEventClock()
+	data.Seed = seed
+	data.Duration = time.Duration(hours) * time.Hour
+	data.SimulateRepairs, data.SimulateWorkers = repairs, workers
+
+	simulation := NewSimulation(railway, data)
+	for _, sink := range sinks {
+		if err := simulation.AddSink(sink); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := simulation.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-simulation.Done():
+	case <-time.After(time.Minute):
+		simulation.Stop()
+		t.Fatalf("%s: simulation of %dh did not end", file, hours)
+	}
+	if err := simulation.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return railway, data
+}
+
+func TestSameSeedGivesSameOutput(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	for _, run := range []struct {
+		file  string
+		seed  int64
+		hours int
+	}{{"../../input", 0, 48}, {"../../input", 7, 48}, {"../../poland", 42, 72}} {
+		timetable, report := runOutputs(t, run.file, run.seed, run.hours, true, true)
+		if strings.Count(timetable, "\n") < 10 {
+			t.Fatalf("%s: timetable has too few lines:\n%s", run.file, timetable)
+		}
+		timetable2, report2 := runOutputs(t, run.file, run.seed, run.hours, true, true)
+		if timetable2 != timetable {
+			t.Errorf("%s seed %d: timetables differ:\n%s\nand:\n%s", run.file, run.seed, timetable, timetable2)
+		}
+		if report2 != report {
+			t.Errorf("%s seed %d: reports differ:\n%s\nand:\n%s", run.file, run.seed, report, report2)
+		}
+	}
+}
+
+func TestNewRandDependsOnSeedKindAndId(t *testing.T) {
+	draw := func(seed int64, kind string, id int) int64 {
+		data := &SimulationData{Seed: seed}
+		return data.NewRand(kind, id).Int63()
+	}
+	if draw(0, "Train", 1) != draw(0, "Train", 1) {
+		t.Error("same seed, kind and id gave different numbers")
+	}
+	for _, other := range []int64{draw(1, "Train", 1), draw(0, "RepairTeam", 1), draw(0, "Train", 2)} {
+		if other == draw(0, "Train", 1) {
+			t.Error("different seed, kind or id gave the same number")
+		}
+	}
+}
+
+func TestSimulationStopsOnCancel(t *testing.T) {
+	in, err := os.Open("../../input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	var timetable bytes.Buffer
+	data := &SimulationData{Statistics: &timetable, Clock: NewEventClock(), Seed: 7,
+		SimulateRepairs: true, SimulateWorkers: true}
+	railway := &RailwayData{}
+	scan := NewScanner(in)
+	if err := data.Parse(scan); err != nil {
+		t.Fatal(err)
+	}
+	if err := railway.Parse(scan); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	simulation := NewSimulation(railway, data)
+	if err := simulation.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); data.Clock.Now() < 24*time.Hour; {
+		if time.Now().After(deadline) {
+			t.Fatalf("simulated time stopped at %v", data.Clock.Now())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-simulation.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("simulation goroutines did not return after cancel")
+	}
+	if timetable.Len() == 0 {
+		t.Error("no train stopped at station before cancel")
+	}
+}
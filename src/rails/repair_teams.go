@@ -4,16 +4,21 @@
 package rails
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 )
 
+// PATH_RETRY is how long RepairTeam waits for tracks to free up when it found no path.
+const PATH_RETRY = 15 * time.Minute
+
 type Neighbors []Track
 type Path []Track
 
 type BrokenFella interface {
 	RepairTime() float64
-	Repair()
+	Repair(ctx context.Context, clock Clock) bool // returns false when ctx is cancelled first
 	Neighbors(connections ConnectionsGraph) (ns Neighbors)
 }
 
@@ -22,18 +27,27 @@ func (tt *Turntable) RepairTime() float64    { return float64(tt.repairTime) / 6
 func (nt *NormalTrack) RepairTime() float64  { return float64(nt.repairTime) / 60.0 }
 func (st *StationTrack) RepairTime() float64 { return float64(st.repairTime) / 60.0 }
 
-func (t *Train) Repair()         { t.Repaired <- true }
-func (tt *Turntable) Repair()    { tt.Repaired <- true }
-func (nt *NormalTrack) Repair()  { nt.Repaired <- true }
-func (st *StationTrack) Repair() { st.Repaired <- true }
+func (t *Train) Repair(ctx context.Context, clock Clock) bool {
+	return signal(ctx, clock, t.Repaired)
+}
+func (tt *Turntable) Repair(ctx context.Context, clock Clock) bool {
+	return signal(ctx, clock, tt.Repaired)
+}
+func (nt *NormalTrack) Repair(ctx context.Context, clock Clock) bool {
+	return signal(ctx, clock, nt.Repaired)
+}
+func (st *StationTrack) Repair(ctx context.Context, clock Clock) bool {
+	return signal(ctx, clock, st.Repaired)
+}
 
 func (t *Train) Neighbors(connections ConnectionsGraph) (ns Neighbors) {
-	pos := t.at
+	pos := t.At()
 	return pos.(BrokenFella).Neighbors(connections)
 }
 func (tt *Turntable) Neighbors(connections ConnectionsGraph) (ns Neighbors) {
 	i := tt.id
-	for j := range connections[i] {
+	// walk turntables in order, map iteration would make paths differ between runs
+	for j := range connections {
 		for _, track := range connections[i][j] {
 			ns = append(ns, track)
 		}
@@ -50,11 +64,47 @@ func (st *StationTrack) Neighbors(connections ConnectionsGraph) (ns Neighbors) {
 }
 
 type RepairTeam struct {
-	id      int // Train's identification
-	speed   int // maximum speed in km/h
-	station *StationTrack
-	at      Track // current position, Track the repair team occupies
-	Done    chan bool
+	id        int // Train's identification
+	speed     int // maximum speed in km/h
+	station   *StationTrack
+	at        position // current position, Track the repair team occupies
+	Done      *Port
+	retries   counter                      // searches for path to broken element or back to depot which found none
+	stats     map[ElementKind]*RepairStats // completed repairs by kind of repaired element
+	statsLock sync.Mutex
+}
+
+// RepairStats sums times of repairs completed by repair teams.
+type RepairStats struct {
+	Repairs  int64
+	Dispatch time.Duration // from taking failure until setting off, spent on reserving tracks and finding path
+	Travel   time.Duration // from setting off until start of repair
+	Repair   time.Duration // repairing
+	Downtime time.Duration // from taking failure until element is repaired
+	Busy     time.Duration // from taking failure until team is back at depot
+}
+
+func (s *RepairStats) add(o RepairStats) {
+	s.Repairs += o.Repairs
+	s.Dispatch += o.Dispatch
+	s.Travel += o.Travel
+	s.Repair += o.Repair
+	s.Downtime += o.Downtime
+	s.Busy += o.Busy
+}
+
+// MTTR returns mean time to repair, from taking failure until element is repaired.
+func (s RepairStats) MTTR() time.Duration {
+	if s.Repairs == 0 {
+		return 0
+	}
+	return s.Downtime / time.Duration(s.Repairs)
+}
+
+// repairRecord collects times of one repair.
+type repairRecord struct {
+	kind                                 ElementKind
+	taken, dispatched, started, finished time.Duration
 }
 
 func NewRepairTeam(id, speed int, station *StationTrack) (team *RepairTeam) {
@@ -62,152 +112,209 @@ func NewRepairTeam(id, speed int, station *StationTrack) (team *RepairTeam) {
 		id:      id,
 		speed:   speed,
 		station: station,
-		at:      station,
-		Done:    make(chan bool)}
+		Done:    NewPort(),
+		stats:   make(map[ElementKind]*RepairStats)}
+	team.at.Set(station)
 	return
 }
 
-func (rt *RepairTeam) Simulate(railway *RailwayData, data *SimulationData) {
-Loop:
-	rt.Station().TeamRider <- rt
-	<-rt.Done
-	<-rt.Station().Done
+func (rt *RepairTeam) Simulate(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
+	defer wg.Done()
 
+	if !rt.Station().TeamRider.Send(ctx, data.Clock, rt) {
+		return
+	}
+	if !await(ctx, data.Clock, rt.Done) || !await(ctx, data.Clock, rt.Station().Done) {
+		return
+	}
+
+Loop:
 	for {
-		client := <-railway.RepairChannel
-		logger.Printf("%s %v prepares to repair %v",
-			ClockTime(data), rt, client)
+		v, ok := railway.RepairChannel.Receive(ctx, data.Clock)
+		if !ok {
+			return
+		}
+		client := v.(BrokenFella)
+		record := &repairRecord{kind: ElementOf(client).Kind, taken: data.Clock.Now()}
+		railway.repairQueue.add(1)
 		destinations := client.Neighbors(railway.Connections)
 
 		for _, d := range destinations {
 			if rt.Station() == d {
-				logger.Printf("%s %v repairs %v from depot", ClockTime(data), rt, client)
-				repairTime := float64(data.SecondsPerHour) * client.RepairTime() * 1000.0
-				time.Sleep(time.Duration(repairTime) * time.Millisecond)
-				client.Repair()
-				goto Loop
+				data.publish(teamEvent(RepairDispatched, rt, ElementOf(client)))
+				record.dispatched = data.Clock.Now()
+				railway.repairQueue.add(-1)
+				if !rt.repair(ctx, client, d, data, record) {
+					return
+				}
+				rt.record(record, data.Clock.Now())
+				continue Loop
 			}
 		}
 
-		reserved := make([]Track, 0)
-
-		// Reservations
-		for _, nt := range railway.NormalTracks {
-			if nt == client {
-				continue
-			} else if nt.Reserve() {
-				reserved = append(reserved, nt)
-			}
+		path, ok := rt.findPath(ctx, railway, data, client, rt.Station(), destinations)
+		if !ok {
+			return
 		}
-		for _, st := range railway.StationTracks {
-			if st == client {
-				continue
-			} else if st.Reserve() {
-				reserved = append(reserved, st)
-			}
+
+		dispatched := teamEvent(RepairDispatched, rt, ElementOf(client))
+		for _, t := range path {
+			dispatched.Path = append(dispatched.Path, ElementOf(t))
 		}
-		for _, tt := range railway.Turntables {
-			if tt == client {
-				continue
-			} else if tt.Reserve() {
-				reserved = append(reserved, tt)
+		data.publish(dispatched)
+		record.dispatched = data.Clock.Now()
+
+		for _, track := range path[1:] {
+			if !rt.ride(ctx, data, track) {
+				return
 			}
 		}
+		railway.repairQueue.add(-1)
 
-		resp := make(chan Path)
-		go SearchForPath(Path{rt.Station()}, rt.Station(), destinations, resp, railway.Connections)
-		path := <-resp
-
-		logString := fmt.Sprintf("%s %v found path to faulty %v:\n",
-			ClockTime(data), rt, client)
-		for i, t := range path {
-			logString += fmt.Sprintf("%d. %v\n", i, t)
+		if !rt.repair(ctx, client, path[len(path)-1], data, record) {
+			return
 		}
 
-		logger.Print(logString)
-
-	ForAllReserved:
-		for _, r := range reserved {
-			for _, t := range path {
-				if r == t {
-					continue ForAllReserved
-				}
-			}
-			r.Cancel()
+		// go back to depot along tracks reserved the same way, team stands at the last track of path
+		back, ok := rt.findPath(ctx, railway, data, nil, path[len(path)-1], Neighbors{rt.Station()})
+		if !ok {
+			return
 		}
-
-		for _, track := range path[1:] {
-			switch track.(type) {
-			case *StationTrack:
-				track := track.(*StationTrack)
-				track.TeamRider <- rt
-				<-track.Done
-			case *NormalTrack:
-				track := track.(*NormalTrack)
-				track.TeamRider <- rt
-				<-track.Done
-			case *Turntable:
-				track := track.(*Turntable)
-				track.TeamRider <- rt
-				<-track.Done
+		for _, track := range back[1:] {
+			if !rt.ride(ctx, data, track) {
+				return
 			}
 		}
+		data.publish(teamEvent(TeamReturned, rt, ElementOf(rt.Station())))
+		rt.record(record, data.Clock.Now())
+	}
+}
 
-		logger.Printf("%s %v repairs %v from %v", ClockTime(data), rt, client, path[len(path)-1])
-		repairTime := float64(data.SecondsPerHour) * client.RepairTime() * 1000.0
-		time.Sleep(time.Duration(repairTime) * time.Millisecond)
-		client.Repair()
-
-		for i := range path[1 : len(path)-1] {
-			track := path[len(path)-1-i]
-			switch track.(type) {
-			case *StationTrack:
-				track := track.(*StationTrack)
-			Loop1:
-				for {
-					for _, sibling := range track.Siblings(railway.Connections) {
-						st := sibling.(*StationTrack)
-						select {
-						case st.TeamRider <- rt:
-							<-st.Done
-							break Loop1
-						default:
-							continue
-						}
-					}
-				}
-			case *NormalTrack:
-				track := track.(*NormalTrack)
-			Loop2:
-				for {
-					for _, sibling := range track.Siblings(railway.Connections) {
-						nt := sibling.(*NormalTrack)
-						select {
-						case nt.TeamRider <- rt:
-							<-nt.Done
-							break Loop2
-						default:
-							continue
-						}
+// findPath reserves free tracks and returns path along them from track from to any of destinations,
+// giving reserved tracks off path back. While no path is free, all reserved tracks are given back
+// to trains and search is repeated after PATH_RETRY. Returns false when ctx is cancelled first.
+func (rt *RepairTeam) findPath(ctx context.Context, railway *RailwayData, data *SimulationData,
+	client BrokenFella, from Track, destinations Neighbors) (Path, bool) {
+	for {
+		reserved := rt.reserve(railway, data, client)
+		if path := SearchForPath(Path{from}, from, destinations, railway.Connections); path != nil {
+		ForAllReserved:
+			for _, r := range reserved {
+				for _, t := range path {
+					if r == t {
+						continue ForAllReserved
 					}
 				}
-			case *Turntable:
-				track := track.(*Turntable)
-				track.TeamRider <- rt
-				<-track.Done
+				r.Cancel(ctx, data.Clock)
 			}
+			return path, true
+		}
+		for _, r := range reserved {
+			r.Cancel(ctx, data.Clock)
+		}
+		rt.retries.inc()
+		if data.Clock.Sleep(ctx, PATH_RETRY) != nil {
+			return nil, false
+		}
+	}
+}
+
+// reserve reserves all free tracks but client for the way of rt, returns reserved tracks.
+func (rt *RepairTeam) reserve(railway *RailwayData, data *SimulationData, client BrokenFella) []Track {
+	reserved := make([]Track, 0)
+	for _, nt := range railway.NormalTracks {
+		if nt == client {
+			continue
+		} else if nt.Reserve(data.Clock) {
+			reserved = append(reserved, nt)
+		}
+	}
+	for _, st := range railway.StationTracks {
+		if st == client {
+			continue
+		} else if st.Reserve(data.Clock) {
+			reserved = append(reserved, st)
+		}
+	}
+	for _, tt := range railway.Turntables {
+		if tt == client {
+			continue
+		} else if tt.Reserve(data.Clock) {
+			reserved = append(reserved, tt)
 		}
+	}
+	return reserved
+}
+
+// record adds times of completed repair to statistics of team, team came back to depot at returned.
+func (rt *RepairTeam) record(r *repairRecord, returned time.Duration) {
+	rt.statsLock.Lock()
+	defer rt.statsLock.Unlock()
+	s, ok := rt.stats[r.kind]
+	if !ok {
+		s = &RepairStats{}
+		rt.stats[r.kind] = s
+	}
+	s.add(RepairStats{
+		Repairs:  1,
+		Dispatch: r.dispatched - r.taken,
+		Travel:   r.started - r.dispatched,
+		Repair:   r.finished - r.started,
+		Downtime: r.finished - r.taken,
+		Busy:     returned - r.taken})
+}
+
+// Stats returns statistics of repairs completed by team so far, by kind of repaired element.
+func (rt *RepairTeam) Stats() map[ElementKind]RepairStats {
+	rt.statsLock.Lock()
+	defer rt.statsLock.Unlock()
+	stats := make(map[ElementKind]RepairStats, len(rt.stats))
+	for kind, s := range rt.stats {
+		stats[kind] = *s
+	}
+	return stats
+}
+
+// repair fixes client while standing at track, publishing start and finish of repair
+// and noting their times in record. Returns false when ctx is cancelled first.
+func (rt *RepairTeam) repair(ctx context.Context, client BrokenFella, track Track, data *SimulationData, record *repairRecord) bool {
+	started := teamEvent(RepairStarted, rt, ElementOf(client))
+	started.From = ElementOf(track)
+	data.publish(started)
+	record.started = data.Clock.Now()
+	if data.Clock.Sleep(ctx, hours(client.RepairTime())) != nil || !client.Repair(ctx, data.Clock) {
+		return false
+	}
+	record.finished = data.Clock.Now()
+	data.publish(teamEvent(RepairFinished, rt, ElementOf(client)))
+	return true
+}
 
-		rt.Station().TeamRider <- rt
-		<-rt.Station().Done
-		logger.Printf("%s %v returned to depot", ClockTime(data), rt)
+// ride moves RepairTeam onto track, waiting until it is let through.
+// Returns false when ctx is cancelled first.
+func (rt *RepairTeam) ride(ctx context.Context, data *SimulationData, track Track) bool {
+	var teamRider, done *Port
+	switch track.(type) {
+	case *StationTrack:
+		track := track.(*StationTrack)
+		teamRider, done = track.TeamRider, track.Done
+	case *NormalTrack:
+		track := track.(*NormalTrack)
+		teamRider, done = track.TeamRider, track.Done
+	case *Turntable:
+		track := track.(*Turntable)
+		teamRider, done = track.TeamRider, track.Done
 	}
+	if !teamRider.Send(ctx, data.Clock, rt) {
+		return false
+	}
+	return await(ctx, data.Clock, done)
 }
 
 func (rt *RepairTeam) Station() *StationTrack { return rt.station }
 func (rt *RepairTeam) Speed() int             { return rt.speed }
-func (rt *RepairTeam) At() Track              { return rt.at }
-func (rt *RepairTeam) SetAt(at Track)         { rt.at = at }
+func (rt *RepairTeam) At() Track              { return rt.at.Get() }
+func (rt *RepairTeam) SetAt(at Track)         { rt.at.Set(at) }
 
 // String returns human-friendly label for Train t
 func (rt *RepairTeam) String() string { return fmt.Sprintf("RepairTeam%d", rt.id) }
@@ -216,23 +323,26 @@ func (rt *RepairTeam) String() string { return fmt.Sprintf("RepairTeam%d", rt.id
 func (rt *RepairTeam) GoString() string {
 	return fmt.Sprintf(
 		"rails.RepairTeam:%d{speed:%d, station:%s, at:%s}",
-		rt.id, rt.speed, rt.station, rt.at)
+		rt.id, rt.speed, rt.station, rt.At())
 }
 
-func SearchForPath(currentPath Path, from Track, destination Neighbors, resp chan Path, graph ConnectionsGraph) {
+// SearchForPath returns path leading from track from, appended to currentPath, to any of destination
+// along available tracks, nil when there is none.
+func SearchForPath(currentPath Path, from Track, destination Neighbors, graph ConnectionsGraph) Path {
 	for _, track := range from.Neighbors(graph) {
 		if track.isAvailable() {
 			for _, d := range destination {
 				if track == d {
-					select {
-					case resp <- append(currentPath, track):
-						return
-					default:
-						return
-					}
+					return append(currentPath, track)
 				}
 			}
-			SearchForPath(append(currentPath, track), track, destination, resp, graph)
+			if path := SearchForPath(append(currentPath, track), track, destination, graph); path != nil {
+				return path
+			}
 		}
 	}
+	return nil
 }
+
+// hours converts fractional simulated hours into simulated time.Duration.
+func hours(h float64) time.Duration { return time.Duration(h * float64(time.Hour)) }
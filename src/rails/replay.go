@@ -0,0 +1,196 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Replay reconstructs state of railway at any moment of run recorded in EventLog: positions of trains
+// and repair teams, broken elements and whereabouts of workers. Statistics are not replayed.
+// A Replay must be created using NewReplay.
+type Replay struct {
+	Railway *RailwayData // railway of log, reloaded on every rewind
+	Data    *SimulationData
+	Log     *EventLog
+	next    int           // index of next event to apply
+	now     time.Duration // simulated time of replay
+}
+
+// NewReplay creates pointer to new Replay standing at the start of log.
+func NewReplay(log *EventLog) (*Replay, error) {
+	r := &Replay{Log: log}
+	return r, r.Rewind()
+}
+
+// Rewind moves replay back to the start of log.
+func (r *Replay) Rewind() error {
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := Load(bytes.NewReader(r.Log.Description), TextFormat, data, railway); err != nil {
+		return err
+	}
+	data.Seed = r.Log.Seed
+	data.Clock = replayClock{r}
+	for _, e := range r.Log.Events {
+		data.SimulateRepairs = data.SimulateRepairs || e.Team >= 0
+		data.SimulateWorkers = data.SimulateWorkers || e.Worker >= 0
+	}
+	r.Railway, r.Data, r.next, r.now = railway, data, 0, 0
+	return nil
+}
+
+// Now returns simulated time of replay.
+func (r *Replay) Now() time.Duration { return r.now }
+
+// End returns simulated time of the last event in log.
+func (r *Replay) End() time.Duration {
+	if len(r.Log.Events) == 0 {
+		return 0
+	}
+	return r.Log.Events[len(r.Log.Events)-1].Time
+}
+
+// Step applies next event of log, reports false when there are no more events.
+func (r *Replay) Step() (Event, bool) {
+	if r.next >= len(r.Log.Events) {
+		return Event{}, false
+	}
+	e := r.Log.Events[r.next]
+	r.next++
+	r.now = e.Time
+	r.apply(e)
+	return e, true
+}
+
+// Seek moves replay to simulated time elapsed since start, applying every event published until then.
+func (r *Replay) Seek(elapsed time.Duration) error {
+	if elapsed < r.now {
+		if err := r.Rewind(); err != nil {
+			return err
+		}
+	}
+	for r.next < len(r.Log.Events) && r.Log.Events[r.next].Time <= elapsed {
+		r.Step()
+	}
+	r.now = elapsed
+	return nil
+}
+
+// SeekClock moves replay forward to the next moment simulation clock shows hh:mm[:ss].
+func (r *Replay) SeekClock(clock string) error {
+	var h, m, s int
+	if n, _ := fmt.Sscanf(clock, "%d:%d:%d", &h, &m, &s); n < 2 || h < 0 || h > 23 || m < 0 || m > 59 || s < 0 || s > 59 {
+		return fmt.Errorf("bad clock %q, expected hh:mm[:ss]", clock)
+	}
+	day := 24 * time.Hour
+	at := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	now := r.now + r.Data.start()
+	target := now - now%day + at
+	if target < now {
+		target += day
+	}
+	return r.Seek(target - r.Data.start())
+}
+
+// apply changes state of railway as e reports.
+func (r *Replay) apply(e Event) {
+	railway := r.Railway
+	track, _ := railway.Lookup(e.Element).(Track)
+	var train *Train
+	if e.Train >= 0 && e.Train < len(railway.Trains) {
+		train = railway.Trains[e.Train]
+	}
+	var team *RepairTeam
+	if e.Team >= 0 && e.Team < len(railway.RepairTeams) {
+		team = railway.RepairTeams[e.Team]
+	}
+	var worker *Worker
+	if e.Worker >= 0 && e.Worker < len(railway.Workers) {
+		worker = railway.Workers[e.Worker]
+	}
+	var station *Station
+	if e.Station >= 0 && e.Station < len(railway.Stations) {
+		station = railway.Stations[e.Station]
+	}
+
+	switch e.Kind {
+	case TrainStarted, TrainEntered:
+		if train != nil && track != nil {
+			train.SetAt(track)
+		}
+	case Breakdown:
+		if down := r.down(e.Element); down != nil {
+			down.set(1)
+		}
+	case RepairFinished:
+		if down := r.down(e.Element); down != nil {
+			down.set(0)
+		}
+	case TeamEntered:
+		if team != nil && track != nil {
+			team.SetAt(track)
+		}
+	case TeamReturned:
+		if team != nil {
+			team.SetAt(team.Station())
+		}
+	}
+
+	if worker == nil {
+		return
+	}
+	switch e.Kind {
+	case JobAssigned:
+		worker.Job = &Job{duration: e.Minutes, Workplace: station}
+		worker.state.set(int64(Travelling))
+		if station != nil && worker.At == station {
+			worker.state.set(int64(Waiting))
+		}
+	case WorkStarted:
+		worker.state.set(int64(Working))
+	case WorkFinished:
+		worker.Job = nil
+		worker.state.set(int64(Travelling))
+	case WorkerReturned:
+		worker.state.set(int64(AtHome))
+	case Boarded:
+		worker.In, worker.At = train, nil
+	case Alighted:
+		worker.In, worker.At = nil, station
+		if worker.Job != nil && worker.Job.Workplace == station {
+			worker.state.set(int64(Waiting))
+		}
+	}
+}
+
+// down returns broken state of element, nil when it does not exist.
+func (r *Replay) down(el Element) *gauge {
+	switch x := r.Railway.Lookup(el).(type) {
+	case *Turntable:
+		return &x.down
+	case *NormalTrack:
+		return &x.down
+	case *StationTrack:
+		return &x.down
+	case *Train:
+		return &x.down
+	}
+	return nil
+}
+
+// replayClock shows time of Replay, it never sleeps.
+type replayClock struct{ r *Replay }
+
+var errReplayClock = errors.New("replay clock can't sleep")
+
+func (c replayClock) Start(ctx context.Context)                        {}
+func (c replayClock) Now() time.Duration                               { return c.r.now }
+func (c replayClock) Sleep(ctx context.Context, d time.Duration) error { return errReplayClock }
+func (c replayClock) Yield(ctx context.Context) error                  { return errReplayClock }
+func (c replayClock) Pause()                                           {}
+func (c replayClock) Resume()                                          {}
@@ -0,0 +1,211 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replayState is what Replay reconstructs: positions of trains and repair teams, broken elements
+// and whereabouts of workers.
+type replayState struct {
+	Trains  []Element
+	Teams   []Element
+	Broken  map[Element]bool
+	Workers []string
+}
+
+func stateOf(railway *RailwayData) replayState {
+	var s replayState
+	for _, t := range railway.Trains {
+		s.Trains = append(s.Trains, ElementOf(t.At()))
+	}
+	for _, rt := range railway.RepairTeams {
+		s.Teams = append(s.Teams, ElementOf(rt.At()))
+	}
+	s.Broken = make(map[Element]bool)
+	for _, el := range railway.Broken() {
+		s.Broken[el] = true
+	}
+	for _, w := range railway.Workers {
+		switch {
+		case w.In != nil:
+			s.Workers = append(s.Workers, "in "+w.In.String())
+		case w.At != nil:
+			s.Workers = append(s.Workers, "at "+w.At.String())
+		default:
+			s.Workers = append(s.Workers, "")
+		}
+	}
+	return s
+}
+
+// foldEvents returns positions of trains and repair teams and broken elements after events published
+// until elapsed, starting from state of railway.
+func foldEvents(railway *RailwayData, events []Event, elapsed time.Duration) replayState {
+	s := stateOf(railway)
+	for _, e := range events {
+		if e.Time > elapsed {
+			break
+		}
+		switch e.Kind {
+		case TrainStarted, TrainEntered:
+			s.Trains[e.Train] = e.Element
+		case TeamEntered:
+			s.Teams[e.Team] = e.Element
+		case TeamReturned:
+			s.Teams[e.Team] = ElementOf(railway.RepairTeams[e.Team].Station())
+		case Breakdown:
+			s.Broken[e.Element] = true
+		case RepairFinished:
+			delete(s.Broken, e.Element)
+		}
+	}
+	return s
+}
+
+func TestReplayMatchesRecordedRun(t *testing.T) {
+	in, err := os.Open("../../input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := Load(in, TextFormat, data, railway); err != nil {
+		t.Fatal(err)
+	}
+	data.Clock = NewEventClock()
+	data.Seed = 7
+	data.Duration = 24 * time.Hour
+	data.SimulateRepairs, data.SimulateWorkers = true, true
+
+	var recorded bytes.Buffer
+	sink, err := NewLogSink(&recorded, railway, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulation := NewSimulation(railway, data)
+	if err := simulation.AddSink(sink); err != nil {
+		t.Fatal(err)
+	}
+	if err := simulation.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-simulation.Done():
+	case <-time.After(time.Minute):
+		simulation.Stop()
+		t.Fatal("simulation of 24h did not end")
+	}
+	if err := simulation.Err(); err != nil {
+		t.Fatal(err)
+	}
+	live := stateOf(railway)
+
+	log, err := ReadEventLog(bytes.NewReader(recorded.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Seed != 7 {
+		t.Errorf("seed %d, want 7", log.Seed)
+	}
+	if len(log.Events) < 100 {
+		t.Fatalf("only %d events recorded", len(log.Events))
+	}
+	// every event is read back as it was written
+	lines := strings.Split(strings.TrimSuffix(recorded.String()[strings.Index(recorded.String(), "\nevents\n")+8:], "\n"), "\n")
+	if len(lines) != len(log.Events) {
+		t.Fatalf("%d events read from %d lines", len(log.Events), len(lines))
+	}
+	for i, e := range log.Events {
+		if formatLogEvent(e) != lines[i] {
+			t.Fatalf("event %d read as %q from %q", i, formatLogEvent(e), lines[i])
+		}
+	}
+
+	replay, err := NewReplay(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// railway standing at the start, kept aside as replay reloads its railway on every rewind
+	start := replay.Railway
+	startState := stateOf(start)
+	if err := replay.Rewind(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replay ends where live run did
+	if err := replay.Seek(replay.End()); err != nil {
+		t.Fatal(err)
+	}
+	if got := stateOf(replay.Railway); !reflect.DeepEqual(got, live) {
+		t.Errorf("replayed end of run\n%+v\nlive run ended with\n%+v", got, live)
+	}
+	if _, ok := replay.Step(); ok {
+		t.Error("event stepped after the end of log")
+	}
+
+	// seeking back and forth reaches the same states as events published until then
+	for _, hours := range []float64{6, 2.5, 13, 13, 0.1, 20, 9} {
+		elapsed := time.Duration(hours * float64(time.Hour))
+		if err := replay.Seek(elapsed); err != nil {
+			t.Fatal(err)
+		}
+		if replay.Now() != elapsed {
+			t.Errorf("seek to %v: replay stands at %v", elapsed, replay.Now())
+		}
+		got := stateOf(replay.Railway)
+		want := foldEvents(start, log.Events, elapsed)
+		if !reflect.DeepEqual(got.Trains, want.Trains) || !reflect.DeepEqual(got.Teams, want.Teams) || !reflect.DeepEqual(got.Broken, want.Broken) {
+			t.Errorf("seek to %v: replayed\n%+v\nwant\n%+v", elapsed, got, want)
+		}
+		// next step applies the first event after elapsed
+		if e, ok := replay.Step(); ok {
+			for _, before := range log.Events {
+				if before.Time > elapsed {
+					if formatLogEvent(e) != formatLogEvent(before) {
+						t.Errorf("seek to %v: stepped to %q, want %q", elapsed, formatLogEvent(e), formatLogEvent(before))
+					}
+					break
+				}
+			}
+		}
+	}
+
+	if err := replay.Rewind(); err != nil {
+		t.Fatal(err)
+	}
+	if replay.Now() != 0 {
+		t.Errorf("rewound replay stands at %v", replay.Now())
+	}
+	if got := stateOf(replay.Railway); !reflect.DeepEqual(got, startState) {
+		t.Errorf("rewound replay\n%+v\nwant start\n%+v", got, startState)
+	}
+	if e, ok := replay.Step(); !ok || formatLogEvent(e) != formatLogEvent(log.Events[0]) {
+		t.Errorf("rewound replay stepped to %q, want %q", formatLogEvent(e), formatLogEvent(log.Events[0]))
+	}
+
+	// input starts at 12:00
+	for _, c := range []struct {
+		clock string
+		now   time.Duration
+	}{{"18:30", 6*time.Hour + 30*time.Minute}, {"12:00", 24 * time.Hour}, {"07:15:30", 43*time.Hour + 15*time.Minute + 30*time.Second}} {
+		if err := replay.SeekClock(c.clock); err != nil {
+			t.Errorf("%s: %v", c.clock, err)
+		} else if replay.Now() != c.now {
+			t.Errorf("%s: replay stands at %v, want %v", c.clock, replay.Now(), c.now)
+		}
+	}
+	for _, clock := range []string{"25:00", "12", "7:60"} {
+		if err := replay.SeekClock(clock); err == nil {
+			t.Errorf("%s: no error", clock)
+		}
+	}
+}
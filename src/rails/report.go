@@ -0,0 +1,438 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// counter counts simulation events, it is safe for concurrent use.
+type counter struct{ n int64 }
+
+func (c *counter) inc()         { atomic.AddInt64(&c.n, 1) }
+func (c *counter) Value() int64 { return atomic.LoadInt64(&c.n) }
+
+// gauge holds value which goes up and down, it is safe for concurrent use.
+type gauge struct{ n int64 }
+
+func (g *gauge) set(n int64)  { atomic.StoreInt64(&g.n, n) }
+func (g *gauge) add(n int64)  { atomic.AddInt64(&g.n, n) }
+func (g *gauge) Value() int64 { return atomic.LoadInt64(&g.n) }
+
+// timer sums simulated time spent in some state, it is safe for concurrent use.
+type timer struct{ d int64 }
+
+func (t *timer) add(d time.Duration)  { atomic.AddInt64(&t.d, int64(d)) }
+func (t *timer) Value() time.Duration { return time.Duration(atomic.LoadInt64(&t.d)) }
+
+// WriteReport writes summary of finished simulation to w: completed route cycles,
+// station visits, breakdowns, repairs and completed worker jobs.
+func WriteReport(w io.Writer, railway *RailwayData, data *SimulationData) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "simulation report\n")
+	fmt.Fprintf(b, "simulated %v from %02d:%02d, stopped at %s\n",
+		data.Clock.Now(), data.clock.h, data.clock.m, ClockTime(data))
+
+	fmt.Fprintf(b, "\n# trains:\n# train cycles visits breakdowns repairs\n")
+	for _, t := range railway.Trains {
+		fmt.Fprintf(b, "%v\t%d\t%d\t%d\t%d\n",
+			t, t.cycles.Value(), t.visits.Value(), t.breakdowns.Value(), t.repairs.Value())
+	}
+
+	fmt.Fprintln(b)
+	writeTrainStats(b, railway)
+
+	roleVisits := make([]int64, len(roleNames))
+	fmt.Fprintf(b, "\n# stations:\n# station role visits\n")
+	for _, s := range railway.Stations {
+		fmt.Fprintf(b, "%v\t%v\t%d\n", s, s.Role, s.visits.Value())
+		if s.Role >= 0 && int(s.Role) < len(roleVisits) {
+			roleVisits[s.Role] += s.visits.Value()
+		}
+	}
+	for role, visits := range roleVisits {
+		fmt.Fprintf(b, "total %v\t%d\n", Role(role), visits)
+	}
+
+	var breakdowns, repairs int64
+	fmt.Fprintf(b, "\n# broken tracks:\n# track breakdowns repairs\n")
+	for _, tt := range railway.Turntables {
+		if tt.breakdowns.Value() > 0 {
+			fmt.Fprintf(b, "%v\t%d\t%d\n", tt, tt.breakdowns.Value(), tt.repairs.Value())
+		}
+		breakdowns += tt.breakdowns.Value()
+		repairs += tt.repairs.Value()
+	}
+	for _, nt := range railway.NormalTracks {
+		if nt.breakdowns.Value() > 0 {
+			fmt.Fprintf(b, "%v\t%d\t%d\n", nt, nt.breakdowns.Value(), nt.repairs.Value())
+		}
+		breakdowns += nt.breakdowns.Value()
+		repairs += nt.repairs.Value()
+	}
+	for _, st := range railway.StationTracks {
+		if st.breakdowns.Value() > 0 {
+			fmt.Fprintf(b, "%v\t%d\t%d\n", st, st.breakdowns.Value(), st.repairs.Value())
+		}
+		breakdowns += st.breakdowns.Value()
+		repairs += st.repairs.Value()
+	}
+	fmt.Fprintf(b, "total\t%d\t%d\n", breakdowns, repairs)
+
+	fmt.Fprintln(b)
+	writeBottlenecks(b, railway, data)
+
+	if data.SimulateRepairs {
+		fmt.Fprintln(b)
+		writeRepairStats(b, railway, data)
+	}
+
+	if data.SimulateWorkers {
+		fmt.Fprintln(b)
+		writeJobStats(b, railway, data)
+	}
+
+	if len(railway.Plan) > 0 {
+		fmt.Fprintln(b)
+		writeDelays(b, railway, data)
+	}
+
+	return b.Flush()
+}
+
+// WriteTrainStats writes operational statistics of every train to w: distance, hours moving, dwelling,
+// blocked by other trains and broken, share of time blocked, breakdowns and completed route cycles,
+// followed by distance travelled on every normal track. It can be called while simulation runs.
+func WriteTrainStats(w io.Writer, railway *RailwayData) error {
+	b := bufio.NewWriter(w)
+	writeTrainStats(b, railway)
+	return b.Flush()
+}
+
+func writeTrainStats(b *bufio.Writer, railway *RailwayData) {
+	stats := make([]TrainStats, len(railway.Trains))
+	fmt.Fprintf(b, "# train statistics:\n# train km moving[h] dwelling[h] blocked[h] broken[h] blocked[%%] breakdowns cycles\n")
+	for i, t := range railway.Trains {
+		s := t.Stats()
+		stats[i] = s
+		var share float64
+		if total := s.Moving + s.Dwelling + s.Blocked + s.Broken; total > 0 {
+			share = 100 * float64(s.Blocked) / float64(total)
+		}
+		fmt.Fprintf(b, "%v\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.1f\t%d\t%d\n",
+			t, s.TotalDistance(), s.Moving.Hours(), s.Dwelling.Hours(), s.Blocked.Hours(), s.Broken.Hours(),
+			share, s.Breakdowns, s.Cycles)
+	}
+
+	fmt.Fprintf(b, "\n# train distances:\n# train normalTrack km\n")
+	for i, t := range railway.Trains {
+		for _, nt := range railway.NormalTracks {
+			if km := stats[i].Distance[nt.id]; km > 0 {
+				fmt.Fprintf(b, "%v\t%v\t%d\n", t, nt, km)
+			}
+		}
+	}
+}
+
+// WriteBottlenecks writes utilization of tracks and turntables to w, ranked by total time trains waited
+// to get in and then by share of simulated time occupied, so tracks worth doubling come first.
+// Tracks nothing passed are left out. It can be called while simulation runs.
+func WriteBottlenecks(w io.Writer, railway *RailwayData, data *SimulationData) error {
+	b := bufio.NewWriter(w)
+	writeBottlenecks(b, railway, data)
+	return b.Flush()
+}
+
+func writeBottlenecks(b *bufio.Writer, railway *RailwayData, data *SimulationData) {
+	type usage struct {
+		track Track
+		stats TrackStats
+	}
+	used := make([]usage, 0)
+	tracks := make([]Track, 0, len(railway.Turntables)+len(railway.NormalTracks)+len(railway.StationTracks))
+	for _, tt := range railway.Turntables {
+		tracks = append(tracks, tt)
+	}
+	for _, nt := range railway.NormalTracks {
+		tracks = append(tracks, nt)
+	}
+	for _, st := range railway.StationTracks {
+		tracks = append(tracks, st)
+	}
+	for _, track := range tracks {
+		if s := track.Stats(); s.Occupied > 0 || s.Broken > 0 || s.Riders > 0 {
+			used = append(used, usage{track, s})
+		}
+	}
+	sort.SliceStable(used, func(i, j int) bool {
+		if used[i].stats.Waited != used[j].stats.Waited {
+			return used[i].stats.Waited > used[j].stats.Waited
+		}
+		return used[i].stats.Occupied > used[j].stats.Occupied
+	})
+
+	elapsed := data.Clock.Now()
+	fmt.Fprintf(b, "# bottlenecks:\n# track occupied[%%] reserved[h] broken[h] riders waited[h] wait/rider[min]\n")
+	for _, u := range used {
+		var occupied float64
+		if elapsed > 0 {
+			occupied = 100 * float64(u.stats.Occupied) / float64(elapsed)
+		}
+		fmt.Fprintf(b, "%v\t%.1f\t%.2f\t%.2f\t%d\t%.2f\t%.1f\n",
+			u.track, occupied, u.stats.Reserved.Hours(), u.stats.Broken.Hours(),
+			u.stats.Riders, u.stats.Waited.Hours(), u.stats.Wait().Minutes())
+	}
+}
+
+// writeRepairStats writes times of repairs summed by repair team, with searches for path which found none,
+// and by kind of repaired element, with failures dropped because no repair team took them.
+func writeRepairStats(b *bufio.Writer, railway *RailwayData, data *SimulationData) {
+	elapsed := data.Clock.Now()
+	byKind := make(map[ElementKind]*RepairStats)
+	fmt.Fprintf(b, "# repair teams:\n# team repairs dispatch[h] travel[h] repair[h] downtime[h] MTTR[h] busy[%%] noPath\n")
+	for _, rt := range railway.RepairTeams {
+		total := RepairStats{}
+		for kind, s := range rt.Stats() {
+			total.add(s)
+			if _, ok := byKind[kind]; !ok {
+				byKind[kind] = &RepairStats{}
+			}
+			byKind[kind].add(s)
+		}
+		var busy float64
+		if elapsed > 0 {
+			busy = 100 * float64(total.Busy) / float64(elapsed)
+		}
+		fmt.Fprintf(b, "%v\t%d\t%s\t%.1f\t%d\n", rt, total.Repairs, repairHours(total), busy, rt.retries.Value())
+	}
+
+	failures := make(map[ElementKind][2]int64) // taken by teams and dropped
+	count := func(kind ElementKind, taken, dropped *counter) {
+		f := failures[kind]
+		failures[kind] = [2]int64{f[0] + taken.Value(), f[1] + dropped.Value()}
+	}
+	for _, tt := range railway.Turntables {
+		count(TurntableElement, &tt.breakdowns, &tt.dropped)
+	}
+	for _, nt := range railway.NormalTracks {
+		count(NormalTrackElement, &nt.breakdowns, &nt.dropped)
+	}
+	for _, st := range railway.StationTracks {
+		count(StationTrackElement, &st.breakdowns, &st.dropped)
+	}
+	for _, t := range railway.Trains {
+		count(TrainElement, &t.breakdowns, &t.dropped)
+	}
+	fmt.Fprintf(b, "\n# repairs by element:\n# element failures dropped repairs dispatch[h] travel[h] repair[h] downtime[h] MTTR[h]\n")
+	for kind := TurntableElement; kind <= TrainElement; kind++ {
+		s := RepairStats{}
+		if k, ok := byKind[kind]; ok {
+			s = *k
+		}
+		fmt.Fprintf(b, "%v\t%d\t%d\t%d\t%s\n", kind, failures[kind][0], failures[kind][1], s.Repairs, repairHours(s))
+	}
+}
+
+// repairHours formats summed times of repairs and their mean in hours.
+func repairHours(s RepairStats) string {
+	return fmt.Sprintf("%.2f\t%.2f\t%.2f\t%.2f\t%.2f",
+		s.Dispatch.Hours(), s.Travel.Hours(), s.Repair.Hours(), s.Downtime.Hours(), s.MTTR().Hours())
+}
+
+// WriteJobStats writes jobs done by every worker, hours commuting and waiting for colleagues
+// and times of every job posted by dispatcher to w. It can be called while simulation runs.
+func WriteJobStats(w io.Writer, railway *RailwayData, data *SimulationData) error {
+	b := bufio.NewWriter(w)
+	writeJobStats(b, railway, data)
+	return b.Flush()
+}
+
+// writeJobStats writes jobs done by every worker with hours spent commuting and waiting for colleagues,
+// followed by times of every job posted by dispatcher and number of jobs which were not completed.
+func writeJobStats(b *bufio.Writer, railway *RailwayData, data *SimulationData) {
+	now := data.Clock.Now()
+	jobs := railway.Jobs()
+	commute := make(map[*Worker]time.Duration)
+	waiting := make(map[*Worker]time.Duration)
+	for _, j := range jobs {
+		released := j.Released
+		if released == NOT_YET {
+			released = now
+		}
+		for _, wt := range j.Workers {
+			if wt.Arrived != NOT_YET {
+				commute[wt.Worker] += wt.Arrived - j.Posted
+				waiting[wt.Worker] += released - wt.Arrived
+			}
+			if wt.Home != NOT_YET {
+				commute[wt.Worker] += wt.Home - j.Finished
+			}
+		}
+	}
+
+	var done int64
+	fmt.Fprintf(b, "# workers:\n# worker jobs commute[h] waiting[h]\n")
+	for _, w := range railway.Workers {
+		fmt.Fprintf(b, "%v\t%d\t%.2f\t%.2f\n", w, w.jobs.Value(), commute[w].Hours(), waiting[w].Hours())
+		done += w.jobs.Value()
+	}
+	fmt.Fprintf(b, "total\t%d\n", done)
+
+	uncompleted := 0
+	fmt.Fprintf(b, "\n# jobs:\n# job workplace workers minutes posted there[h] waiting[h] back[h] state\n")
+	for i, j := range jobs {
+		there, back := j.Commute()
+		fmt.Fprintf(b, "%d\t%v\t%d\t%d\t%s\t%.2f\t%.2f\t%.2f\t%s\n",
+			i, j.Workplace, len(j.Workers), j.Minutes, data.ClockAt(j.Posted),
+			there.Hours(), j.Waiting(now).Hours(), back.Hours(), j.State())
+		if !j.Completed() {
+			uncompleted++
+		}
+	}
+	fmt.Fprintf(b, "uncompleted\t%d\n", uncompleted)
+}
+
+// WriteDelays writes planned stops of every train compared with actual ones to w, on-time performance
+// of trains and lines and how delays propagated along routes. It can be called while simulation runs.
+func WriteDelays(w io.Writer, railway *RailwayData, data *SimulationData) error {
+	b := bufio.NewWriter(w)
+	writeDelays(b, railway, data)
+	return b.Flush()
+}
+
+// punctuality sums planned stops of trains which were due.
+type punctuality struct {
+	due, stopped, onTime int
+	delay, max           time.Duration // arrival delays of made stops
+}
+
+func (p *punctuality) add(s StopDelay) {
+	p.due++
+	if s.Arrival == NOT_YET {
+		return
+	}
+	p.stopped++
+	if s.OnTime() {
+		p.onTime++
+	}
+	p.delay += s.ArrivalDelay()
+	if s.ArrivalDelay() > p.max {
+		p.max = s.ArrivalDelay()
+	}
+}
+
+func (p punctuality) String() string {
+	var onTime, mean float64
+	if p.due > 0 {
+		onTime = 100 * float64(p.onTime) / float64(p.due)
+	}
+	if p.stopped > 0 {
+		mean = p.delay.Minutes() / float64(p.stopped)
+	}
+	return fmt.Sprintf("%d\t%d\t%d\t%.1f\t%.1f\t%.1f", p.due, p.stopped, p.onTime, onTime, mean, p.max.Minutes())
+}
+
+// writeDelays writes delay of every planned stop, with delay brought from previous stop, gained on the way
+// and at station, followed by punctuality of trains and lines, counting stops which were not made when due
+// as late, and by delay of every train split into delay at first stop, gained on the way, gained at stations,
+// recovered, and stops late only because of delay brought from previous stop.
+func writeDelays(b *bufio.Writer, railway *RailwayData, data *SimulationData) {
+	now := data.Clock.Now()
+	minutes := func(d time.Duration) string { return fmt.Sprintf("%.1f", d.Minutes()) }
+
+	fmt.Fprintf(b, "# stop delays:\n# train station planned arrival delay[min] planned departure delay[min] brought[min] way[min] station[min]\n")
+	for _, t := range railway.Trains {
+		var brought time.Duration
+		for i, s := range t.Delays() {
+			if !s.Due(now) {
+				break
+			}
+			arrival, arrDelay, departure, depDelay := "-", "-", "-", "-"
+			way, station := "-", "-"
+			if s.Arrival != NOT_YET {
+				arrival, arrDelay = data.ClockAt(s.Arrival), minutes(s.ArrivalDelay())
+				if i > 0 {
+					way = minutes(s.ArrivalDelay() - brought)
+				} else {
+					way = minutes(0)
+				}
+			}
+			if s.Departure != NOT_YET {
+				departure, depDelay = data.ClockAt(s.Departure), minutes(s.DepartureDelay())
+				station = minutes(s.DepartureDelay() - s.ArrivalDelay())
+			}
+			fmt.Fprintf(b, "%v\t%v\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t, s.Station,
+				data.ClockAt(s.PlannedArrival), arrival, arrDelay, data.ClockAt(s.PlannedDeparture), departure, depDelay,
+				minutes(brought), way, station)
+			if s.Departure != NOT_YET {
+				brought = s.DepartureDelay()
+			}
+		}
+	}
+
+	fmt.Fprintf(b, "\n# punctuality, up to %v late is on time:\n# train due stopped onTime onTime[%%] meanDelay[min] maxDelay[min]\n", ON_TIME_DELAY)
+	var lines []string
+	byLine := make(map[string]*punctuality)
+	var total punctuality
+	for _, t := range railway.Trains {
+		var p punctuality
+		line := t.Line()
+		if byLine[line] == nil {
+			byLine[line] = &punctuality{}
+			lines = append(lines, line)
+		}
+		for _, s := range t.Delays() {
+			if s.Due(now) {
+				p.add(s)
+				byLine[line].add(s)
+				total.add(s)
+			}
+		}
+		fmt.Fprintf(b, "%v\t%v\n", t, p)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(b, "line %s\t%v\n", line, *byLine[line])
+	}
+	fmt.Fprintf(b, "total\t%v\n", total)
+
+	fmt.Fprintf(b, "\n# delay propagation:\n# train first[min] way[min] station[min] recovered[min] last[min] inherited\n")
+	for _, t := range railway.Trains {
+		var first, way, station, recovered, last, brought time.Duration
+		inherited := 0
+		gain := func(d time.Duration, to *time.Duration) {
+			if d > 0 {
+				*to += d
+			} else {
+				recovered -= d
+			}
+		}
+		for i, s := range t.Delays() {
+			if s.Arrival == NOT_YET {
+				break
+			}
+			if i == 0 {
+				first = s.ArrivalDelay()
+			} else {
+				gain(s.ArrivalDelay()-brought, &way)
+				if !s.OnTime() && brought > ON_TIME_DELAY && s.ArrivalDelay() <= brought {
+					inherited++
+				}
+			}
+			last = s.ArrivalDelay()
+			if s.Departure == NOT_YET {
+				break
+			}
+			gain(s.DepartureDelay()-s.ArrivalDelay(), &station)
+			last, brought = s.DepartureDelay(), s.DepartureDelay()
+		}
+		fmt.Fprintf(b, "%v\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			t, minutes(first), minutes(way), minutes(station), minutes(recovered), minutes(last), inherited)
+	}
+}
@@ -0,0 +1,368 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reportSection returns rows of report section with given title split into columns, without its header.
+func reportSection(t *testing.T, report, title string) [][]string {
+	t.Helper()
+	i := strings.Index(report, "# "+title+":\n")
+	if i < 0 {
+		t.Fatalf("report has no section %s:\n%s", title, report)
+	}
+	var rows [][]string
+	for _, line := range strings.Split(report[i:], "\n")[1:] {
+		if line == "" {
+			break
+		}
+		if !strings.HasPrefix(line, "#") {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows
+}
+
+// column returns number in given column of row.
+func column(t *testing.T, row []string, i int) float64 {
+	t.Helper()
+	if i >= len(row) {
+		t.Fatalf("row %v has no column %d", row, i)
+	}
+	f, err := strconv.ParseFloat(row[i], 64)
+	if err != nil {
+		t.Fatalf("row %v: %v", row, err)
+	}
+	return f
+}
+
+func TestReportTotals(t *testing.T) {
+	_, report := runOutputs(t, "../../input", 7, 48, true, true)
+
+	// totals of broken tracks sum only rows of tracks, breakdowns of trains are listed with trains
+	var breakdowns, repairs, trainBreakdowns float64
+	tracks := reportSection(t, report, "broken tracks")
+	if len(tracks) < 2 {
+		t.Fatalf("no track broke in 48h:\n%s", report)
+	}
+	total := tracks[len(tracks)-1]
+	if total[0] != "total" {
+		t.Fatalf("broken tracks end with %v, want total", total)
+	}
+	for _, row := range tracks[:len(tracks)-1] {
+		breakdowns += column(t, row, 1)
+		repairs += column(t, row, 2)
+		if column(t, row, 1) == 0 {
+			t.Errorf("%v listed among broken tracks", row)
+		}
+	}
+	if column(t, total, 1) != breakdowns || column(t, total, 2) != repairs {
+		t.Errorf("total %v, rows sum to %v breakdowns and %v repairs", total, breakdowns, repairs)
+	}
+	for _, row := range reportSection(t, report, "trains") {
+		trainBreakdowns += column(t, row, 3)
+	}
+	if trainBreakdowns == 0 {
+		t.Errorf("no train broke in 48h:\n%s", report)
+	}
+
+	// station visits summed by role match visits of stations
+	roles := make(map[string]float64)
+	var rows [][]string
+	for _, row := range reportSection(t, report, "stations") {
+		if strings.HasPrefix(row[0], "total ") {
+			rows = append(rows, row)
+		} else {
+			roles[row[1]] += column(t, row, 2)
+		}
+	}
+	if len(rows) != len(roleNames) {
+		t.Errorf("%d totals of roles, want %d", len(rows), len(roleNames))
+	}
+	for _, row := range rows {
+		if role := strings.TrimPrefix(row[0], "total "); column(t, row, 1) != roles[role] {
+			t.Errorf("%v, stations of role %s were visited %v times", row, role, roles[role])
+		}
+	}
+}
+
+func TestTrainStatsCoverSimulatedTime(t *testing.T) {
+	for _, run := range []struct {
+		file  string
+		seed  int64
+		hours int
+	}{{"../../input", 7, 48}, {"../../input", 3, 30}, {"../../poland", 42, 72}} {
+		railway, data := runInput(t, run.file, run.seed, run.hours, true, true)
+		elapsed := data.Clock.Now()
+		if elapsed != time.Duration(run.hours)*time.Hour {
+			t.Errorf("%s seed %d: simulation ended at %v", run.file, run.seed, elapsed)
+		}
+		var b bytes.Buffer
+		if err := WriteTrainStats(&b, railway); err != nil {
+			t.Fatal(err)
+		}
+		rows := reportSection(t, b.String(), "train statistics")
+		distances := reportSection(t, b.String(), "train distances")
+		if len(rows) != len(railway.Trains) {
+			t.Fatalf("%s: statistics of %d trains, want %d", run.file, len(rows), len(railway.Trains))
+		}
+		for i, tr := range railway.Trains {
+			// every moment train is in exactly one state, including the one simulation ended in
+			s := tr.Stats()
+			if total := s.Moving + s.Dwelling + s.Blocked + s.Broken; total != elapsed {
+				t.Errorf("%s seed %d: %v spent %v moving, %v dwelling, %v blocked and %v broken, %v in total, want %v",
+					run.file, run.seed, tr, s.Moving, s.Dwelling, s.Blocked, s.Broken, total, elapsed)
+			}
+			if s.Moving <= 0 || s.Dwelling <= 0 || s.Blocked < 0 || s.Broken < 0 {
+				t.Errorf("%s seed %d: %v has %+v", run.file, run.seed, tr, s)
+			}
+			if s.Breakdowns > 0 && s.Broken == 0 || s.Broken > 0 && s.Breakdowns == 0 {
+				t.Errorf("%s seed %d: %v broke %d times and was broken for %v", run.file, run.seed, tr, s.Breakdowns, s.Broken)
+			}
+			// blocked share is the part of simulated time
+			if share := column(t, rows[i], 6); math.Abs(share-100*s.Blocked.Hours()/elapsed.Hours()) > 0.05 {
+				t.Errorf("%s seed %d: %v blocked %v%% of %v", run.file, run.seed, tr, share, elapsed)
+			}
+			// distance is the sum of distances on tracks
+			km := 0.0
+			for _, row := range distances {
+				if row[0] == tr.String() {
+					km += column(t, row, 2)
+				}
+			}
+			if column(t, rows[i], 1) != km || int(km) != s.TotalDistance() {
+				t.Errorf("%s seed %d: %v travelled %v km, %v km on tracks", run.file, run.seed, tr, rows[i][1], km)
+			}
+		}
+	}
+}
+
+func TestBottlenecksInvariants(t *testing.T) {
+	for _, run := range []struct {
+		file  string
+		seed  int64
+		hours int
+	}{{"../../input", 7, 48}, {"../../poland", 42, 72}} {
+		railway, data := runInput(t, run.file, run.seed, run.hours, true, true)
+		elapsed := data.Clock.Now()
+		var b bytes.Buffer
+		if err := WriteBottlenecks(&b, railway, data); err != nil {
+			t.Fatal(err)
+		}
+		rows := reportSection(t, b.String(), "bottlenecks")
+
+		tracks := make(map[string]TrackStats)
+		for _, tt := range railway.Turntables {
+			tracks[tt.String()] = tt.Stats()
+		}
+		for _, nt := range railway.NormalTracks {
+			tracks[nt.String()] = nt.Stats()
+			// trains travelled the track as many times as they were let in, but those still on it
+			var km int
+			for _, tr := range railway.Trains {
+				km += tr.Stats().Distance[nt.id]
+			}
+			if s := nt.Stats(); km > int(s.Riders)*nt.len || km < int(s.Riders-int64(len(railway.Trains)))*nt.len {
+				t.Errorf("%s seed %d: %v of %d km let %d trains in, they travelled %d km on it",
+					run.file, run.seed, nt, nt.len, s.Riders, km)
+			}
+		}
+		for _, st := range railway.StationTracks {
+			tracks[st.String()] = st.Stats()
+		}
+		used := 0
+		for _, s := range tracks {
+			if s.Occupied > 0 || s.Broken > 0 || s.Riders > 0 {
+				used++
+			}
+		}
+		if len(rows) != used || used == 0 {
+			t.Errorf("%s seed %d: %d bottlenecks listed, %d tracks were used", run.file, run.seed, len(rows), used)
+		}
+
+		for i, row := range rows {
+			s, ok := tracks[row[0]]
+			if !ok {
+				t.Fatalf("%s seed %d: unknown track in %v", run.file, run.seed, row)
+			}
+			// track is occupied, reserved and broken one after another
+			if s.Occupied+s.Reserved+s.Broken > elapsed {
+				t.Errorf("%s seed %d: %s occupied %v, reserved %v and broken %v in %v",
+					run.file, run.seed, row[0], s.Occupied, s.Reserved, s.Broken, elapsed)
+			}
+			if occupied := column(t, row, 1); occupied < 0 || occupied > 100 {
+				t.Errorf("%s seed %d: %s occupied %v%%", run.file, run.seed, row[0], occupied)
+			}
+			if s.Waited < 0 || s.Riders > 0 && s.Wait()*time.Duration(s.Riders) > s.Waited ||
+				s.Riders == 0 && s.Waited != 0 {
+				t.Errorf("%s seed %d: %s let %d trains in, they waited %v, %v each", run.file, run.seed, row[0], s.Riders, s.Waited, s.Wait())
+			}
+			// ranked by time waited, then by occupied time
+			if i > 0 {
+				prev := tracks[rows[i-1][0]]
+				if prev.Waited < s.Waited || prev.Waited == s.Waited && prev.Occupied < s.Occupied {
+					t.Errorf("%s seed %d: %s ranked before %s", run.file, run.seed, rows[i-1][0], row[0])
+				}
+			}
+		}
+	}
+}
+
+func TestRepairStatsInvariants(t *testing.T) {
+	for _, run := range []struct {
+		file  string
+		seed  int64
+		hours int
+	}{{"../../input", 7, 48}, {"../../input", 11, 96}, {"../../poland", 42, 72}} {
+		railway, data := runInput(t, run.file, run.seed, run.hours, true, false)
+		elapsed := data.Clock.Now()
+		var b bytes.Buffer
+		if err := WriteReport(&b, railway, data); err != nil {
+			t.Fatal(err)
+		}
+		teams := reportSection(t, b.String(), "repair teams")
+		elements := reportSection(t, b.String(), "repairs by element")
+
+		var teamRepairs, elementRepairs float64
+		for i, rt := range railway.RepairTeams {
+			total := RepairStats{}
+			for _, s := range rt.Stats() {
+				total.add(s)
+			}
+			// team repairs one element at a time, from taking its failure until it is back at depot
+			if total.Dispatch+total.Travel+total.Repair > total.Downtime || total.Downtime > total.Busy || total.Busy > elapsed {
+				t.Errorf("%s seed %d: %v has %+v in %v", run.file, run.seed, rt, total, elapsed)
+			}
+			if repairs := column(t, teams[i], 1); repairs != float64(total.Repairs) {
+				t.Errorf("%s seed %d: %v listed with %v repairs, %d summed by kind", run.file, run.seed, rt, repairs, total.Repairs)
+			}
+			if busy := column(t, teams[i], 7); busy < 0 || busy > 100 {
+				t.Errorf("%s seed %d: %v busy %v%%", run.file, run.seed, rt, busy)
+			}
+			teamRepairs += column(t, teams[i], 1)
+		}
+
+		var failures float64
+		for _, row := range elements {
+			// failures taken by teams are repaired at most once, dropped ones never
+			taken, dropped, repairs := column(t, row, 1), column(t, row, 2), column(t, row, 3)
+			if repairs > taken || dropped < 0 {
+				t.Errorf("%s seed %d: %v", run.file, run.seed, row)
+			}
+			failures += taken
+			elementRepairs += repairs
+		}
+		if teamRepairs != elementRepairs || failures == 0 {
+			t.Errorf("%s seed %d: teams made %v repairs, %v counted by element of %v failures",
+				run.file, run.seed, teamRepairs, elementRepairs, failures)
+		}
+
+		// every element is repaired no more often than it broke
+		check := func(el interface{}, breakdowns, repairs int64) {
+			if repairs > breakdowns || breakdowns-repairs > 1 {
+				t.Errorf("%s seed %d: %v broke %d times, repaired %d times", run.file, run.seed, el, breakdowns, repairs)
+			}
+		}
+		for _, tt := range railway.Turntables {
+			check(tt, tt.breakdowns.Value(), tt.repairs.Value())
+		}
+		for _, nt := range railway.NormalTracks {
+			check(nt, nt.breakdowns.Value(), nt.repairs.Value())
+		}
+		for _, st := range railway.StationTracks {
+			check(st, st.breakdowns.Value(), st.repairs.Value())
+		}
+		for _, tr := range railway.Trains {
+			check(tr, tr.breakdowns.Value(), tr.repairs.Value())
+		}
+	}
+}
+
+func TestJobStatsInvariants(t *testing.T) {
+	for _, run := range []struct {
+		file  string
+		seed  int64
+		hours int
+	}{{"../../input", 7, 48}, {"../../input", 5, 100}, {"../../poland", 42, 72}} {
+		railway, data := runInput(t, run.file, run.seed, run.hours, false, true)
+		elapsed := data.Clock.Now()
+		var b bytes.Buffer
+		if err := WriteJobStats(&b, railway, data); err != nil {
+			t.Fatal(err)
+		}
+		workers := reportSection(t, b.String(), "workers")
+		jobs := reportSection(t, b.String(), "jobs")
+		stats := railway.Jobs()
+		if len(stats) == 0 || len(jobs) != len(stats)+1 || len(workers) != len(railway.Workers)+1 {
+			t.Fatalf("%s seed %d: %d jobs posted, report lists %d jobs and %d workers",
+				run.file, run.seed, len(stats), len(jobs)-1, len(workers)-1)
+		}
+
+		// times of every job and its workers follow one another
+		finished := make(map[*Worker]int64)
+		uncompleted := 0
+		for i, j := range stats {
+			ordered := func(times ...time.Duration) bool {
+				for k := 1; k < len(times); k++ {
+					if times[k] != NOT_YET && (times[k-1] == NOT_YET || times[k] < times[k-1]) {
+						return false
+					}
+				}
+				return times[len(times)-1] <= elapsed
+			}
+			if !ordered(0, j.Posted, j.Released, j.Finished) {
+				t.Errorf("%s seed %d: job %d posted %v, released %v, finished %v",
+					run.file, run.seed, i, j.Posted, j.Released, j.Finished)
+			}
+			for _, wt := range j.Workers {
+				if !ordered(j.Posted, wt.Arrived) || wt.Arrived != NOT_YET && j.Released != NOT_YET && wt.Arrived > j.Released ||
+					!ordered(j.Finished, wt.Home) || len(wt.Alighted) > len(wt.Boarded) {
+					t.Errorf("%s seed %d: job %d posted %v, released %v, finished %v, %v arrived %v, home %v",
+						run.file, run.seed, i, j.Posted, j.Released, j.Finished, wt.Worker, wt.Arrived, wt.Home)
+				}
+			}
+			if j.Finished != NOT_YET {
+				for _, wt := range j.Workers {
+					finished[wt.Worker]++
+				}
+			}
+			if !j.Completed() {
+				uncompleted++
+			}
+			row := jobs[i]
+			if there, waiting, back := column(t, row, 5), column(t, row, 6), column(t, row, 7); there < 0 || waiting < 0 || back < 0 {
+				t.Errorf("%s seed %d: job %v", run.file, run.seed, row)
+			}
+			if row[8] != j.State() {
+				t.Errorf("%s seed %d: job %d is %s, listed as %s", run.file, run.seed, i, j.State(), row[8])
+			}
+		}
+		if last := jobs[len(jobs)-1]; last[0] != "uncompleted" || column(t, last, 1) != float64(uncompleted) {
+			t.Errorf("%s seed %d: %v, want %d uncompleted", run.file, run.seed, last, uncompleted)
+		}
+
+		// workers finished jobs they took part in and never spent negative time on their way or waiting
+		var done float64
+		for i, w := range railway.Workers {
+			row := workers[i]
+			if column(t, row, 1) != float64(finished[w]) {
+				t.Errorf("%s seed %d: %v listed with %v jobs, finished %d", run.file, run.seed, w, row[1], finished[w])
+			}
+			if commute, waiting := column(t, row, 2), column(t, row, 3); commute < 0 || waiting < 0 || commute > elapsed.Hours() {
+				t.Errorf("%s seed %d: %v commuted %vh and waited %vh", run.file, run.seed, w, commute, waiting)
+			}
+			done += column(t, row, 1)
+		}
+		if total := workers[len(workers)-1]; total[0] != "total" || column(t, total, 1) != done || done == 0 {
+			t.Errorf("%s seed %d: %v, workers finished %v jobs", run.file, run.seed, total, done)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SUBSCRIPTION_BUFFER = 256 // events buffered for every subscriber
+)
+
+// Status describes lifecycle stage of Simulation.
+type Status int
+
+const (
+	Created Status = iota
+	Running
+	Paused
+	Stopped
+)
+
+func (s Status) String() string {
+	switch s {
+	case Created:
+		return "created"
+	case Running:
+		return "running"
+	case Paused:
+		return "paused"
+	case Stopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// eventBus delivers events to all subscribers. Delivery blocks until every
+// subscriber has room for the event, so subscribers must keep receiving.
+type eventBus struct {
+	mutex       sync.Mutex
+	subscribers []chan Event
+	done        <-chan struct{} // publishing gives up once done is closed
+}
+
+func (b *eventBus) subscribe() <-chan Event {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	ch := make(chan Event, SUBSCRIPTION_BUFFER)
+	b.subscribers = append(b.subscribers, ch)
+	return ch
+}
+
+func (b *eventBus) publish(e Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- e:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *eventBus) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, ch := range b.subscribers {
+		close(ch)
+	}
+	b.subscribers = nil
+}
+
+// Simulation is a handle to a single simulation run of railway described by RailwayData
+// and SimulationData. It lets programs start, pause and stop simulation, query its state
+// and subscribe to state changes.
+// A Simulation must be created using NewSimulation and can be started only once.
+type Simulation struct {
+	Railway *RailwayData
+	Data    *SimulationData
+	mutex   sync.Mutex
+	status  Status
+	cancel  context.CancelFunc
+	done    chan bool
+	err     error // first error returned by sinks
+	events  *eventBus
+	sinks   []Sink
+}
+
+// NewSimulation creates pointer to new Simulation of railway using data.
+// When data has no Clock, RealClock with data.SecondsPerHour is used.
+func NewSimulation(railway *RailwayData, data *SimulationData) *Simulation {
+	if data.Clock == nil {
+		data.Clock = NewRealClock(data.SecondsPerHour)
+	}
+	return &Simulation{
+		Railway: railway,
+		Data:    data,
+		status:  Created,
+		done:    make(chan bool),
+		events:  &eventBus{}}
+}
+
+// Subscribe returns channel receiving every Event published after the call.
+// The channel is closed when simulation stops. Subscribers must keep receiving,
+// simulation waits for slow subscribers.
+func (s *Simulation) Subscribe() <-chan Event { return s.events.subscribe() }
+
+// AddSink makes sink consume every Event published by simulation.
+// Sinks must be added before Start, Data.Statistics is consumed by TimetableSink added on Start.
+func (s *Simulation) AddSink(sink Sink) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status != Created {
+		return errors.New("can't add sink to started simulation")
+	}
+	s.sinks = append(s.sinks, sink)
+	return nil
+}
+
+// Start runs simulation in background. It ends when ctx is cancelled,
+// Stop is called or Data.Duration of simulated time passes.
+// Railway is validated first, simulation of invalid railway is not started.
+func (s *Simulation) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status != Created {
+		return errors.New("simulation has already been started")
+	}
+	if err := s.Railway.Validate(); err != nil {
+		return err
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.events.done = ctx.Done()
+	data := s.Data
+	data.events = s.events
+	if data.Statistics != nil {
+		s.sinks = append(s.sinks, NewTimetableSink(data.Statistics, s.Railway, data))
+	}
+	consumed := make(chan error, len(s.sinks))
+	for _, sink := range s.sinks {
+		go consume(sink, s.events.subscribe(), consumed)
+	}
+
+	wg := new(sync.WaitGroup)
+	simulate(ctx, s.Railway, data, wg)
+	s.status = Running
+
+	go func() {
+		wg.Wait()
+		s.cancel()
+		s.events.close()
+		var err error
+		for range s.sinks {
+			if e := <-consumed; err == nil {
+				err = e
+			}
+		}
+
+		s.mutex.Lock()
+		s.err = err
+		s.status = Stopped
+		s.mutex.Unlock()
+		close(s.done)
+	}()
+	return nil
+}
+
+// consume passes events to sink until events is closed and reports on consumed.
+// Sink is flushed whenever it caught up with events and once more at the end.
+// Events are still received after sink fails, so simulation is never blocked.
+func consume(sink Sink, events <-chan Event, consumed chan error) {
+	var err error
+	for e := range events {
+		if err == nil {
+			if err = sink.Consume(e); err == nil && len(events) == 0 {
+				err = sink.Flush()
+			}
+		}
+	}
+	if ferr := sink.Flush(); err == nil {
+		err = ferr
+	}
+	consumed <- err
+}
+
+// Stop cancels running simulation and waits until all its goroutines finish
+// and sinks are flushed.
+func (s *Simulation) Stop() {
+	s.mutex.Lock()
+	if s.status == Created {
+		s.status = Stopped
+		close(s.done)
+	}
+	cancel := s.cancel
+	s.mutex.Unlock()
+
+	if cancel != nil {
+		if s.Paused() {
+			s.Data.Clock.Resume()
+		}
+		cancel()
+	}
+	<-s.done
+}
+
+// Pause stops simulated time of running simulation.
+func (s *Simulation) Pause() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status != Running {
+		return fmt.Errorf("can't pause %v simulation", s.status)
+	}
+	s.Data.Clock.Pause()
+	s.status = Paused
+	return nil
+}
+
+// Resume lets simulated time of paused simulation flow again.
+func (s *Simulation) Resume() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status != Paused {
+		return fmt.Errorf("can't resume %v simulation", s.status)
+	}
+	s.Data.Clock.Resume()
+	s.status = Running
+	return nil
+}
+
+// Paused reports whether simulation is paused.
+func (s *Simulation) Paused() bool { return s.Status() == Paused }
+
+// Status returns current lifecycle stage of simulation.
+func (s *Simulation) Status() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status
+}
+
+// Done returns channel that is closed when simulation stops.
+func (s *Simulation) Done() <-chan bool { return s.done }
+
+// Err returns first error returned by sinks, valid after simulation stops.
+func (s *Simulation) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// Snapshot describes state of Simulation at one moment.
+type Snapshot struct {
+	Status      Status
+	Elapsed     time.Duration // simulated time since start
+	Clock       string        // simulation clock as hh:mm:ss
+	Trains      []Position
+	RepairTeams []Position
+	Jobs        int64 // jobs finished by all workers
+}
+
+// Position tells which Track is occupied by a train or repair team.
+type Position struct {
+	ID   int
+	Name string // human-friendly label of train or repair team
+	At   string // human-friendly label of occupied Track
+}
+
+// State returns snapshot of simulation state.
+func (s *Simulation) State() Snapshot {
+	snapshot := Snapshot{Status: s.Status()}
+	if snapshot.Status != Created {
+		snapshot.Elapsed = s.Data.Clock.Now()
+		snapshot.Clock = ClockTime(s.Data)
+	}
+	for _, t := range s.Railway.Trains {
+		snapshot.Trains = append(snapshot.Trains, Position{t.id, t.String(), t.At().String()})
+	}
+	if s.Data.SimulateRepairs {
+		for _, rt := range s.Railway.RepairTeams {
+			snapshot.RepairTeams = append(snapshot.RepairTeams, Position{rt.id, rt.String(), rt.At().String()})
+		}
+	}
+	for _, w := range s.Railway.Workers {
+		snapshot.Jobs += w.jobs.Value()
+	}
+	return snapshot
+}
+
+// position stores Track safe for concurrent use.
+type position struct{ value atomic.Value }
+
+type positionValue struct{ track Track }
+
+func (p *position) Set(track Track) { p.value.Store(positionValue{track}) }
+func (p *position) Get() Track {
+	v, _ := p.value.Load().(positionValue)
+	return v.track
+}
@@ -0,0 +1,136 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// receiveUntil receives events until one published after elapsed, failing when none comes in a minute.
+func receiveUntil(t *testing.T, events <-chan Event, elapsed time.Duration) Event {
+	t.Helper()
+	timeout := time.After(time.Minute)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed before %v", elapsed)
+			}
+			if e.Time > elapsed {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no event after %v", elapsed)
+		}
+	}
+}
+
+func TestSimulationLifecycle(t *testing.T) {
+	in, err := os.Open("../../input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := Load(in, TextFormat, data, railway); err != nil {
+		t.Fatal(err)
+	}
+	data.Clock = NewEventClock()
+	data.Seed = 7
+	data.Duration = 0
+	data.SimulateRepairs, data.SimulateWorkers = true, true
+
+	simulation := NewSimulation(railway, data)
+	if s := simulation.State(); s.Status != Created || s.Elapsed != 0 || len(s.Trains) != len(railway.Trains) {
+		t.Errorf("new simulation: %+v", s)
+	}
+	if simulation.Pause() == nil || simulation.Resume() == nil {
+		t.Error("simulation paused or resumed before start")
+	}
+
+	events := simulation.Subscribe()
+	if err := simulation.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if simulation.Start(context.Background()) == nil {
+		t.Error("simulation started twice")
+	}
+	if simulation.AddSink(NewJSONSink(ioutil.Discard)) == nil {
+		t.Error("sink added to started simulation")
+	}
+	if s := simulation.Status(); s != Running {
+		t.Errorf("started simulation is %v", s)
+	}
+	if simulation.Resume() == nil {
+		t.Error("running simulation resumed")
+	}
+	receiveUntil(t, events, 3*time.Hour)
+
+	// paused simulated time stands still however long subscriber waits
+	if err := simulation.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if simulation.Pause() == nil {
+		t.Error("simulation paused twice")
+	}
+	paused := simulation.State()
+	if paused.Status != Paused || paused.Elapsed <= 3*time.Hour || paused.Clock == "" {
+		t.Errorf("paused simulation: %+v", paused)
+	}
+	for drained := false; !drained; {
+		select {
+		case e := <-events:
+			if e.Time > paused.Elapsed {
+				t.Errorf("%v published at %v while paused at %v", e.Kind, e.Time, paused.Elapsed)
+			}
+		case <-time.After(50 * time.Millisecond):
+			drained = true
+		}
+	}
+	if s := simulation.State(); s.Elapsed != paused.Elapsed || s.Clock != paused.Clock {
+		t.Errorf("paused at %v %s, %v %s later", paused.Elapsed, paused.Clock, s.Elapsed, s.Clock)
+	}
+
+	if err := simulation.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if s := simulation.Status(); s != Running {
+		t.Errorf("resumed simulation is %v", s)
+	}
+	receiveUntil(t, events, paused.Elapsed+time.Hour)
+
+	// subscription is closed once Stop returns, events already buffered are the last ones
+	simulation.Stop()
+	stopped := simulation.State()
+	if stopped.Status != Stopped || stopped.Elapsed < paused.Elapsed+time.Hour {
+		t.Errorf("stopped simulation: %+v", stopped)
+	}
+	timeout := time.After(time.Minute)
+	for closed := false; !closed; {
+		select {
+		case e, ok := <-events:
+			if ok && e.Time > stopped.Elapsed {
+				t.Errorf("%v published at %v after stop at %v", e.Kind, e.Time, stopped.Elapsed)
+			}
+			closed = !ok
+		case <-timeout:
+			t.Fatal("subscription not closed after stop")
+		}
+	}
+	if err := simulation.Err(); err != nil {
+		t.Error(err)
+	}
+	if simulation.Pause() == nil || simulation.Resume() == nil {
+		t.Error("simulation paused or resumed after stop")
+	}
+	if s := simulation.State(); s.Elapsed != stopped.Elapsed {
+		t.Errorf("simulated time went from %v to %v after stop", stopped.Elapsed, s.Elapsed)
+	}
+	// stopping again returns at once
+	simulation.Stop()
+}
@@ -9,9 +9,38 @@ import (
 	"sync"
 )
 
+// Role tells what Station is used for.
+type Role int
+
+const (
+	Passenger Role = iota // trains stop here, workers live and work here
+	Depot                 // repair teams are based here, workers don't work here
+	Freight               // trains stop here, workers work here but don't live here
+)
+
+var roleNames = [...]string{"passenger", "depot", "freight"}
+
+func (r Role) String() string {
+	if r >= 0 && int(r) < len(roleNames) {
+		return roleNames[r]
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole returns Role named as in railway description.
+func ParseRole(s string) (Role, error) {
+	for i, name := range roleNames {
+		if strings.EqualFold(s, name) {
+			return Role(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q, expected one of: %s", s, strings.Join(roleNames[:], ", "))
+}
+
 type Station struct {
 	id            int
 	Name          string
+	Role          Role
 	first         *Turntable
 	second        *Turntable
 	Residents     WorkerSlice
@@ -20,6 +49,8 @@ type Station struct {
 	TicketsFor    map[*Train]Tickets
 	ticketsMutex  sync.Mutex
 	Destinations  StationSlice
+	visits        counter // train stops at any of StationTracks
+	boardings     counter // workers who got on trains here
 }
 
 func NewStation(id int, initial *StationTrack) (station *Station) {
@@ -37,6 +68,9 @@ func NewStation(id int, initial *StationTrack) (station *Station) {
 
 func (s *Station) ID() int { return s.id }
 
+// Workplace reports whether workers can be sent to work at s.
+func (s *Station) Workplace() bool { return s.Role != Depot }
+
 func (s *Station) Connects(first, second *Turntable) bool {
 	return (s.first == first && s.second == second) || (s.first == second && s.second == first)
 }
@@ -48,6 +82,6 @@ func (s *Station) String() string {
 }
 func (s *Station) GoString() string {
 	return fmt.Sprintf(
-		"rails.Station:%s:%d{turntables: (%s, %s)}",
-		s.Name, s.id, s.first, s.second)
+		"rails.Station:%s:%d{role: %v, turntables: (%s, %s)}",
+		s.Name, s.id, s.Role, s.first, s.second)
 }
@@ -0,0 +1,176 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Layouts of lines in sections of text railway description.
+const (
+	SECONDS_PER_HOUR_LAYOUT = "secondsPerHour"
+	CLOCK_LAYOUT            = "hours minutes [simulated hours to run]"
+	AMOUNTS_LAYOUT          = "repairTeams trains turntables normalTracks stationTracks workers"
+	TURNTABLES_LAYOUT       = "id time repairTime [name]"
+	NORMAL_TRACKS_LAYOUT    = "id len limit repairTime from to"
+	STATION_TRACKS_LAYOUT   = "id name time repairTime from to [role]"
+	REPAIR_TEAMS_LAYOUT     = "id speed stationId|station"
+	TRAINS_LAYOUT           = "id speed capacity repairTime name len(route)"
+	ROUTE_LAYOUT            = "route by ids or names"
+	WORKERS_LAYOUT          = "id stationId|station"
+	OPTIONAL_LAYOUT         = "failure|dispatcher|demand|job|plan [fields]"
+	FAILURES_LAYOUT         = "failure element id|name|* model [parameters]"
+	DISPATCHER_LAYOUT       = "dispatcher policy [minWait waitSpan minWorkers workersSpan minWork workSpan]"
+	DEMAND_LAYOUT           = "demand stationId|station weight"
+	JOBS_LAYOUT             = "job hours minutes duration stationId|station workers"
+	PLAN_LAYOUT             = "plan trainId|train stationId|station arrival departure"
+)
+
+// writeText writes desc in text format read by Parse, with section comments.
+func writeText(w io.Writer, desc *Description) error {
+	// names are single fields of text format
+	names := make([]string, 0)
+	for _, tt := range desc.Turntables {
+		names = append(names, tt.Name)
+	}
+	for _, st := range desc.StationTracks {
+		if st.Name == "" {
+			return fmt.Errorf("station track %d has no name, it can't be written in text format", st.ID)
+		}
+		names = append(names, st.Name)
+	}
+	for _, t := range desc.Trains {
+		if t.Name == "" {
+			return fmt.Errorf("train %d has no name, it can't be written in text format", t.ID)
+		}
+		names = append(names, t.Name)
+	}
+	for _, name := range names {
+		if strings.ContainsAny(name, " \t\n") || strings.HasPrefix(name, "#") {
+			return fmt.Errorf("name %q can't be written in text format", name)
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	section := func(title, layout string) {
+		fmt.Fprintf(b, "# %s\n# %s\n", title, layout)
+	}
+
+	fmt.Fprintf(b, "# seconds for hour simulation\n%d\n\n", desc.SecondsPerHour)
+
+	section("simulation clock start", CLOCK_LAYOUT)
+	if desc.Clock.Duration > 0 {
+		fmt.Fprintf(b, "%d %02d %d\n\n", desc.Clock.Hours, desc.Clock.Minutes, desc.Clock.Duration)
+	} else {
+		fmt.Fprintf(b, "%d %02d\n\n", desc.Clock.Hours, desc.Clock.Minutes)
+	}
+
+	section("amount of defined objects:", AMOUNTS_LAYOUT)
+	fmt.Fprintf(b, "%d %d %d %d %d %d\n\n", len(desc.RepairTeams), len(desc.Trains), len(desc.Turntables),
+		len(desc.NormalTracks), len(desc.StationTracks), len(desc.Workers))
+
+	section("turntables:", TURNTABLES_LAYOUT)
+	for _, tt := range desc.Turntables {
+		line := fmt.Sprintf("%d %d %d", tt.ID, tt.Time, tt.RepairTime)
+		if tt.Name != "" {
+			line += " " + strings.ToLower(tt.Name)
+		}
+		fmt.Fprintln(b, line)
+	}
+	fmt.Fprintln(b)
+
+	section("normalTracks:", NORMAL_TRACKS_LAYOUT)
+	for _, nt := range desc.NormalTracks {
+		fmt.Fprintf(b, "%d %d %d %d %s %s\n", nt.ID, nt.Len, nt.Limit, nt.RepairTime, textRef(nt.From), textRef(nt.To))
+	}
+	fmt.Fprintln(b)
+
+	section("stationTracks:", STATION_TRACKS_LAYOUT)
+	fmt.Fprintf(b, "# roles: passenger (default), depot (default for stations of repair teams), freight\n")
+	for _, st := range desc.StationTracks {
+		line := fmt.Sprintf("%d %s %d %d %s %s",
+			st.ID, strings.ToLower(st.Name), st.Time, st.RepairTime, textRef(st.From), textRef(st.To))
+		if st.Role != "" {
+			line += " " + st.Role
+		}
+		fmt.Fprintln(b, line)
+	}
+	fmt.Fprintln(b)
+
+	section("repairTeam:", REPAIR_TEAMS_LAYOUT)
+	for _, rt := range desc.RepairTeams {
+		fmt.Fprintf(b, "%d %d %s\n", rt.ID, rt.Speed, textRef(rt.Station))
+	}
+	fmt.Fprintln(b)
+
+	section("trains:", TRAINS_LAYOUT)
+	fmt.Fprintf(b, "# %s\n", ROUTE_LAYOUT)
+	for _, t := range desc.Trains {
+		route := make([]string, len(t.Route))
+		for i, ref := range t.Route {
+			route[i] = textRef(ref)
+		}
+		fmt.Fprintf(b, "\n%d %d %d %d %s %d\n%s\n",
+			t.ID, t.Speed, t.Capacity, t.RepairTime, strings.ToLower(t.Name), len(route), strings.Join(route, " "))
+	}
+	fmt.Fprintln(b)
+
+	section("workers", WORKERS_LAYOUT)
+	for _, w := range desc.Workers {
+		fmt.Fprintf(b, "%d %s\n", w.ID, textRef(w.Station))
+	}
+
+	if len(desc.Failures) > 0 {
+		fmt.Fprintln(b)
+		section("failures, later lines override earlier ones:", FAILURES_LAYOUT)
+		fmt.Fprintf(b, "# %s\n", FAILURE_MODELS_LAYOUT)
+		for _, f := range desc.Failures {
+			model, err := f.model()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(b, "failure %s %s %s\n", f.Element, textRef(f.ID), FailureString(model))
+		}
+	}
+
+	if d := desc.Dispatcher; d != nil {
+		fmt.Fprintln(b)
+		section("dispatcher, demand and job lines follow dispatcher line:", DISPATCHER_LAYOUT)
+		fmt.Fprintf(b, "# %s\n# %s\n", DEMAND_LAYOUT, JOBS_LAYOUT)
+		if t := d.Timing; t != nil {
+			fmt.Fprintf(b, "dispatcher %s %d %d %d %s %d %d\n", d.Policy, t.MinWait, t.WaitSpan, t.MinWorkers,
+				strconv.FormatFloat(t.WorkersSpan, 'g', -1, 64), t.MinWork, t.WorkSpan)
+		} else {
+			fmt.Fprintf(b, "dispatcher %s\n", d.Policy)
+		}
+		for _, demand := range d.Demand {
+			fmt.Fprintf(b, "demand %s %s\n", textRef(demand.Station), strconv.FormatFloat(demand.Weight, 'g', -1, 64))
+		}
+		for _, job := range d.Jobs {
+			workers := make([]string, len(job.Workers))
+			for i, w := range job.Workers {
+				workers[i] = strconv.Itoa(w)
+			}
+			fmt.Fprintf(b, "job %d %02d %d %s %s\n",
+				job.Hours, job.Minutes, job.Duration, textRef(job.Station), strings.Join(workers, " "))
+		}
+	}
+
+	if len(desc.Plan) > 0 {
+		fmt.Fprintln(b)
+		section("planned timetable, stops of every train in order of travel, times as hh:mm[:ss]:", PLAN_LAYOUT)
+		for _, p := range desc.Plan {
+			fmt.Fprintf(b, "plan %s %s %s %s\n", textRef(p.Train), textRef(p.Station), p.Arrival, p.Departure)
+		}
+	}
+
+	return b.Flush()
+}
+
+// textRef returns ref as written in text format, names are matched regardless of case.
+func textRef(ref Ref) string { return strings.ToLower(string(ref)) }
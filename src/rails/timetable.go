@@ -0,0 +1,326 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimetableFormat selects how timetable of train stops is written.
+type TimetableFormat int
+
+const (
+	TimetableText TimetableFormat = iota // lines of TimetableSink
+	TimetableCSV                         // CSV of StopSink with header line
+	TimetableJSON                        // JSON Lines of StopSink
+)
+
+var timetableFormatNames = [...]string{"text", "csv", "jsonl"}
+
+func (f TimetableFormat) String() string {
+	if f >= 0 && int(f) < len(timetableFormatNames) {
+		return timetableFormatNames[f]
+	}
+	return fmt.Sprintf("TimetableFormat(%d)", int(f))
+}
+
+// TimetableFormatOf returns TimetableFormat of file by its extension: .csv and .jsonl files hold records
+// of StopSink, files with other extensions hold lines of TimetableSink.
+func TimetableFormatOf(filename string) TimetableFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return TimetableCSV
+	case ".jsonl":
+		return TimetableJSON
+	}
+	return TimetableText
+}
+
+// Stop is a single stop of train at station track, from its arrival until departure.
+type Stop struct {
+	Train       int
+	TrainName   string
+	Station     int
+	StationName string
+	Track       int           // StationTrack ID
+	Arrival     time.Duration // simulated time elapsed since start
+	Departure   time.Duration
+	Boarded     int // workers who got on the train
+	Alighted    int // workers who got off the train
+}
+
+// Dwell returns how long train stood at station track.
+func (s Stop) Dwell() time.Duration { return s.Departure - s.Arrival }
+
+var stopColumns = []string{"train", "trainName", "station", "stationName", "track",
+	"arrival", "departure", "dwell", "boarded", "alighted"}
+
+// StopSink writes every completed Stop of trains, as CSV or JSON Lines record, once train departs.
+// Arrival and departure are written as simulation clock, dwell in simulated seconds.
+// Stops of trains still standing at stations when simulation ends are not written.
+type StopSink struct {
+	w       *bufio.Writer
+	csv     *csv.Writer // nil for JSON Lines
+	railway *RailwayData
+	data    *SimulationData
+	stops   map[int]*Stop // stops in progress by Train ID
+}
+
+// NewStopSink creates pointer to new StopSink writing to w in format, which must be TimetableCSV or TimetableJSON.
+func NewStopSink(w io.Writer, format TimetableFormat, railway *RailwayData, data *SimulationData) (*StopSink, error) {
+	s := &StopSink{w: bufio.NewWriter(w), railway: railway, data: data, stops: make(map[int]*Stop)}
+	switch format {
+	case TimetableCSV:
+		s.csv = csv.NewWriter(s.w)
+		if err := s.csv.Write(stopColumns); err != nil {
+			return nil, err
+		}
+	case TimetableJSON:
+	default:
+		return nil, fmt.Errorf("stops can't be written in %v format", format)
+	}
+	return s, nil
+}
+
+func (s *StopSink) Consume(e Event) error {
+	switch e.Kind {
+	case StationArrival:
+		stop := &Stop{Train: e.Train, Station: e.Station, Track: e.Element.ID, Arrival: e.Time}
+		if e.Train >= 0 && e.Train < len(s.railway.Trains) {
+			stop.TrainName = s.railway.Trains[e.Train].Name
+		}
+		if e.Station >= 0 && e.Station < len(s.railway.Stations) {
+			stop.StationName = s.railway.Stations[e.Station].Name
+		}
+		s.stops[e.Train] = stop
+	case Boarded, Alighted:
+		stop, ok := s.stops[e.Train]
+		if !ok || stop.Station != e.Station {
+			return nil
+		}
+		if e.Kind == Boarded {
+			stop.Boarded++
+		} else {
+			stop.Alighted++
+		}
+	case StationDeparture:
+		stop, ok := s.stops[e.Train]
+		if !ok {
+			return nil
+		}
+		delete(s.stops, e.Train)
+		stop.Departure = e.Time
+		return s.write(stop)
+	}
+	return nil
+}
+
+func (s *StopSink) write(stop *Stop) error {
+	if s.csv != nil {
+		return s.csv.Write([]string{
+			strconv.Itoa(stop.Train), stop.TrainName, strconv.Itoa(stop.Station), stop.StationName,
+			strconv.Itoa(stop.Track), s.data.ClockAt(stop.Arrival), s.data.ClockAt(stop.Departure),
+			strconv.Itoa(int(stop.Dwell().Seconds())), strconv.Itoa(stop.Boarded), strconv.Itoa(stop.Alighted)})
+	}
+	b, err := json.Marshal(struct {
+		Train       int    `json:"train"`
+		TrainName   string `json:"trainName"`
+		Station     int    `json:"station"`
+		StationName string `json:"stationName"`
+		Track       int    `json:"track"`
+		Arrival     string `json:"arrival"`
+		Departure   string `json:"departure"`
+		Dwell       int    `json:"dwell"`
+		Boarded     int    `json:"boarded"`
+		Alighted    int    `json:"alighted"`
+	}{stop.Train, stop.TrainName, stop.Station, stop.StationName, stop.Track,
+		s.data.ClockAt(stop.Arrival), s.data.ClockAt(stop.Departure),
+		int(stop.Dwell().Seconds()), stop.Boarded, stop.Alighted})
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *StopSink) Flush() error {
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+// ON_TIME_DELAY is the largest arrival delay of stop still counted as on time.
+const ON_TIME_DELAY = 5 * time.Minute
+
+// EARLY_STOP_LIMIT is how long before planned arrival train can come to make the planned stop,
+// stops at the station made earlier are not matched with it.
+const EARLY_STOP_LIMIT = 30 * time.Minute
+
+// PlannedStop is stop of Train at Station expected by timetable of railway description.
+// Arrival and Departure are times of day. Stops of every train are planned in order of travel,
+// time earlier than the previous one of the same train falls on the next day.
+type PlannedStop struct {
+	Train     *Train
+	Station   *Station
+	Arrival   time.Duration
+	Departure time.Duration
+}
+
+// newPlannedStop creates stop of train at station planned at times of day written as hh:mm[:ss].
+func newPlannedStop(train *Train, station *Station, arrival, departure string) (PlannedStop, error) {
+	a, err := parseTimeOfDay(arrival)
+	if err != nil {
+		return PlannedStop{}, fmt.Errorf("field arrival: %v", err)
+	}
+	d, err := parseTimeOfDay(departure)
+	if err != nil {
+		return PlannedStop{}, fmt.Errorf("field departure: %v", err)
+	}
+	return PlannedStop{train, station, a, d}, nil
+}
+
+// parseTimeOfDay reads time of day written as hh:mm[:ss].
+func parseTimeOfDay(s string) (time.Duration, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, fmt.Errorf("%q is not a time of day, expected hh:mm[:ss]", s)
+	}
+	limits := []int{24, 60, 60}
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 || n >= limits[i] {
+			return 0, fmt.Errorf("%q is not a time of day, expected hh:mm[:ss]", s)
+		}
+		d += time.Duration(n) * units[i]
+	}
+	return d, nil
+}
+
+// formatTimeOfDay writes time of day as hh:mm, followed by seconds when there are any.
+func formatTimeOfDay(d time.Duration) string {
+	s := fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	if sec := d % time.Minute; sec != 0 {
+		s += fmt.Sprintf(":%02d", int(sec/time.Second))
+	}
+	return s
+}
+
+// StopDelay compares planned stop of train with the actual one. Planned times are simulated time
+// elapsed since start, actual Arrival and Departure are NOT_YET until train arrives and departs.
+type StopDelay struct {
+	Station          *Station
+	PlannedArrival   time.Duration
+	PlannedDeparture time.Duration
+	Arrival          time.Duration
+	Departure        time.Duration
+}
+
+// ArrivalDelay returns how late train arrived, negative when early. It is meaningful only after arrival.
+func (s StopDelay) ArrivalDelay() time.Duration { return s.Arrival - s.PlannedArrival }
+
+// DepartureDelay returns how late train departed, negative when early. It is meaningful only after departure.
+func (s StopDelay) DepartureDelay() time.Duration { return s.Departure - s.PlannedDeparture }
+
+// Due reports whether stop was made or should have been made by now.
+func (s StopDelay) Due(now time.Duration) bool {
+	return s.Arrival != NOT_YET || s.PlannedArrival <= now
+}
+
+// OnTime reports whether train arrived no later than ON_TIME_DELAY after planned arrival.
+func (s StopDelay) OnTime() bool { return s.Arrival != NOT_YET && s.ArrivalDelay() <= ON_TIME_DELAY }
+
+// timetable returns planned stops of train t in order of travel, at simulated time since start.
+func (d *SimulationData) timetable(plan []PlannedStop, t *Train) []StopDelay {
+	day := 24 * time.Hour
+	var last time.Duration
+	// elapsed returns the first moment at or after the last planned time when clock shows time of day at
+	elapsed := func(at time.Duration) time.Duration {
+		e := ((at-d.start())%day + day) % day
+		for e < last {
+			e += day
+		}
+		last = e
+		return e
+	}
+	var stops []StopDelay
+	for _, p := range plan {
+		if p.Train == t {
+			arrival := elapsed(p.Arrival)
+			stops = append(stops, StopDelay{p.Station, arrival, elapsed(p.Departure), NOT_YET, NOT_YET})
+		}
+	}
+	return stops
+}
+
+// planArrival matches arrival of t at station with the next planned stop of t, unless train came too early for it.
+func (t *Train) planArrival(station *Station, now time.Duration) {
+	t.planLock.Lock()
+	defer t.planLock.Unlock()
+	t.stopping = -1
+	if t.nextStop < len(t.plan) {
+		if s := &t.plan[t.nextStop]; s.Station == station && now >= s.PlannedArrival-EARLY_STOP_LIMIT {
+			s.Arrival = now
+			t.stopping = t.nextStop
+			t.nextStop++
+		}
+	}
+}
+
+// planDeparture notes departure of t from planned stop it is making.
+func (t *Train) planDeparture(now time.Duration) {
+	t.planLock.Lock()
+	defer t.planLock.Unlock()
+	if t.stopping >= 0 {
+		t.plan[t.stopping].Departure = now
+		t.stopping = -1
+	}
+}
+
+// Delays returns planned stops of t compared with actual ones made so far, in order of travel.
+func (t *Train) Delays() []StopDelay {
+	t.planLock.Lock()
+	defer t.planLock.Unlock()
+	return append([]StopDelay{}, t.plan...)
+}
+
+// Line returns name of line t runs on: names of stations along its route, starting from the same
+// station for all trains running the same route, whichever turntable they start from.
+func (t *Train) Line() string {
+	n := len(t.Connects)
+	ids := make([]int, 2*n)
+	for i, s := range t.Connects {
+		ids[i], ids[i+n] = s.id, s.id
+	}
+	// least rotation of station ids
+	first := 0
+	for i := 1; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if ids[i+j] != ids[first+j] {
+				if ids[i+j] < ids[first+j] {
+					first = i
+				}
+				break
+			}
+		}
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = t.Connects[(first+i)%n].Name
+	}
+	return strings.Join(names, "-")
+}
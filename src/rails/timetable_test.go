@@ -0,0 +1,126 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// runStops simulates input on EventClock with workers for given hours and returns stops written by StopSink in format.
+func runStops(t *testing.T, format TimetableFormat, seed int64, hours int) []byte {
+	t.Helper()
+	in, err := os.Open("../../input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := Load(in, TextFormat, data, railway); err != nil {
+		t.Fatal(err)
+	}
+	data.Clock = NewEventClock()
+	data.Seed = seed
+	data.Duration = time.Duration(hours) * time.Hour
+	data.SimulateWorkers = true
+
+	var stops bytes.Buffer
+	sink, err := NewStopSink(&stops, format, railway, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulation := NewSimulation(railway, data)
+	if err := simulation.AddSink(sink); err != nil {
+		t.Fatal(err)
+	}
+	if err := simulation.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-simulation.Done():
+	case <-time.After(time.Minute):
+		simulation.Stop()
+		t.Fatalf("simulation of %dh did not end", hours)
+	}
+	if err := simulation.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return stops.Bytes()
+}
+
+func TestStopSinkGolden(t *testing.T) {
+	for _, c := range []struct {
+		format TimetableFormat
+		file   string
+	}{{TimetableCSV, "testdata/stops.csv"}, {TimetableJSON, "testdata/stops.jsonl"}} {
+		got := runStops(t, c.format, 7, 24)
+		if *update {
+			if err := ioutil.WriteFile(c.file, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := ioutil.ReadFile(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%v stops differ from %s, run go test -update if change is intended:\n%s", c.format, c.file, got)
+		}
+	}
+}
+
+func TestStopSinkFormatsAgree(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(runStops(t, TimetableCSV, 7, 24))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) < 10 || strings.Join(records[0], ",") != strings.Join(stopColumns, ",") {
+		t.Fatalf("csv has header %v and %d stops", records[0], len(records)-1)
+	}
+	lines := strings.Split(strings.TrimSpace(string(runStops(t, TimetableJSON, 7, 24))), "\n")
+	if len(lines) != len(records)-1 {
+		t.Fatalf("%d json lines, %d csv records", len(lines), len(records)-1)
+	}
+
+	var boarded, alighted int
+	for i, line := range lines {
+		var stop map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &stop); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		// every column holds the same value in both formats
+		for j, column := range stopColumns {
+			var value string
+			switch v := stop[column].(type) {
+			case float64:
+				value = strconv.Itoa(int(v))
+			case string:
+				value = v
+			}
+			if value != records[i+1][j] {
+				t.Errorf("stop %d: %s is %v in json, %s in csv", i, column, stop[column], records[i+1][j])
+			}
+		}
+		if stop["dwell"].(float64) <= 0 {
+			t.Errorf("stop %d: dwell %v", i, stop["dwell"])
+		}
+		boarded += int(stop["boarded"].(float64))
+		alighted += int(stop["alighted"].(float64))
+	}
+	// workers get off where they got on, those still on the way got on but not off yet
+	if boarded == 0 || alighted == 0 || alighted > boarded {
+		t.Errorf("%d workers boarded and %d alighted", boarded, alighted)
+	}
+}
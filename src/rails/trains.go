@@ -4,15 +4,13 @@
 package rails
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"strconv"
 	"strings"
 	"sync"
-)
-
-const (
-	TRAIN_BREAK_PROBABILITY = 0.02
+	"time"
 )
 
 type TrainSlice []*Train
@@ -30,16 +28,36 @@ type Train struct {
 	speed        int // maximum speed in km/h
 	capacity     int // how many people can board the train
 	repairTime   int
-	Name         string // Train's name for pretty printing
-	route        Route  // cycle on railroad represented by TurntableSlice
-	index        int    // current position on route (last visited Turntable)
-	at           Track  // current position, Track the train occupies
+	random       *rand.Rand // source for break rolls, set by Simulate
+	failure      failure
+	Name         string   // Train's name for pretty printing
+	route        Route    // cycle on railroad represented by TurntableSlice
+	index        int      // current position on route (last visited Turntable)
+	at           position // current position, Track the train occupies
 	Connects     StationSlice
 	validTickets Tickets
 	Seats        chan bool
-	Done         chan bool
-	Repaired     chan bool
+	Done         *Port
+	Repaired     *Port
 	Broke        chan *Train
+	cycles       counter // completed route cycles
+	visits       counter // stops at station tracks
+	breakdowns   counter
+	repairs      counter
+	dropped      counter       // failures no repair team took
+	down         gauge         // 1 while broken
+	moving       timer         // travelling along normal tracks and rotating on turntables
+	dwelling     timer         // standing at station tracks
+	blocked      timer         // waiting for free track or turntable
+	broken       timer         // waiting for repair
+	state        *timer        // timer of interval in progress, used only by Simulate
+	since        time.Duration // start of interval in progress
+	distance     map[int]int   // km travelled on normal tracks by ID
+	distanceLock sync.Mutex
+	plan         []StopDelay // planned stops in order of travel, set by Simulate
+	nextStop     int         // index of the next planned stop in plan
+	stopping     int         // index of planned stop train is making, -1 when none
+	planLock     sync.Mutex
 }
 
 // NewTrain creates pointer to new Train type instance.
@@ -54,77 +72,174 @@ func NewTrain(id, speed, cap, repTime int, name string, route Route) (train *Tra
 		Name:         strings.Title(name),
 		route:        route,
 		index:        0,
-		at:           route[0],
 		Connects:     make(StationSlice, 0),
 		validTickets: make(Tickets, 0),
 		Seats:        make(chan bool, cap),
-		Done:         make(chan bool),
-		Repaired:     make(chan bool),
-		Broke:        make(chan *Train, 1)}
+		Done:         NewPort(),
+		Repaired:     NewPort(),
+		Broke:        make(chan *Train, 1),
+		distance:     make(map[int]int),
+		stopping:     -1}
+	train.failure.model = DefaultFailure(TrainElement)
+	train.at.Set(route[0])
 	return
 }
 
-func (t *Train) Simulate(railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
+func (t *Train) Simulate(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	logger.Printf("%s %v starts work", ClockTime(data), t)
+	t.planLock.Lock()
+	t.plan = data.timetable(railway.Plan, t)
+	t.planLock.Unlock()
+
+	data.publish(trainEvent(TrainStarted, t, t.At()))
+
+	// every moment is spent in one state, so states sum up to simulated time, the last one ends with simulation
+	t.spend(&t.moving, data.Clock.Now())
+	defer func() { t.spend(nil, data.Clock.Now()) }()
 
 	track := t.At().(*Turntable)
-	track.Rider <- t
-	<-t.Done
-	<-track.Done
+	if !track.Rider.Send(ctx, data.Clock, t) {
+		return
+	}
+	if !await(ctx, data.Clock, t.Done) || !await(ctx, data.Clock, track.Done) {
+		return
+	}
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-t.Broke:
-			select {
-			case railway.RepairChannel <- t:
-				logger.Printf("%s %v broke", ClockTime(data), t)
-				<-t.Repaired
-				logger.Printf("%s %v repaired", ClockTime(data), t)
-			default:
-				continue
+			if railway.RepairChannel.TrySend(data.Clock, t) {
+				t.breakdowns.inc()
+				data.publish(brokenEvent(t))
+				t.down.set(1)
+				t.spend(&t.broken, data.Clock.Now())
+				if !await(ctx, data.Clock, t.Repaired) {
+					return
+				}
+				t.down.set(0)
+				t.repairs.inc()
+				t.failure.repaired(data.Clock.Now())
+			} else {
+				t.dropped.inc()
 			}
 		default:
 			// get nearest TurntableSlice
 			fst, snd := t.Connection()
+			waiting := data.Clock.Now()
+			t.spend(&t.blocked, waiting)
 		Loop1: // search for available Track connecting `fst` and `snd`
 			for {
 				for _, r := range railway.Connections[fst.ID()][snd.ID()] {
 					switch r.(type) {
 					case *StationTrack:
 						r := r.(*StationTrack)
-						select {
-						case r.Rider <- t:
-							<-r.Done
+						if r.Rider.TrySend(data.Clock, t) {
+							entered := data.Clock.Now()
+							t.spend(&t.dwelling, entered)
+							r.waited.add(entered - waiting)
+							if !await(ctx, data.Clock, r.Done) {
+								return
+							}
 							break Loop1
-						default:
-							continue
 						}
 					case *NormalTrack:
 						r := r.(*NormalTrack)
-						select {
-						case r.Rider <- t:
-							<-r.Done
+						if r.Rider.TrySend(data.Clock, t) {
+							entered := data.Clock.Now()
+							t.spend(&t.moving, entered)
+							r.waited.add(entered - waiting)
+							if !await(ctx, data.Clock, r.Done) {
+								return
+							}
+							t.travelled(r)
 							break Loop1
-						default:
-							continue
 						}
 					}
 				}
+				if data.Clock.Yield(ctx) != nil {
+					return
+				}
 			}
-			snd.Rider <- t
+			waiting = data.Clock.Now()
+			t.spend(&t.blocked, waiting)
+			if !snd.Rider.Send(ctx, data.Clock, t) {
+				return
+			}
+			entered := data.Clock.Now()
+			t.spend(&t.moving, entered)
+			snd.waited.add(entered - waiting)
 			t.NextPosition()
-			<-snd.Done
+			if !await(ctx, data.Clock, snd.Done) {
+				return
+			}
+			if t.index == 0 {
+				t.cycles.inc()
+			}
 
-			if rand.Float64() < TRAIN_BREAK_PROBABILITY {
+			if t.failure.breaks(t.random, data.Clock.Now()) {
 				t.Broke <- t
 			}
 		}
 	}
 }
 
-func (t *Train) letPassengersOut(station *Station, data *SimulationData) {
+// spend counts interval since start of the previous state until now by its timer
+// and starts interval of state counted by timer, nil ends the last one.
+func (t *Train) spend(timer *timer, now time.Duration) {
+	if t.state != nil {
+		t.state.add(now - t.since)
+	}
+	t.state, t.since = timer, now
+}
+
+// travelled records distance of normal track travelled by train.
+func (t *Train) travelled(track *NormalTrack) {
+	t.distanceLock.Lock()
+	t.distance[track.id] += track.len
+	t.distanceLock.Unlock()
+}
+
+// TrainStats are operational statistics of Train collected during simulation.
+type TrainStats struct {
+	Distance   map[int]int   // km travelled on normal tracks by NormalTrack ID
+	Moving     time.Duration // travelling along normal tracks and rotating on turntables
+	Dwelling   time.Duration // standing at station tracks
+	Blocked    time.Duration // waiting for free track or turntable
+	Broken     time.Duration // waiting for repair
+	Breakdowns int64
+	Cycles     int64 // completed route cycles
+}
+
+// TotalDistance returns km travelled on all normal tracks.
+func (s TrainStats) TotalDistance() (km int) {
+	for _, d := range s.Distance {
+		km += d
+	}
+	return
+}
+
+// Stats returns statistics of train collected so far, time spent on current track is not included yet.
+func (t *Train) Stats() TrainStats {
+	s := TrainStats{
+		Distance:   make(map[int]int),
+		Moving:     t.moving.Value(),
+		Dwelling:   t.dwelling.Value(),
+		Blocked:    t.blocked.Value(),
+		Broken:     t.broken.Value(),
+		Breakdowns: t.breakdowns.Value(),
+		Cycles:     t.cycles.Value()}
+	t.distanceLock.Lock()
+	for id, km := range t.distance {
+		s.Distance[id] = km
+	}
+	t.distanceLock.Unlock()
+	return s
+}
+
+func (t *Train) letPassengersOut(ctx context.Context, station *Station, data *SimulationData) {
 	left := 0
 	for i := range t.validTickets {
 		j := i - left
@@ -133,25 +248,28 @@ func (t *Train) letPassengersOut(station *Station, data *SimulationData) {
 			t.validTickets = append(t.validTickets[:j], t.validTickets[j+1:]...)
 			left++
 			<-t.Seats
-			logger.Printf("%v gets off %v at %v",
-				ticket.owner, t, station)
+			data.publish(workerEvent(Alighted, ticket.owner, station, t))
+			ticket.job.note(ticket.owner, func(wt *WorkerTiming) { wt.Alighted = append(wt.Alighted, data.Clock.Now()) })
 			ticket.owner.In = nil
 			ticket.owner.At = station
 
-			ticket.owner.Done <- true
+			if !signal(ctx, data.Clock, ticket.owner.Done) {
+				return
+			}
 		}
 	}
 }
 
-func (t *Train) validateTickets(station *Station) {
+func (t *Train) validateTickets(station *Station, data *SimulationData) {
 	validated := 0
 	for i := range station.TicketsFor[t] {
 		j := i - validated
 		ticket := (station.TicketsFor[t])[j]
 		select {
 		case t.Seats <- true:
-			logger.Printf("%v gets on %v at %v",
-				ticket.owner, t, station)
+			data.publish(workerEvent(Boarded, ticket.owner, station, t))
+			station.boardings.inc()
+			ticket.job.note(ticket.owner, func(wt *WorkerTiming) { wt.Boarded = append(wt.Boarded, data.Clock.Now()) })
 			station.ticketsMutex.Lock()
 			station.TicketsFor[t] = append((station.TicketsFor[t])[:j], (station.TicketsFor[t])[j+1:]...)
 			station.ticketsMutex.Unlock()
@@ -166,7 +284,7 @@ func (t *Train) validateTickets(station *Station) {
 }
 
 // At returns value of tt'st un-exported field at.
-func (t *Train) At() Track { return t.at }
+func (t *Train) At() Track { return t.at.Get() }
 
 func (t *Train) ID() int { return t.id }
 
@@ -181,7 +299,7 @@ func (t *Train) Connection() (from, to *Turntable) {
 // increments index of tt'st route.
 // Returns stopTime tt will have to spend on new position.
 // MoveTo should be used after after successful lock on next position.
-func (t *Train) SetAt(at Track) { t.at = at }
+func (t *Train) SetAt(at Track) { t.at.Set(at) }
 
 func (t *Train) NextPosition() { t.index = (t.index + 1) % len(t.route) }
 
@@ -192,7 +310,7 @@ func (t *Train) String() string { return fmt.Sprintf("Train%d %s", t.id, strings
 func (t *Train) GoString() string {
 	return fmt.Sprintf(
 		"rails.Train:%s:%d{speed:%d, cap:%d, RepairTime:%d, route:%s, at:%s, Connects:%s}",
-		t.Name, t.id, t.speed, t.capacity, t.repairTime, t.route, t.at, t.Connects)
+		t.Name, t.id, t.speed, t.capacity, t.repairTime, t.route, t.At(), t.Connects)
 }
 
 func (r Route) String() string {
@@ -0,0 +1,226 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError lists all problems found in railway by Validate.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid railway: " + e.Problems[0]
+	}
+	return fmt.Sprintf("invalid railway, %d problems found:\n\t%s",
+		len(e.Problems), strings.Join(e.Problems, "\n\t"))
+}
+
+// validator collects problems found by Validate.
+type validator struct {
+	problems []string
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// ids checks that ids of elements of given kind are unique and follow order of definition,
+// as elements are referenced by their position.
+func (v *validator) ids(kind string, ids []int) {
+	seen := make(map[int]bool, len(ids))
+	for i, id := range ids {
+		if seen[id] {
+			v.errorf("%s id %d is duplicated", kind, id)
+		} else if id != i {
+			v.errorf("%s id %d is out of order, expected %d", kind, id, i)
+		}
+		seen[id] = true
+	}
+}
+
+// Validate checks that railway is internally consistent, so simulation can run on it.
+// All problems are reported at once in *ValidationError, nil is returned when none are found.
+func (r *RailwayData) Validate() error {
+	v := &validator{}
+
+	// IDS
+	ids := make([]int, 0)
+	for _, tt := range r.Turntables {
+		ids = append(ids, tt.id)
+	}
+	v.ids("turntable", ids)
+	ids = ids[:0]
+	for _, nt := range r.NormalTracks {
+		ids = append(ids, nt.id)
+	}
+	v.ids("normal track", ids)
+	ids = ids[:0]
+	for _, st := range r.StationTracks {
+		ids = append(ids, st.id)
+	}
+	v.ids("station track", ids)
+	ids = ids[:0]
+	for _, t := range r.Trains {
+		ids = append(ids, t.id)
+	}
+	v.ids("train", ids)
+	ids = ids[:0]
+	for _, rt := range r.RepairTeams {
+		ids = append(ids, rt.id)
+	}
+	v.ids("repair team", ids)
+	ids = ids[:0]
+	for _, w := range r.Workers {
+		ids = append(ids, w.id)
+	}
+	v.ids("worker", ids)
+
+	// TRACKS
+	for _, nt := range r.NormalTracks {
+		if nt.limit <= 0 {
+			v.errorf("%v has speed limit %d, it must be positive", nt, nt.limit)
+		}
+	}
+
+	// TRAINS
+	starts := make(map[*Turntable]*Train)
+	for _, t := range r.Trains {
+		if t.speed <= 0 {
+			v.errorf("%v has speed %d, it must be positive", t, t.speed)
+		}
+		if other, ok := starts[t.route[0]]; ok {
+			v.errorf("%v and %v both start at %v", other, t, t.route[0])
+		} else {
+			starts[t.route[0]] = t
+		}
+		for i, fst := range t.route {
+			snd := t.route[(i+1)%len(t.route)]
+			if !r.connected(fst, snd) {
+				v.errorf("route of %v goes from %v to %v, but no track joins them", t, fst, snd)
+			}
+		}
+	}
+
+	// REPAIR TEAMS
+	for _, rt := range r.RepairTeams {
+		if rt.speed <= 0 {
+			v.errorf("%v has speed %d, it must be positive", rt, rt.speed)
+		}
+		if !r.hasStationTrack(rt.station) {
+			v.errorf("%v has depot at station track which does not exist", rt)
+			continue
+		}
+		if s := rt.station.station; s.Role != Depot {
+			v.errorf("%v is based at %v, which is %v station, not depot", rt, s, s.Role)
+		}
+		reachable := r.reachable(rt.station.first)
+		for _, s := range r.Stations {
+			if !reachable[s.first] {
+				v.errorf("%v can't be reached from depot of %v", s, rt)
+			}
+		}
+	}
+
+	// WORKERS
+	for _, w := range r.Workers {
+		if w.Home == nil || !r.hasStationTrack(w.Home.StationTracks[0]) {
+			v.errorf("%v has home at station which does not exist", w)
+		} else if w.Home.Role != Passenger {
+			v.errorf("%v has home at %v, which is %v station, not passenger", w, w.Home, w.Home.Role)
+		}
+	}
+
+	// STATIONS
+	for _, s := range r.Stations {
+		// depots are not served by trains
+		if len(s.Trains) == 0 && s.Role != Depot {
+			v.errorf("%v can't be reached, no train route passes it", s)
+		}
+	}
+
+	// DISPATCHER
+	switch d := r.Dispatcher.(type) {
+	case nil, *RandomDispatcher:
+		if len(r.Workers) > 0 && len(r.workplaces()) == 0 {
+			v.errorf("workers have no workplace, all stations are depots")
+		}
+	case *DemandDispatcher:
+		if d.totalWeight() <= 0 {
+			v.errorf("dispatcher demand of all stations is 0, workers have no workplace")
+		}
+		for _, demand := range d.Demand {
+			if !demand.Station.Workplace() {
+				v.errorf("dispatcher demands workers at %v, which is depot", demand.Station)
+			}
+		}
+	case *ScheduleDispatcher:
+		for _, job := range d.Jobs {
+			if !job.Workplace.Workplace() {
+				v.errorf("dispatcher schedules job at %v, which is depot", job.Workplace)
+			}
+		}
+	}
+
+	// train may be planned many times at the same station, each is reported once
+	offRoute := make(map[PlannedStop]bool)
+PlannedStops:
+	for _, p := range r.Plan {
+		for _, s := range p.Train.Connects {
+			if s == p.Station {
+				continue PlannedStops
+			}
+		}
+		if key := (PlannedStop{Train: p.Train, Station: p.Station}); !offRoute[key] {
+			offRoute[key] = true
+			v.errorf("timetable plans %v at %v, which is not on its route", p.Train, p.Station)
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{v.problems}
+	}
+	return nil
+}
+
+// connected reports whether any track joins fst and snd.
+func (r *RailwayData) connected(fst, snd *Turntable) bool {
+	if fst.id < 0 || fst.id >= len(r.Connections) {
+		return false
+	}
+	return len(r.Connections[fst.id][snd.id]) > 0
+}
+
+func (r *RailwayData) hasStationTrack(st *StationTrack) bool {
+	for _, s := range r.StationTracks {
+		if s == st {
+			return true
+		}
+	}
+	return false
+}
+
+// reachable returns set of turntables that can be reached from tt in Connections.
+func (r *RailwayData) reachable(tt *Turntable) map[*Turntable]bool {
+	visited := map[*Turntable]bool{tt: true}
+	queue := []*Turntable{tt}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current.id < 0 || current.id >= len(r.Connections) {
+			continue
+		}
+		for j, tracks := range r.Connections[current.id] {
+			if len(tracks) > 0 && j >= 0 && j < len(r.Turntables) && !visited[r.Turntables[j]] {
+				visited[r.Turntables[j]] = true
+				queue = append(queue, r.Turntables[j])
+			}
+		}
+	}
+	return visited
+}
@@ -0,0 +1,98 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	b, err := ioutil.ReadFile("../../input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := string(b)
+	// every change brings one problem, changed routes get their lengths and plans of stations they leave out are commented out
+	var (
+		duplicateID     = []string{"3 3\n4 0\n", "3 3\n3 0\n"}
+		badLimit        = []string{"2 40 130 50 1 4", "2 40 0 50 1 4"}
+		sharedStart     = []string{"6 7 5 4 1 0 2 3", "0 2 3 6 7 5 4 1"}
+		brokenLink      = []string{"||| 8", "||| 7", "6 7 5 4 1 0 2 3", "6 7 5 4 1 0 3", "plan ||| nad", "# plan ||| nad"}
+		unservedStation = []string{"||| 8", "||| 6", "6 7 5 4 1 0 2 3", "5 4 1 0 2 3", "plan ||| woj", "# plan ||| woj"}
+		join            = func(changes ...[]string) []string {
+			var all []string
+			for _, c := range changes {
+				all = append(all, c...)
+			}
+			return all
+		}
+	)
+	for _, c := range []struct {
+		name     string
+		changes  []string
+		problems []string
+	}{
+		{"valid", nil, nil},
+		{"duplicate id", duplicateID, []string{"worker id 3 is duplicated"}},
+		{"bad speed limit", badLimit, []string{"NormalTrack2 has speed limit 0, it must be positive"}},
+		{"shared start", sharedStart, []string{"Train0 === and Train1 ||| both start at Turntable0"}},
+		{"broken route link", brokenLink, []string{"route of Train1 ||| goes from Turntable0 to Turntable3, but no track joins them"}},
+		{"unserved station", unservedStation, []string{"Station3 WOJ can't be reached, no train route passes it"}},
+		// problems are listed in order of checks
+		{"all at once", join(duplicateID, badLimit, brokenLink, []string{"0 120 220", "0 0 220", "\n1 1\n", "\n1 6\n"}), []string{
+			"worker id 3 is duplicated",
+			"NormalTrack2 has speed limit 0, it must be positive",
+			"Train0 === has speed 0, it must be positive",
+			"route of Train1 ||| goes from Turntable0 to Turntable3, but no track joins them",
+			"Worker1 from REPAIR has home at Station4 REPAIR, which is depot station, not passenger",
+		}},
+	} {
+		text := strings.NewReplacer(c.changes...).Replace(input)
+		data, railway := &SimulationData{}, &RailwayData{}
+		if err := Load(strings.NewReader(text), TextFormat, data, railway); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		err := railway.Validate()
+		if c.problems == nil {
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: got %v, want ValidationError", c.name, err)
+		} else if !reflect.DeepEqual(verr.Problems, c.problems) {
+			t.Errorf("%s: got problems %q, want %q", c.name, verr.Problems, c.problems)
+		}
+	}
+}
+
+func TestValidateReportsPlannedStopOffRouteOnce(t *testing.T) {
+	b, err := ioutil.ReadFile("../../input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// train === doesn't pass woj and is planned there three times
+	text := strings.NewReplacer("plan === nad 13:15", "plan === woj 13:15",
+		"plan === nad 16:45", "plan === woj 16:45", "plan === psp 19:00", "plan === woj 19:00").Replace(string(b))
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := Load(strings.NewReader(text), TextFormat, data, railway); err != nil {
+		t.Fatal(err)
+	}
+
+	var verr *ValidationError
+	if err := railway.Validate(); !errors.As(err, &verr) {
+		t.Fatalf("got %v, want ValidationError", err)
+	}
+	want := "timetable plans Train0 === at Station3 WOJ, which is not on its route"
+	if len(verr.Problems) != 1 || verr.Problems[0] != want {
+		t.Errorf("got problems %q, want only %q", verr.Problems, want)
+	}
+}
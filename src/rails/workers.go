@@ -4,6 +4,7 @@
 package rails
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -27,26 +28,170 @@ type Job struct {
 	workers      WorkerSlice
 	counterMutex sync.Mutex
 	counter      int
+	timingLock   sync.Mutex
+	posted       time.Duration
+	released     time.Duration // all workers arrived and started working
+	finished     time.Duration // work ended
+	timings      map[*Worker]*WorkerTiming
 }
 
+// NOT_YET marks times of jobs which did not come yet.
+const NOT_YET time.Duration = -1
+
 func NewJob(t int, s *Station, ws WorkerSlice) *Job {
-	return &Job{
+	j := &Job{
 		duration:  t,
 		Workplace: s,
 		workers:   ws,
-		counter:   len(ws)}
+		counter:   len(ws),
+		posted:    NOT_YET,
+		released:  NOT_YET,
+		finished:  NOT_YET,
+		timings:   make(map[*Worker]*WorkerTiming)}
+	for _, w := range ws {
+		j.timings[w] = &WorkerTiming{Worker: w, Arrived: NOT_YET, Home: NOT_YET}
+	}
+	return j
 }
 
-func (j *Job) arrived(w *Worker) {
-	defer j.counterMutex.Unlock()
-	j.counterMutex.Lock()
-	j.counter--
+// WorkerTiming are times of single worker of Job, NOT_YET when they did not come yet.
+type WorkerTiming struct {
+	Worker   *Worker
+	Boarded  []time.Duration // got on trains, in order
+	Alighted []time.Duration // got off trains, in order
+	Arrived  time.Duration   // got to workplace
+	Home     time.Duration   // returned home after work
+}
+
+// JobStats are times of Job measured during simulation, NOT_YET when they did not come yet.
+type JobStats struct {
+	Workplace *Station
+	Minutes   int // duration of work
+	Posted    time.Duration
+	Released  time.Duration // last worker arrived, everyone started working
+	Finished  time.Duration // work ended
+	Workers   []WorkerTiming
+}
+
+// Completed reports whether all workers of job are back home.
+func (s JobStats) Completed() bool {
+	for _, wt := range s.Workers {
+		if wt.Home == NOT_YET {
+			return false
+		}
+	}
+	return len(s.Workers) > 0
+}
+
+// State tells what job is waiting for: workers on their way, colleagues, work, workers going home, or done.
+func (s JobStats) State() string {
+	switch {
+	case s.Completed():
+		return "done"
+	case s.Finished != NOT_YET:
+		return "returning"
+	case s.Released != NOT_YET:
+		return "working"
+	}
+	for _, wt := range s.Workers {
+		if wt.Arrived != NOT_YET {
+			return "waiting"
+		}
+	}
+	return "travelling"
+}
 
-	if j.counter == 0 {
-		for _, worker := range j.workers {
-			worker.ready <- true
+// Commute returns mean time workers took to get to work after job was posted and
+// mean time they took to get home after work, only workers who got there count.
+func (s JobStats) Commute() (there, back time.Duration) {
+	var n, m time.Duration
+	for _, wt := range s.Workers {
+		if wt.Arrived != NOT_YET && s.Posted != NOT_YET {
+			there += wt.Arrived - s.Posted
+			n++
+		}
+		if wt.Home != NOT_YET && s.Finished != NOT_YET {
+			back += wt.Home - s.Finished
+			m++
 		}
 	}
+	if n > 0 {
+		there /= n
+	}
+	if m > 0 {
+		back /= m
+	}
+	return
+}
+
+// Waiting returns time lost by all workers waiting at workplace for colleagues, until now when work did not start yet.
+func (s JobStats) Waiting(now time.Duration) (lost time.Duration) {
+	released := s.Released
+	if released == NOT_YET {
+		released = now
+	}
+	for _, wt := range s.Workers {
+		if wt.Arrived != NOT_YET {
+			lost += released - wt.Arrived
+		}
+	}
+	return
+}
+
+// note changes timing of worker w under lock, it does nothing for nil job.
+func (j *Job) note(w *Worker, change func(wt *WorkerTiming)) {
+	if j == nil {
+		return
+	}
+	j.timingLock.Lock()
+	defer j.timingLock.Unlock()
+	if wt, ok := j.timings[w]; ok {
+		change(wt)
+	}
+}
+
+// Stats returns times of job measured so far.
+func (j *Job) Stats() JobStats {
+	j.timingLock.Lock()
+	defer j.timingLock.Unlock()
+	s := JobStats{j.Workplace, j.duration, j.posted, j.released, j.finished, make([]WorkerTiming, 0, len(j.workers))}
+	for _, w := range j.workers {
+		wt := *j.timings[w]
+		wt.Boarded = append([]time.Duration{}, wt.Boarded...)
+		wt.Alighted = append([]time.Duration{}, wt.Alighted...)
+		s.Workers = append(s.Workers, wt)
+	}
+	return s
+}
+
+// post remembers job posted by Dispatcher at now.
+func (r *RailwayData) post(j *Job, now time.Duration) {
+	j.timingLock.Lock()
+	j.posted = now
+	j.timingLock.Unlock()
+	r.jobsLock.Lock()
+	r.jobs = append(r.jobs, j)
+	r.jobsLock.Unlock()
+}
+
+// Jobs returns times of all jobs posted by Dispatcher so far, in order of posting.
+func (r *RailwayData) Jobs() []JobStats {
+	r.jobsLock.Lock()
+	jobs := append([]*Job{}, r.jobs...)
+	r.jobsLock.Unlock()
+	stats := make([]JobStats, len(jobs))
+	for i, j := range jobs {
+		stats[i] = j.Stats()
+	}
+	return stats
+}
+
+// arrived notes that w got to work, reports whether all workers of job are there.
+func (j *Job) arrived(w *Worker) bool {
+	defer j.counterMutex.Unlock()
+	j.counterMutex.Lock()
+	j.counter--
+	return j.counter == 0
 }
 
 type Worker struct {
@@ -55,9 +200,12 @@ type Worker struct {
 	Job   *Job
 	At    *Station
 	In    *Train
-	Done  chan bool
-	ready chan bool
-	Work  chan *Job
+	Done  *Port
+	ready *Port
+	Work  *Port
+	trip  *Job    // job of current trip, kept until worker is back home
+	state gauge   // WorkerState, read concurrently by metrics
+	jobs  counter // finished jobs
 }
 
 func NewWorker(id int, home *Station) (worker *Worker) {
@@ -67,23 +215,33 @@ func NewWorker(id int, home *Station) (worker *Worker) {
 		Job:   nil,
 		At:    home,
 		In:    nil,
-		Done:  make(chan bool),
-		ready: make(chan bool),
-		Work:  make(chan *Job)}
+		Done:  NewPort(),
+		ready: NewPort(),
+		Work:  NewPort()}
 	return
 }
 
-func (w *Worker) Simulate(railway *RailwayData, data *SimulationData) {
+func (w *Worker) Simulate(ctx context.Context, railway *RailwayData, data *SimulationData, wg *sync.WaitGroup) {
+	defer wg.Done()
+
 	for {
 	WaitForWork:
-		w.Job = <-w.Work
-		logger.Printf("%s %v goes to work at %v for %dm",
-			ClockTime(data), w, w.Job.Workplace, w.Job.duration)
+		job, ok := w.Work.Receive(ctx, data.Clock)
+		if !ok {
+			return
+		}
+		w.Job = job.(*Job)
+		w.trip = w.Job
+		w.state.set(int64(Travelling))
+		assigned := workerEvent(JobAssigned, w, w.Job.Workplace, nil)
+		assigned.Minutes = w.Job.duration
+		data.publish(assigned)
 
 		if w.Job.Workplace == w.Home {
-			w.work(data)
-			logger.Printf("%s %v returned from work",
-				ClockTime(data), w)
+			if !w.work(ctx, data) {
+				return
+			}
+			w.returned(data)
 			goto WaitForWork
 		} else {
 			depT := w.Home.Trains
@@ -92,12 +250,13 @@ func (w *Worker) Simulate(railway *RailwayData, data *SimulationData) {
 			for _, dt := range depT {
 				for _, at := range arrT {
 					if dt == at {
-						w.travel(at, w.Home, w.Job.Workplace)
-						w.work(data)
-						w.travel(at, w.At, w.Home)
+						if !w.travel(ctx, data, at, w.Home, w.Job.Workplace) ||
+							!w.work(ctx, data) ||
+							!w.travel(ctx, data, at, w.At, w.Home) {
+							return
+						}
 
-						logger.Printf("%s %v returned from work",
-							ClockTime(data), w)
+						w.returned(data)
 
 						goto WaitForWork
 					}
@@ -111,14 +270,15 @@ func (w *Worker) Simulate(railway *RailwayData, data *SimulationData) {
 					for _, at := range arrT {
 						for _, sa := range at.Connects {
 							if sd == sa {
-								w.travel(dt, w.Home, sd)
-								w.travel(at, sd, w.Job.Workplace)
-								w.work(data)
-								w.travel(at, w.At, sa)
-								w.travel(dt, sa, w.Home)
+								if !w.travel(ctx, data, dt, w.Home, sd) ||
+									!w.travel(ctx, data, at, sd, w.Job.Workplace) ||
+									!w.work(ctx, data) ||
+									!w.travel(ctx, data, at, w.At, sa) ||
+									!w.travel(ctx, data, dt, sa, w.Home) {
+									return
+								}
 
-								logger.Printf("%s %v returned from work",
-									ClockTime(data), w)
+								w.returned(data)
 
 								goto WaitForWork
 							}
@@ -130,8 +290,38 @@ func (w *Worker) Simulate(railway *RailwayData, data *SimulationData) {
 	}
 }
 
+// returned notes that w got home after work.
+func (w *Worker) returned(data *SimulationData) {
+	data.publish(workerEvent(WorkerReturned, w, w.Home, nil))
+	w.trip.note(w, func(wt *WorkerTiming) { wt.Home = data.Clock.Now() })
+	w.trip = nil
+	w.state.set(int64(AtHome))
+}
+
 func (w *Worker) ID() int { return w.id }
 
+// WorkerState tells what Worker is doing.
+type WorkerState int
+
+const (
+	AtHome     WorkerState = iota // resting at home
+	Travelling                    // on the way to work or back home, on train or waiting for it
+	Waiting                       // at workplace, waiting for colleagues
+	Working
+)
+
+var workerStateNames = [...]string{"home", "travelling", "waiting", "working"}
+
+func (s WorkerState) String() string {
+	if s >= 0 && int(s) < len(workerStateNames) {
+		return workerStateNames[s]
+	}
+	return fmt.Sprintf("WorkerState(%d)", int(s))
+}
+
+// State returns what w is doing now.
+func (w *Worker) State() WorkerState { return WorkerState(w.state.Value()) }
+
 type Tickets []*Ticket
 
 type Ticket struct {
@@ -139,50 +329,80 @@ type Ticket struct {
 	departure   *Station
 	destination *Station
 	train       *Train
+	job         *Job // job owner travels for
 }
 
-func (w *Worker) travel(train *Train, from *Station, to *Station) {
+// travel buys ticket and waits until w gets off train at destination.
+// Returns false when ctx is cancelled first.
+func (w *Worker) travel(ctx context.Context, data *SimulationData, train *Train, from *Station, to *Station) bool {
 	from.ticketsMutex.Lock()
 	ticket := &Ticket{
 		owner:       w,
 		departure:   from,
 		destination: to,
-		train:       train}
+		train:       train,
+		job:         w.trip}
 	from.TicketsFor[train] = append(from.TicketsFor[train], ticket)
 	from.ticketsMutex.Unlock()
 
-	logger.Printf("%v got ticket for %v[%v->%v]",
-		w, train, from, to)
+	issued := workerEvent(TicketIssued, w, from, train)
+	issued.Destination = to.id
+	data.publish(issued)
 
-	<-w.Done
+	return await(ctx, data.Clock, w.Done)
 }
 
-func (w *Worker) work(data *SimulationData) {
-	go w.Job.arrived(w)
-	<-w.ready
+// work waits for all workers of the job and works for its duration.
+// Returns false when ctx is cancelled first.
+func (w *Worker) work(ctx context.Context, data *SimulationData) bool {
+	job := w.Job
+	job.note(w, func(wt *WorkerTiming) { wt.Arrived = data.Clock.Now() })
+	w.state.set(int64(Waiting))
+	if job.arrived(w) {
+		// the last worker lets colleagues waiting for it start working
+		for _, colleague := range job.workers {
+			if colleague != w && !signal(ctx, data.Clock, colleague.ready) {
+				return false
+			}
+		}
+	} else if !await(ctx, data.Clock, w.ready) {
+		return false
+	}
+	w.state.set(int64(Working))
+	job.timingLock.Lock()
+	if job.released == NOT_YET {
+		job.released = data.Clock.Now()
+	}
+	job.timingLock.Unlock()
 
-	logger.Printf("%s %v is working...",
-		ClockTime(data), w)
+	data.publish(workerEvent(WorkStarted, w, w.Job.Workplace, nil))
 
-	duration := float64(w.Job.duration) / 60.0
-	sleepTime := float64(data.SecondsPerHour) * duration * 1000.0
-	time.Sleep(time.Duration(sleepTime) * time.Millisecond)
+	if data.Clock.Sleep(ctx, time.Duration(w.Job.duration)*time.Minute) != nil {
+		return false
+	}
 
-	logger.Printf("%s %v leaves work",
-		ClockTime(data), w)
+	data.publish(workerEvent(WorkFinished, w, w.Job.Workplace, nil))
+	w.state.set(int64(Travelling))
+	job.timingLock.Lock()
+	if job.finished == NOT_YET {
+		job.finished = data.Clock.Now()
+	}
+	job.timingLock.Unlock()
+	w.jobs.inc()
 	w.Job = nil
+	return true
 }
 
 func (w *Worker) String() string {
 	return fmt.Sprintf("Worker%d from %s", w.id, w.Home.Name)
 }
 
-func (ws WorkerSlice) Subset(n int) (subset WorkerSlice) {
+// Subset returns n distinct workers chosen using given random source.
+func (ws WorkerSlice) Subset(random *rand.Rand, n int) (subset WorkerSlice) {
 	if n > len(ws) {
 		panic("Can't generate random subset larger than set")
 	}
-	rand.Seed(time.Now().UnixNano())
-	for _, i := range rand.Perm(len(ws))[:n] {
+	for _, i := range random.Perm(len(ws))[:n] {
 		subset = append(subset, ws[i])
 	}
 	return subset
@@ -0,0 +1,511 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Railway descriptions use only a small subset of YAML: block mappings and sequences,
+// flow sequences and mappings written in one line, plain and quoted scalars and comments.
+// yamlToJSON and marshalYAML implement just that subset, so JSON decoding rules
+// of Description apply to YAML files as well.
+
+// yamlToJSON converts YAML document to JSON document.
+func yamlToJSON(b []byte) ([]byte, error) {
+	p := &yamlParser{}
+	if err := p.split(b); err != nil {
+		return nil, err
+	}
+	if len(p.lines) == 0 {
+		return []byte("{}"), nil
+	}
+	v, err := p.node(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf(p.lines[p.pos].num, "unexpected indentation")
+	}
+	return json.Marshal(v)
+}
+
+type yamlLine struct {
+	indent int    // leading spaces
+	text   string // content without indentation and comment
+	num    int    // line number in document
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(num int, format string, args ...interface{}) error {
+	return fmt.Errorf("YAML description: line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+// split cuts document into non-empty lines without comments.
+func (p *yamlParser) split(b []byte) error {
+	for i, line := range strings.Split(string(b), "\n") {
+		num := i + 1
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text == "---" || text == "..." {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return p.errorf(num, "tabs can't be used for indentation")
+		}
+		p.lines = append(p.lines, yamlLine{len(line) - len(text), text, num})
+	}
+	return nil
+}
+
+// stripYAMLComment cuts comment starting with # at line start or after whitespace, outside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isSequenceItem(text string) bool { return text == "-" || strings.HasPrefix(text, "- ") }
+
+// node parses value starting at current line, which has given indentation.
+func (p *yamlParser) node(indent int) (interface{}, error) {
+	l := p.lines[p.pos]
+	if isSequenceItem(l.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok, err := splitYAMLKey(l.text); err != nil {
+		return nil, p.errorf(l.num, "%v", err)
+	} else if ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	return parseYAMLValue(l.text, l.num)
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	items := make([]interface{}, 0)
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+		l := p.lines[p.pos]
+		rest := strings.TrimLeft(l.text[1:], " ")
+		var v interface{}
+		var err error
+		if rest == "" {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				v, err = p.node(p.lines[p.pos].indent)
+			}
+		} else {
+			// content after "- " is parsed as if it started its own, deeper indented line
+			deeper := indent + len(l.text) - len(rest)
+			p.lines[p.pos] = yamlLine{deeper, rest, l.num}
+			v, err = p.node(deeper)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, p.errorf(p.lines[p.pos].num, "unexpected indentation")
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		key, rest, ok, err := splitYAMLKey(l.text)
+		if err != nil {
+			return nil, p.errorf(l.num, "%v", err)
+		} else if !ok {
+			return nil, p.errorf(l.num, "expected key: value")
+		}
+		if _, ok := m[key]; ok {
+			return nil, p.errorf(l.num, "key %q is repeated", key)
+		}
+		p.pos++
+
+		var v interface{}
+		switch {
+		case rest != "":
+			v, err = parseYAMLValue(rest, l.num)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent > indent:
+			v, err = p.node(p.lines[p.pos].indent)
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text):
+			v, err = p.sequence(indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, p.errorf(p.lines[p.pos].num, "unexpected indentation")
+	}
+	return m, nil
+}
+
+// splitYAMLKey splits "key: value" line, ok is false when text is not a mapping entry.
+func splitYAMLKey(text string) (key, rest string, ok bool, err error) {
+	if text == "" || strings.ContainsRune("[{", rune(text[0])) {
+		return "", "", false, nil
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		key, n, err := parseYAMLQuoted(text)
+		if err != nil {
+			return "", "", false, err
+		}
+		after := text[n:]
+		if !strings.HasPrefix(after, ":") || (len(after) > 1 && after[1] != ' ') {
+			return "", "", false, nil
+		}
+		return key, strings.TrimSpace(after[1:]), true, nil
+	}
+	if i := strings.Index(text, ": "); i >= 0 {
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), true, nil
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true, nil
+	}
+	return "", "", false, nil
+}
+
+// parseYAMLValue parses scalar or one-line flow collection filling whole text.
+func parseYAMLValue(text string, num int) (interface{}, error) {
+	if !strings.ContainsRune("[{\"'|>&*!", rune(text[0])) {
+		// plain scalars outside flow collections may contain commas and brackets
+		return plainYAMLScalar(text), nil
+	}
+	f := &yamlFlow{s: text}
+	v, err := f.value()
+	if err == nil {
+		f.skipSpaces()
+		if f.i < len(f.s) {
+			err = fmt.Errorf("unexpected %q", f.s[f.i:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("YAML description: line %d: %v", num, err)
+	}
+	return v, nil
+}
+
+// yamlFlow parses flow collections and scalars within a single line.
+type yamlFlow struct {
+	s string
+	i int
+}
+
+func (f *yamlFlow) skipSpaces() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) value() (interface{}, error) {
+	f.skipSpaces()
+	if f.i >= len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.i] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		s, n, err := parseYAMLQuoted(f.s[f.i:])
+		f.i += n
+		return s, err
+	case '|', '>', '&', '*', '!':
+		return nil, fmt.Errorf("%q is not supported", f.s[f.i])
+	}
+	start := f.i
+	for f.i < len(f.s) && !strings.ContainsRune(",]}", rune(f.s[f.i])) {
+		f.i++
+	}
+	return plainYAMLScalar(strings.TrimSpace(f.s[start:f.i])), nil
+}
+
+func (f *yamlFlow) sequence() (interface{}, error) {
+	f.i++ // [
+	items := make([]interface{}, 0)
+	for {
+		f.skipSpaces()
+		if f.i >= len(f.s) {
+			return nil, fmt.Errorf("unterminated flow sequence")
+		}
+		if f.s[f.i] == ']' {
+			f.i++
+			return items, nil
+		}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		f.skipSpaces()
+		if f.i < len(f.s) && f.s[f.i] == ',' {
+			f.i++
+		} else if f.i >= len(f.s) || f.s[f.i] != ']' {
+			return nil, fmt.Errorf("expected , or ] in flow sequence")
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (interface{}, error) {
+	f.i++ // {
+	m := make(map[string]interface{})
+	for {
+		f.skipSpaces()
+		if f.i >= len(f.s) {
+			return nil, fmt.Errorf("unterminated flow mapping")
+		}
+		if f.s[f.i] == '}' {
+			f.i++
+			return m, nil
+		}
+		var key string
+		if c := f.s[f.i]; c == '"' || c == '\'' {
+			k, n, err := parseYAMLQuoted(f.s[f.i:])
+			if err != nil {
+				return nil, err
+			}
+			key = k
+			f.i += n
+		} else {
+			start := f.i
+			for f.i < len(f.s) && f.s[f.i] != ':' && f.s[f.i] != ',' && f.s[f.i] != '}' {
+				f.i++
+			}
+			key = strings.TrimSpace(f.s[start:f.i])
+		}
+		f.skipSpaces()
+		if f.i >= len(f.s) || f.s[f.i] != ':' {
+			return nil, fmt.Errorf("expected : after key %q in flow mapping", key)
+		}
+		f.i++
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("key %q is repeated", key)
+		}
+		m[key] = v
+		f.skipSpaces()
+		if f.i < len(f.s) && f.s[f.i] == ',' {
+			f.i++
+		} else if f.i >= len(f.s) || f.s[f.i] != '}' {
+			return nil, fmt.Errorf("expected , or } in flow mapping")
+		}
+	}
+}
+
+// parseYAMLQuoted parses quoted string at the beginning of s, returning its value and length.
+func parseYAMLQuoted(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			if quote == '\'' {
+				return strings.Replace(s[1:i], "''", "'", -1), i + 1, nil
+			}
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid quoted string %s", s[:i+1])
+			}
+			return v, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string %s", s)
+}
+
+// plainYAMLScalar converts unquoted scalar to number, bool, nil or string.
+func plainYAMLScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return json.Number(s)
+	}
+	return s
+}
+
+// marshalYAML writes v as YAML block mapping. Structs are written as mappings with keys
+// and order of their json tags, slices of scalars are written in flow style.
+func marshalYAML(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := writeYAMLBlock(&b, reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeYAMLBlock writes struct or slice v as block collection indented by indent spaces.
+func writeYAMLBlock(b *bytes.Buffer, v reflect.Value, indent int) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	pad := strings.Repeat(" ", indent)
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, omitEmpty := jsonFieldName(t.Field(i))
+			if name == "" {
+				continue
+			}
+			field := v.Field(i)
+			if omitEmpty && field.IsZero() {
+				continue
+			}
+			if s, ok := flowYAML(field); ok {
+				fmt.Fprintf(b, "%s%s: %s\n", pad, name, s)
+				continue
+			}
+			fmt.Fprintf(b, "%s%s:\n", pad, name)
+			if err := writeYAMLBlock(b, field, indent+2); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if s, ok := flowYAML(v.Index(i)); ok {
+				fmt.Fprintf(b, "%s- %s\n", pad, s)
+				continue
+			}
+			// write item one level deeper, then put dash in place of indentation of its first line
+			var item bytes.Buffer
+			if err := writeYAMLBlock(&item, v.Index(i), indent+2); err != nil {
+				return err
+			}
+			lines := item.Bytes()
+			if len(lines) < indent+2 {
+				fmt.Fprintf(b, "%s- {}\n", pad)
+				continue
+			}
+			b.WriteString(pad + "- ")
+			b.Write(lines[indent+2:])
+		}
+	default:
+		return fmt.Errorf("can't write %v as YAML block", v.Type())
+	}
+	return nil
+}
+
+// flowYAML formats scalars, empty collections and slices of scalars in one line.
+func flowYAML(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "null", true
+		}
+		v = v.Elem()
+	}
+	if m, ok := v.Interface().(json.Marshaler); ok && v.Kind() != reflect.Struct {
+		// scalars with own JSON encoding, written as JSON number or string
+		if b, err := m.MarshalJSON(); err == nil {
+			var s string
+			if json.Unmarshal(b, &s) == nil {
+				return quoteYAML(s), true
+			}
+			return string(b), true
+		}
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.String:
+		return quoteYAML(v.String()), true
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			s, ok := flowYAML(v.Index(i))
+			if !ok || strings.HasPrefix(s, "[") {
+				return "", false
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", true
+	}
+	return "", false
+}
+
+var plainYAMLString = regexp.MustCompile(`^[\pL_][\pL\pN_ .\-/]*$`)
+
+// quoteYAML returns s as plain scalar when it would be read back as the same string,
+// otherwise as double quoted scalar.
+func quoteYAML(s string) string {
+	if plainYAMLString.MatchString(s) && !strings.HasSuffix(s, " ") {
+		switch strings.ToLower(s) {
+		case "y", "n", "yes", "no", "on", "off":
+			// booleans for older YAML readers
+		default:
+			if _, ok := plainYAMLScalar(s).(string); ok {
+				return s
+			}
+		}
+	}
+	return strconv.Quote(s)
+}
+
+// jsonFieldName returns name of struct field given by its json tag, empty for skipped fields.
+func jsonFieldName(f reflect.StructField) (name string, omitEmpty bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := strings.Split(f.Tag.Get("json"), ",")
+	if tag[0] == "-" {
+		return "", false
+	}
+	name = tag[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, option := range tag[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty
+}
@@ -0,0 +1,161 @@
+/*
+ * Radoslaw Kowalski 221454
+ */
+package rails
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	for _, c := range []struct {
+		name, yaml, json string
+	}{
+		{"empty document", "", `{}`},
+		{"document markers", "---\na: 1\n...\n", `{"a":1}`},
+		{"nested mappings", "a:\n  b: 1\n  c:\n    d: x\ne: 2\n", `{"a":{"b":1,"c":{"d":"x"}},"e":2}`},
+		{"deeper indentation", "a:\n    b: 1\n    c:\n         d: x\n", `{"a":{"b":1,"c":{"d":"x"}}}`},
+		{"empty value", "a:\nb: 1\n", `{"a":null,"b":1}`},
+		{"block sequence", "items:\n  - 1\n  - two\n", `{"items":[1,"two"]}`},
+		{"sequence at key indentation", "items:\n- a\n- b\nn: 1\n", `{"items":["a","b"],"n":1}`},
+		{"sequence of mappings", "t:\n  - id: 0\n    name: a\n  -\n    id: 1\n", `{"t":[{"id":0,"name":"a"},{"id":1}]}`},
+		{"nested block sequences", "- - 1\n  - 2\n- - 3\n", `[[1,2],[3]]`},
+		{"flow sequences", "r: [1, 2 , [3, x], []]\n", `{"r":[1,2,[3,"x"],[]]}`},
+		{"flow mappings", "m: {a: 1, 'b c': [x], \"d\": {}}\n", `{"m":{"a":1,"b c":["x"],"d":{}}}`},
+		{"double quoted scalars", `a: "x # y"` + "\n" + `b: "tab\t\"q\""` + "\n", `{"a":"x # y","b":"tab\t\"q\""}`},
+		{"single quoted scalars", "a: 'it''s'\nb: '# no comment'\n'c d': ''\n", `{"a":"it's","b":"# no comment","c d":""}`},
+		{"quoted scalars in flow", "r: [\"a, b\", 'c]']\n", `{"r":["a, b","c]"]}`},
+		{"plain scalars", "a: 1.5\nb: true\nc: ~\nd: null\ne: -3\nf: False\n", `{"a":1.5,"b":true,"c":null,"d":null,"e":-3,"f":false}`},
+		{"plain strings", "a: hello world, again [1]\nb: x: y\nc: 12:30\n", `{"a":"hello world, again [1]","b":"x: y","c":"12:30"}`},
+		{"comments", "# head\na: 1 # after\nb: x#y\n  # indented\n\nc: [1, 2] # flow\n", `{"a":1,"b":"x#y","c":[1,2]}`},
+		{"windows line ends", "a: 1\r\nb:\r\n  - x\r\n", `{"a":1,"b":["x"]}`},
+	} {
+		b, err := yamlToJSON([]byte(c.yaml))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if string(b) != c.json {
+			t.Errorf("%s: got %s, want %s", c.name, b, c.json)
+		}
+	}
+}
+
+func TestYAMLToJSONErrors(t *testing.T) {
+	for _, c := range []struct {
+		name, yaml, err string
+	}{
+		{"tab indentation", "a:\n\tb: 1\n", "line 2: tabs can't be used for indentation"},
+		{"deeper line after scalar", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"line between indentations", "a:\n  b: 1\n c: 2\n", "line 3: unexpected indentation"},
+		{"deeper sequence item", "- 1\n  - 2\n", "line 2: unexpected indentation"},
+		{"mapping after sequence", "- a\nb: 1\n", "line 2: unexpected indentation"},
+		{"scalar among keys", "a: 1\n\n# comment\nplain\n", "line 4: expected key: value"},
+		{"repeated key", "a: 1\nb: 2\na: 3\n", `line 3: key "a" is repeated`},
+		{"repeated flow key", "m: {a: 1, a: 2}\n", `line 1: key "a" is repeated`},
+		{"unterminated flow sequence", "a:\n  b: [1, 2,\n", "line 2: unterminated flow sequence"},
+		{"unterminated flow mapping", "a: {b: 1,\n", "line 1: unterminated flow mapping"},
+		{"missing comma", "a: [[1] 2]\n", "line 1: expected , or ] in flow sequence"},
+		{"missing colon", "a: {b 1}\n", `line 1: expected : after key "b 1" in flow mapping`},
+		{"text after flow", "a: [1] x\n", `line 1: unexpected "x"`},
+		{"unterminated quote", "a: 1\nb: \"x\n", `line 2: unterminated quoted string "x`},
+		{"invalid escape", `a: "\q"`, `line 1: invalid quoted string "\q"`},
+		{"unterminated quoted key", "'a: 1\n", "line 1: unterminated quoted string 'a: 1"},
+		{"block scalar", "a: |\n  text\n", "line 1: '|' is not supported"},
+		{"anchor", "a: &x 1\n", "line 1: '&' is not supported"},
+	} {
+		_, err := yamlToJSON([]byte(c.yaml))
+		if err == nil {
+			t.Errorf("%s: no error, want %q", c.name, c.err)
+		} else if want := "YAML description: " + c.err; err.Error() != want {
+			t.Errorf("%s: error %q, want %q", c.name, err, want)
+		}
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	type item struct {
+		Id   int      `json:"id"`
+		Tags []string `json:"tags,omitempty"`
+	}
+	v := struct {
+		Name   string   `json:"name"`
+		Rate   float64  `json:"rate"`
+		On     bool     `json:"on"`
+		Next   *item    `json:"next"`
+		Items  []item   `json:"items"`
+		Empty  []item   `json:"empty"`
+		Skip   int      `json:"-"`
+		Hidden int      `json:"hidden,omitempty"`
+		Rows   [][]int  `json:"rows"`
+		Words  []string `json:"words"`
+	}{
+		Name:  "Kraków Główny",
+		Rate:  0.25,
+		On:    true,
+		Items: []item{{0, nil}, {1, []string{"a b", "true", "12", "x: y", ""}}},
+		Empty: []item{},
+		Skip:  1,
+		Rows:  [][]int{{1, 2}, {}},
+		Words: []string{"yes", "no", "off"},
+	}
+	want := `name: Kraków Główny
+rate: 0.25
+on: true
+next: null
+items:
+  - id: 0
+  - id: 1
+    tags: [a b, "true", "12", "x: y", ""]
+empty: []
+rows:
+  - [1, 2]
+  - []
+words: ["yes", "no", "off"]
+`
+	b, err := marshalYAML(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", b, want)
+	}
+	b, err = yamlToJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"empty":[],"items":[{"id":0},{"id":1,"tags":["a b","true","12","x: y",""]}],"name":"Kraków Główny","next":null,"on":true,"rate":0.25,"rows":[[1,2],[]],"words":["yes","no","off"]}`; got != want {
+		t.Errorf("read back as %s, want %s", got, want)
+	}
+}
+
+// saveAs loads railway description in format from b and saves it in format to.
+func saveAs(t *testing.T, b []byte, format, to Format) []byte {
+	t.Helper()
+	data, railway := &SimulationData{}, &RailwayData{}
+	if err := Load(bytes.NewReader(b), format, data, railway); err != nil {
+		t.Fatalf("load %v: %v", format, err)
+	}
+	var out bytes.Buffer
+	if err := Save(&out, to, data, railway); err != nil {
+		t.Fatalf("save %v: %v", to, err)
+	}
+	return out.Bytes()
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	// input has names, roles, failures, dispatcher and plan
+	for _, file := range []string{"../../input", "../../poland"} {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		yaml := saveAs(t, text, TextFormat, YAMLFormat)
+		if again := saveAs(t, yaml, YAMLFormat, YAMLFormat); !bytes.Equal(again, yaml) {
+			t.Errorf("%s: YAML saved after loading YAML differs:\n%s\nfirst:\n%s", file, again, yaml)
+		}
+		if got, want := saveAs(t, yaml, YAMLFormat, JSONFormat), saveAs(t, text, TextFormat, JSONFormat); !bytes.Equal(got, want) {
+			t.Errorf("%s: railway loaded from YAML differs from one loaded from text", file)
+		}
+	}
+}